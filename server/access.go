@@ -0,0 +1,104 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ==============
+// ACCESS CONTROL
+// ==============
+
+// The IP address ranges that are allowed or denied access to the server
+type accessList struct {
+	allow []netip.Prefix // The ranges that are allowed (taking precedence over the denied ones)
+	deny  []netip.Prefix // The ranges that are denied
+}
+
+// Parse the --allow and --deny values (CIDR ranges like `192.168.1.0/24`, or single addresses)
+func parseAccessList(allow, deny []string) (accessList, error) {
+	var list accessList
+	var err error
+	if list.allow, err = parsePrefixes(allow); err != nil {
+		return list, err
+	}
+	list.deny, err = parsePrefixes(deny)
+	return list, err
+}
+
+// Boolean indicating whether the access list has any rules
+func (list accessList) IsEmpty() bool {
+	return len(list.allow) == 0 && len(list.deny) == 0
+}
+
+// Boolean indicating whether the address is allowed access. Addresses in an allowed range are
+// always allowed, and addresses in a denied range are not. Other addresses are allowed,
+// unless there are only allowed ranges (making it an allowlist).
+func (list accessList) allows(addr netip.Addr) bool {
+	addr = addr.Unmap() // Match IPv4-mapped IPv6 addresses (like ::ffff:192.168.1.2) against IPv4 ranges
+	for _, prefix := range list.allow {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	for _, prefix := range list.deny {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return len(list.deny) > 0 || len(list.allow) == 0
+}
+
+// Middleware that refuses requests from addresses the access list does not allow, with a 403
+func accessControl(list accessList, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		addr, err := netip.ParseAddr(host)
+		if r.RemoteAddr == "@" || r.RemoteAddr == "" {
+			addr, err = netip.AddrFrom4([4]byte{127, 0, 0, 1}), nil // Unix domain socket peers are local
+		}
+		if err != nil || !list.allows(addr) {
+			requestLogger(r).Println("Denied access to", r.RemoteAddr)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Parse the CIDR ranges (treating single addresses as ranges of one)
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			if !strings.Contains(item, "/") {
+				addr, err := netip.ParseAddr(item)
+				if err != nil {
+					return nil, fmt.Errorf("invalid address range %q (expected CIDR like 192.168.1.0/24)", item)
+				}
+				prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+				continue
+			}
+			prefix, err := netip.ParsePrefix(item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address range %q (expected CIDR like 192.168.1.0/24)", item)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+		}
+	}
+	return prefixes, nil
+}
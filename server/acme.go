@@ -0,0 +1,51 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ====
+// ACME
+// ====
+
+// Create a certificate manager that obtains and renews certificates for the given
+// domains automatically from Let's Encrypt, caching them in the given directory.
+// Serve with its TLSConfig, and answer its HTTP-01 challenges with acmeChallengeServer.
+func acmeManager(domains []string, cacheDir string) *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Cache:      autocert.DirCache(cacheDir),
+	}
+}
+
+// Create a server that answers the HTTP-01 challenges of the certificate manager on port 80
+// (to start with startACMEChallenges, and close on Shutdown)
+func acmeChallengeServer(manager *autocert.Manager) *http.Server {
+	return &http.Server{Addr: ":80", Handler: manager.HTTPHandler(nil)}
+}
+
+// Answer the HTTP-01 challenges in the background. This is best-effort as the TLS-ALPN-01
+// challenge on the TLS listener is enough when serving on port 443.
+func (s *Self) startACMEChallenges(challenges *http.Server) {
+	go func() {
+		if err := challenges.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Println("ACME HTTP-01 challenge listener unavailable:", err)
+		}
+	}()
+}
+
+// Split a comma separated list of domains
+func parseDomains(list string) []string {
+	var domains []string
+	for _, domain := range strings.Split(list, ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
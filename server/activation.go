@@ -0,0 +1,31 @@
+package server
+
+import (
+	"os"
+	"strconv"
+)
+
+// =========================
+// SYSTEMD SOCKET ACTIVATION
+// =========================
+
+// The file descriptor of the first socket passed by systemd (after stdin, stdout and stderr)
+const listenFDsStart = 3
+
+// The socket passed by systemd's socket activation (the first one, if several), or nil if
+// the process was not socket activated. The environment variables are unset, so that the
+// child processes (like CGI scripts) do not mistake themselves for being socket activated.
+func activatedSocket() *os.File {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if err != nil || count < 1 {
+		return nil
+	}
+	return os.NewFile(listenFDsStart, "systemd-socket")
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// =================
+// ARCHIVE DOWNLOADS
+// =================
+
+// An archive format that directories can be downloaded as
+type archiveFormat struct {
+	query       string                                                            // The query parameter that requests the format
+	extension   string                                                            // The file extension of the archive
+	contentType string                                                            // The media type of the archive
+	write       func(w io.Writer, fsys http.FileSystem, dir, prefix string) error // Writes the directory to the archive
+}
+
+// The archive formats, by the query parameter that requests them
+var archiveFormats = []archiveFormat{
+	{"zip", ".zip", "application/zip", writeZip},
+	{"tar", ".tar.gz", "application/gzip", writeTarGz},
+}
+
+// Middleware that streams the requested directory as an archive, built on the fly, when
+// requested with `?zip` or `?tar` (a gzipped tarball, which preserves the file permissions).
+// The root directory's archive is named after rootName.
+func downloadArchives(fsys http.FileSystem, rootName string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		index := slices.IndexFunc(archiveFormats, func(format archiveFormat) bool { return query.Has(format.query) })
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || index < 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		format := archiveFormats[index]
+		dir := path.Clean("/" + r.URL.Path)
+		if info, err := stat(fsys, dir); err != nil || !info.IsDir() {
+			next.ServeHTTP(w, r) // Leave files (and errors) to the file server
+			return
+		}
+
+		name := path.Base(dir)
+		if dir == "/" {
+			name = rootName
+		}
+		w.Header().Set("Content-Type", format.contentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="`+strings.ReplaceAll(name, `"`, "")+format.extension+`"`)
+		w.Header().Set("Cache-Control", "no-store")
+		if r.Method == http.MethodHead {
+			return
+		}
+
+		// The response has started by now, so errors can only be logged
+		if err := format.write(w, fsys, dir, name); err != nil {
+			requestLogger(r).Println("Could not write the archive:", err)
+		}
+	})
+}
+
+// Write the directory's files (under the prefix) to a zip archive
+func writeZip(w io.Writer, fsys http.FileSystem, dir, prefix string) error {
+	archive := zip.NewWriter(w)
+	err := walkDirectory(fsys, dir, func(name string, info fs.FileInfo, file http.File) error {
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = path.Join(prefix, name)
+		if info.IsDir() {
+			header.Name += "/"
+			_, err = archive.CreateHeader(header)
+			return err
+		}
+		header.Method = zip.Deflate
+		entry, err := archive.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(entry, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// Write the directory's files (under the prefix) to a gzipped tarball
+func writeTarGz(w io.Writer, fsys http.FileSystem, dir, prefix string) error {
+	compressed := gzip.NewWriter(w)
+	archive := tar.NewWriter(compressed)
+	err := walkDirectory(fsys, dir, func(name string, info fs.FileInfo, file http.File) error {
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = path.Join(prefix, name)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			_, err = io.Copy(archive, file)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return compressed.Close()
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// The name to give the archive of a directory's root (e.g. `site` for `./site` or `site.zip`)
+func archiveName(dir string) string {
+	if absolute, err := filepath.Abs(dir); err == nil {
+		name := filepath.Base(absolute)
+		return name[:len(name)-len(archiveExtension(name))]
+	}
+	return "download"
+}
+
+// Call the function for every directory and regular file under the directory (with their paths
+// relative to it), opening the files for reading. Hidden files are skipped by the file system.
+func walkDirectory(fsys http.FileSystem, dir string, fn func(name string, info fs.FileInfo, file http.File) error) error {
+	file, err := fsys.Open(dir)
+	if err != nil {
+		return err
+	}
+	infos, err := file.Readdir(-1)
+	file.Close()
+	if err != nil {
+		return err
+	}
+	return walkEntries(fsys, dir, "", infos, fn)
+}
+
+// Call the function for the entries of the directory, and recursively for those of its subdirectories
+func walkEntries(fsys http.FileSystem, dir, relative string, infos []fs.FileInfo, fn func(name string, info fs.FileInfo, file http.File) error) error {
+	for _, info := range infos {
+		name := path.Join(relative, info.Name())
+		file, err := fsys.Open(path.Join(dir, name))
+		if err != nil {
+			if info.Mode()&fs.ModeSymlink != 0 {
+				continue // Skip broken symlinks
+			}
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			// Follow symlinks to files (but not to directories, which could loop)
+			if target, err := file.Stat(); err == nil && target.Mode().IsRegular() {
+				info = target
+			}
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			file.Close()
+			continue // Skip directory symlinks, sockets, devices and the like
+		}
+		if err := fn(name, info, file); err != nil {
+			file.Close()
+			return err
+		}
+		var children []fs.FileInfo
+		if info.IsDir() {
+			children, err = file.Readdir(-1)
+		}
+		file.Close()
+		if err != nil {
+			return err
+		}
+		if err := walkEntries(fsys, dir, name, children, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
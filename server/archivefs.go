@@ -0,0 +1,246 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ===================
+// ARCHIVE FILE SYSTEM
+// ===================
+
+// The file extensions of the archives that can be served in place of a directory
+var archiveExtensions = []string{".zip", ".tar.gz", ".tgz", ".tar"}
+
+// The archive extension of the file name (if it is an archive)
+func archiveExtension(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(lower, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// Load the files of a zip archive or a (gzipped) tarball into memory, to serve them without
+// extracting them to disk. Archives with a single top-level directory are served from inside it.
+func loadArchive(name string) (fs.FS, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	fsys := newArchiveFS(info.ModTime())
+	switch archiveExtension(name) {
+	case ".zip":
+		err = fsys.loadZip(name)
+	case ".tar.gz", ".tgz":
+		err = fsys.loadTar(name, true)
+	case ".tar":
+		err = fsys.loadTar(name, false)
+	default:
+		err = fmt.Errorf("unsupported archive %s (expected %s)", name, strings.Join(archiveExtensions, ", "))
+	}
+	if err != nil {
+		return nil, err
+	}
+	fsys.sortChildren()
+
+	// Serve the single top-level directory (like `site/` in `site.zip`) as the root
+	if root := fsys["."]; len(root.children) == 1 && fsys[root.children[0]].IsDir() {
+		return fs.Sub(fsys, root.children[0])
+	}
+	return fsys, nil
+}
+
+// An in-memory file system of the entries of an archive, by their (cleaned) paths
+type archiveFS map[string]*archiveEntry
+
+// Create an empty archive file system, whose root was last modified at the time
+func newArchiveFS(modified time.Time) archiveFS {
+	return archiveFS{".": {name: ".", mode: fs.ModeDir | 0o755, modified: modified}}
+}
+
+// A file or directory in an archive
+type archiveEntry struct {
+	name     string      // The name of the entry
+	data     []byte      // The contents of the file
+	mode     fs.FileMode // The mode (and permissions) of the entry
+	modified time.Time   // The last modification time of the entry
+	children []string    // The paths of the entries in the directory
+}
+
+func (e *archiveEntry) Name() string       { return e.name }
+func (e *archiveEntry) Size() int64        { return int64(len(e.data)) }
+func (e *archiveEntry) Mode() fs.FileMode  { return e.mode }
+func (e *archiveEntry) ModTime() time.Time { return e.modified }
+func (e *archiveEntry) IsDir() bool        { return e.mode.IsDir() }
+func (e *archiveEntry) Sys() any           { return nil }
+
+// Open the named file (a slash separated path, without a leading slash)
+func (fsys archiveFS) Open(name string) (fs.File, error) {
+	entry, ok := fsys[name]
+	if !ok || !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &archiveFile{archiveEntry: entry, Reader: bytes.NewReader(entry.data), fsys: fsys}, nil
+}
+
+// Add the entry at the path, along with any missing parent directories
+func (fsys archiveFS) add(name string, entry *archiveEntry) {
+	name = path.Clean(strings.TrimPrefix(name, "/"))
+	if name == "." || !fs.ValidPath(name) {
+		return // Skip the root, and entries outside of it (like `../evil`)
+	}
+	if existing, ok := fsys[name]; ok && existing.IsDir() && entry.IsDir() {
+		existing.mode, existing.modified = entry.mode, entry.modified // An implicit parent, explicitly listed
+		return
+	}
+	entry.name = path.Base(name)
+	if _, ok := fsys[name]; !ok {
+		parent := path.Dir(name)
+		if _, ok := fsys[parent]; !ok {
+			fsys.add(parent, &archiveEntry{mode: fs.ModeDir | 0o755, modified: entry.modified})
+		}
+		fsys[parent].children = append(fsys[parent].children, name)
+	}
+	fsys[name] = entry
+}
+
+// Sort the entries of the directories by name
+func (fsys archiveFS) sortChildren() {
+	for _, entry := range fsys {
+		slices.Sort(entry.children)
+	}
+}
+
+// Load the entries of the zip archive
+func (fsys archiveFS) loadZip(name string) error {
+	archive, err := zip.OpenReader(name)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	return fsys.addZip(&archive.Reader)
+}
+
+// Add the entries of the zip archive
+func (fsys archiveFS) addZip(archive *zip.Reader) error {
+	for _, file := range archive.File {
+		info := file.FileInfo()
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			continue // Skip symlinks and the like
+		}
+		entry := &archiveEntry{mode: info.Mode(), modified: info.ModTime()}
+		if !info.IsDir() {
+			var err error
+			if entry.data, err = readZipFile(file); err != nil {
+				return fmt.Errorf("%s: %w", file.Name, err)
+			}
+		}
+		fsys.add(file.Name, entry)
+	}
+	return nil
+}
+
+// Load the entries of the tarball (gzipped, if compressed)
+func (fsys archiveFS) loadTar(name string, compressed bool) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var reader io.Reader = file
+	if compressed {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	archive := tar.NewReader(reader)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		info := header.FileInfo()
+		entry := &archiveEntry{mode: info.Mode(), modified: info.ModTime()}
+		switch header.Typeflag {
+		case tar.TypeDir:
+		case tar.TypeReg:
+			if entry.data, err = io.ReadAll(archive); err != nil {
+				return fmt.Errorf("%s: %w", header.Name, err)
+			}
+		default:
+			continue // Skip links and the like
+		}
+		fsys.add(header.Name, entry)
+	}
+}
+
+// An open file (or directory) of an archive
+type archiveFile struct {
+	*archiveEntry
+	*bytes.Reader
+	fsys   archiveFS // The file system of the file (to read the directory entries from)
+	offset int       // The number of directory entries read so far
+}
+
+// The file info of the file
+func (f *archiveFile) Stat() (fs.FileInfo, error) {
+	return f.archiveEntry, nil
+}
+
+// Close the file
+func (f *archiveFile) Close() error {
+	return nil
+}
+
+// Read up to n entries of the directory (or all of the remaining ones, if n <= 0)
+func (f *archiveFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: fs.ErrInvalid}
+	}
+	remaining := f.children[f.offset:]
+	if n > 0 {
+		if len(remaining) == 0 {
+			return nil, io.EOF
+		}
+		remaining = remaining[:min(n, len(remaining))]
+	}
+	entries := make([]fs.DirEntry, 0, len(remaining))
+	for _, child := range remaining {
+		entries = append(entries, fs.FileInfoToDirEntry(f.fsys[child]))
+	}
+	f.offset += len(remaining)
+	return entries, nil
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Read the contents of the file in the zip archive
+func readZipFile(file *zip.File) ([]byte, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ==============
+// AUTHENTICATION
+// ==============
+
+// The realm presented to clients in authentication challenges
+const authRealm = "self-serve"
+
+// The cookie that remembers the token once a browser has provided it with `?token=`
+const tokenCookieName = "self-serve-token"
+
+// Middleware that requires either HTTP Basic authentication with credentials the verify function
+// accepts (if not nil), or the bearer token (if not empty), challenging clients that provide neither
+func authenticate(verify func(user, password string) bool, token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			if value, fromQuery := requestToken(r); value != "" && constantTimeEqual(value, token) {
+				if fromQuery {
+					// Remember the token, so that the page's assets (and links) are authorized too
+					http.SetCookie(w, &http.Cookie{Name: tokenCookieName, Value: token, Path: "/", HttpOnly: true, SameSite: http.SameSiteStrictMode})
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		if verify != nil {
+			if user, password, ok := r.BasicAuth(); ok && verify(user, password) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, authRealm))
+		}
+		if token != "" {
+			w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q`, authRealm))
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// The token the request provides (as an `Authorization: Bearer` header, a `?token=` query
+// parameter or the token cookie), and whether it was provided by the query parameter
+func requestToken(r *http.Request) (token string, fromQuery bool) {
+	if value, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(value), false
+	}
+	if value := r.URL.Query().Get("token"); value != "" {
+		return value, true
+	}
+	if cookie, err := r.Cookie(tokenCookieName); err == nil {
+		return cookie.Value, false
+	}
+	return "", false
+}
+
+// Generate a random token (for `--token auto`), with 128 bits of randomness
+func generateToken() string {
+	return rand.Text()
+}
+
+// Boolean indicating whether the username and password are accepted by either
+// the --auth credentials or the --htpasswd file
+func (s *Self) verifyCredentials(user, password string) bool {
+	if s.auth != nil && s.auth.verify(user, password) {
+		return true
+	}
+	return s.htpasswd != nil && s.htpasswd.verify(user, password)
+}
+
+// A username and password pair
+type credentials struct {
+	user     string
+	password string
+}
+
+// Parse an --auth value (in the form `user:password`) into credentials
+func parseCredentials(value string) (credentials, error) {
+	user, password, ok := strings.Cut(value, ":")
+	if !ok || user == "" || password == "" {
+		return credentials{}, fmt.Errorf("invalid credentials (expected user:password)")
+	}
+	return credentials{user, password}, nil
+}
+
+// Boolean indicating whether the username and password match the credentials
+// (compared in constant time, so that the comparison does not leak them)
+func (c credentials) verify(user, password string) bool {
+	userMatches := constantTimeEqual(user, c.user)
+	passwordMatches := constantTimeEqual(password, c.password)
+	return userMatches && passwordMatches
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Compare the strings in constant time (comparing their hashes, so that their lengths do not leak either)
+func constantTimeEqual(a, b string) bool {
+	hashA, hashB := sha256.Sum256([]byte(a)), sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(hashA[:], hashB[:]) == 1
+}
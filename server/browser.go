@@ -0,0 +1,57 @@
+package server
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// =======
+// BROWSER
+// =======
+
+// Open the URL in the default browser, without waiting for it to close
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait() // Reap the process once it exits
+	return nil
+}
+
+// A flag whose value is optional: a path (like `--open=/docs/`), or nothing (like `--open`) for the root
+type openFlag struct {
+	path string // The path to open (empty to not open anything)
+}
+
+// The string representation of the path
+func (o *openFlag) String() string {
+	return o.path
+}
+
+// Set the path to open (with `true` meaning the root, as the flag was given without a value)
+func (o *openFlag) Set(value string) error {
+	switch value {
+	case "true":
+		o.path = "/"
+	case "false":
+		o.path = ""
+	default:
+		o.path = "/" + strings.TrimPrefix(value, "/")
+	}
+	return nil
+}
+
+// Allow the flag to be given without a value
+func (o *openFlag) IsBoolFlag() bool {
+	return true
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// =======
+// CACHING
+// =======
+
+// Middleware that sets an ETag (derived from the file's size and modification time)
+// on responses for files, so that conditional requests with If-None-Match get a 304
+func etags(fsys http.FileSystem, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			if info, err := stat(fsys, r.URL.Path); err == nil && !info.IsDir() {
+				w.Header().Set("ETag", etag(info))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Generate an ETag from the file's size and modification time
+func etag(info fs.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+// -------------
+// CACHE CONTROL
+// -------------
+
+// The Cache-Control policy to apply to responses
+type cachePolicy struct {
+	value string            // The default Cache-Control value (empty to not set one)
+	byExt map[string]string // Per-extension overrides (e.g. ".html" => "no-cache")
+}
+
+// Parse the --cache-control values (either a Cache-Control value, or an `.ext=value` override)
+// and the --cache shorthand (max-age seconds) into a cache policy
+func parseCachePolicy(values []string, maxAge int) (cachePolicy, error) {
+	policy := cachePolicy{byExt: map[string]string{}}
+	if maxAge > 0 {
+		policy.value = fmt.Sprintf("public, max-age=%d", maxAge)
+	}
+	for _, value := range values {
+		if !strings.HasPrefix(value, ".") {
+			policy.value = value
+			continue
+		}
+		exts, override, ok := strings.Cut(value, "=")
+		if !ok {
+			return policy, fmt.Errorf("invalid cache-control override %q (expected .ext=value)", value)
+		}
+		for _, ext := range strings.Split(exts, ",") {
+			policy.byExt[strings.ToLower(strings.TrimSpace(ext))] = strings.TrimSpace(override)
+		}
+	}
+	return policy, nil
+}
+
+// Boolean indicating whether the policy sets any Cache-Control headers
+func (p cachePolicy) IsEmpty() bool {
+	return p.value == "" && len(p.byExt) == 0
+}
+
+// Middleware that sets the Cache-Control header on responses according to the policy
+func cacheControl(policy cachePolicy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value, ok := policy.byExt[strings.ToLower(path.Ext(r.URL.Path))]
+		if !ok {
+			value = policy.value
+		}
+		if value != "" {
+			w.Header().Set("Cache-Control", value)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// --------
+// NO CACHE
+// --------
+
+// Middleware that prevents browsers from caching responses, so that they always fetch
+// fresh files. Conditional request headers are dropped so that no 304s are sent.
+func noCache(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, header := range []string{"If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range"} {
+			r.Header.Del(header)
+		}
+		h := w.Header()
+		h.Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
+		h.Set("Pragma", "no-cache")
+		h.Set("Expires", "0")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Stat the named file in the file system
+func stat(fsys http.FileSystem, name string) (fs.FileInfo, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return file.Stat()
+}
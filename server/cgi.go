@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net/http"
+	"net/http/cgi"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ===
+// CGI
+// ===
+
+// Middleware that executes the CGI scripts in the directory, which are mounted at the URL
+// prefix (e.g. `/cgi-bin/hello.sh/extra?q=1` runs `hello.sh` with a PATH_INFO of `/extra`)
+func cgiScripts(prefix, dir string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.Path, prefix+"/")
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		name, _, _ := strings.Cut(rest, "/")
+		if name == "" || strings.HasPrefix(name, ".") {
+			http.NotFound(w, r)
+			return
+		}
+
+		script := filepath.Join(dir, name)
+		info, err := os.Stat(script)
+		if err != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+		if !isExecutable(info) {
+			http.Error(w, "Forbidden", http.StatusForbidden) // Never serve the source of the scripts
+			return
+		}
+
+		handler := &cgi.Handler{
+			Path:   script,
+			Root:   path.Join(prefix, name),
+			Dir:    dir,
+			Logger: requestLogger(r),
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// The URL prefix to mount the CGI directory at (e.g. `/cgi-bin` for `./cgi-bin`)
+func cgiPrefix(dir string) string {
+	return "/" + filepath.Base(filepath.Clean(dir))
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Boolean indicating whether the file can be executed (Windows has no executable bit)
+func isExecutable(info os.FileInfo) bool {
+	return runtime.GOOS == "windows" || info.Mode()&0o111 != 0
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ===============
+// ERROR INJECTION
+// ===============
+
+// The most time to stall a request for, before dropping its connection (so that restarts do not hang on it)
+const chaosStallTimeout = time.Minute
+
+// The prefix of the server's own endpoints (like the live reload events and /__status), which are spared the failures
+const internalPathPrefix = "/__"
+
+// A failure to inject into a percentage of the requests
+type chaosRule struct {
+	percent float64 // The percentage of the requests to fail
+	status  int     // The status code to respond with (0 for one of the actions)
+	action  string  // The failure to inject instead: drop, truncate or stall
+}
+
+// The failures to inject instead of a status code
+var chaosActions = []string{"drop", "truncate", "stall"}
+
+// Parse the failures to inject, like "5%=500,2%=drop", where each is either a status code
+// or one of the chaos actions
+func parseChaos(value string) ([]chaosRule, error) {
+	var rules []chaosRule
+	var total float64
+	for entry := range strings.SplitSeq(value, ",") {
+		percent, failure, found := strings.Cut(strings.TrimSpace(entry), "=")
+		p, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(percent), "%"), 64)
+		if !found || err != nil || p <= 0 {
+			return nil, fmt.Errorf("invalid chaos rule %q (expected a percentage and a failure, like 5%%=500 or 2%%=drop)", entry)
+		}
+		rule := chaosRule{percent: p}
+		failure = strings.TrimSpace(failure)
+		if status, err := strconv.Atoi(failure); err == nil {
+			if status < 100 || status > 999 {
+				return nil, fmt.Errorf("invalid status code in the chaos rule %q", entry)
+			}
+			rule.status = status
+		} else if slices.Contains(chaosActions, failure) {
+			rule.action = failure
+		} else {
+			return nil, fmt.Errorf("invalid failure in the chaos rule %q (expected a status code, or one of %s)", entry, strings.Join(chaosActions, ", "))
+		}
+		if total += p; total > 100 {
+			return nil, fmt.Errorf("the chaos rules %q add up to more than 100%%", value)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Middleware that fails a random percentage of the requests, as configured by the rules:
+// responding with an error status, dropping the connection, truncating the response or stalling it.
+// The server's own endpoints are spared, so that live reload and the inspector keep working.
+func injectChaos(rules []chaosRule, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rule, ok := pickChaosRule(rules, rand.Float64()*100)
+		if !ok || strings.HasPrefix(r.URL.Path, internalPathPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		switch rule.action {
+		case "":
+			logDetail(r, "Chaos: responded with %d", rule.status)
+			http.Error(w, http.StatusText(rule.status), rule.status)
+		case "drop":
+			panic(http.ErrAbortHandler) // Closes the connection without a response (or a log line)
+		case "truncate":
+			tw := &truncatingWriter{ResponseWriter: w, limit: -1}
+			next.ServeHTTP(tw, r)
+			if tw.truncated {
+				http.NewResponseController(w).Flush()
+				panic(http.ErrAbortHandler) // Closes the connection before the rest of the body
+			}
+		case "stall":
+			logDetail(r, "Chaos: stalled the response")
+			timer := time.NewTimer(chaosStallTimeout)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+				panic(http.ErrAbortHandler)
+			case <-r.Context().Done():
+			}
+		}
+	})
+}
+
+// A ResponseWriter that stops writing the body halfway through (by its Content-Length, or its first write)
+type truncatingWriter struct {
+	http.ResponseWriter
+	limit     int64 // The number of bytes of the body left to write (-1 until the body starts)
+	truncated bool  // Whether any of the body was left out
+}
+
+// Write the body, up to the limit
+func (tw *truncatingWriter) Write(b []byte) (int, error) {
+	if tw.limit < 0 {
+		if length, err := strconv.ParseInt(tw.Header().Get("Content-Length"), 10, 64); err == nil {
+			tw.limit = length / 2
+		} else {
+			tw.limit = int64(len(b)) / 2
+		}
+	}
+	if int64(len(b)) > tw.limit {
+		tw.truncated = true
+		n, err := tw.ResponseWriter.Write(b[:tw.limit])
+		tw.limit -= int64(n)
+		if err != nil {
+			return n, err
+		}
+		return len(b), nil // Pretend it was all written, so that the handler carries on
+	}
+	n, err := tw.ResponseWriter.Write(b)
+	tw.limit -= int64(n)
+	return n, err
+}
+
+// Unwrap the underlying ResponseWriter (for http.ResponseController)
+func (tw *truncatingWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// The rule the roll (from 0 to 100) falls within, if any, with the rules' percentages stacked one after another
+func pickChaosRule(rules []chaosRule, roll float64) (chaosRule, bool) {
+	for _, rule := range rules {
+		if roll < rule.percent {
+			return rule, true
+		}
+		roll -= rule.percent
+	}
+	return chaosRule{}, false
+}
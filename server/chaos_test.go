@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestParseChaos(t *testing.T) {
+	tests := []struct {
+		value string
+		rules []chaosRule
+		err   bool
+	}{
+		{value: "5%=500", rules: []chaosRule{{percent: 5, status: 500}}},
+		{value: "5%=500,2%=drop", rules: []chaosRule{{percent: 5, status: 500}, {percent: 2, action: "drop"}}},
+		{value: " 10% = 503 , 1.5=stall", rules: []chaosRule{{percent: 10, status: 503}, {percent: 1.5, action: "stall"}}},
+		{value: "100%=truncate", rules: []chaosRule{{percent: 100, action: "truncate"}}},
+		{value: "", err: true},
+		{value: "5%", err: true},
+		{value: "0%=500", err: true},
+		{value: "-1%=500", err: true},
+		{value: "x%=500", err: true},
+		{value: "5%=99", err: true},
+		{value: "5%=1000", err: true},
+		{value: "5%=explode", err: true},
+		{value: "60%=500,50%=drop", err: true},
+	}
+	for _, tt := range tests {
+		rules, err := parseChaos(tt.value)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseChaos(%q) = %v, want an error", tt.value, rules)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseChaos(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if !slices.Equal(rules, tt.rules) {
+			t.Errorf("parseChaos(%q) = %v, want %v", tt.value, rules, tt.rules)
+		}
+	}
+}
+
+func TestInjectChaosSparesInternalPaths(t *testing.T) {
+	rules := []chaosRule{{percent: 100, status: http.StatusServiceUnavailable}}
+	handler := injectChaos(rules, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{path: "/index.html", status: http.StatusServiceUnavailable},
+		{path: "/", status: http.StatusServiceUnavailable},
+		{path: "/__events", status: http.StatusOK},
+		{path: "/__status", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.status {
+			t.Errorf("GET %s = %d, want %d", tt.path, rec.Code, tt.status)
+		}
+	}
+}
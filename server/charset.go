@@ -0,0 +1,200 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// ========
+// CHARSETS
+// ========
+
+// The charset value that detects the charset of each response from its body
+const detectCharsetValue = "auto"
+
+// How much of the body to look for a charset declaration in (as browsers do, for HTML)
+const charsetSniffLength = 1024
+
+// The charset declarations in HTML (`<meta charset="...">`, or the `http-equiv` Content-Type) and XML documents
+var (
+	htmlCharsetPattern = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?\s*([\w.:-]+)`)
+	xmlCharsetPattern  = regexp.MustCompile(`^<\?xml[^>]+encoding\s*=\s*["']([\w.:-]+)["']`)
+)
+
+// The charsets to declare on the text responses
+type charsetPolicy struct {
+	value string            // The charset to declare on the text responses without one (empty to not declare any, or auto)
+	byExt map[string]string // Per-extension charsets (e.g. ".html" => "shift_jis"), in place of the declared ones
+}
+
+// Parse the --charset values (either a charset, or an `.ext=charset` override) into a charset policy
+func parseCharsetPolicy(values []string) (charsetPolicy, error) {
+	policy := charsetPolicy{byExt: map[string]string{}}
+	for _, value := range values {
+		if !strings.HasPrefix(value, ".") {
+			policy.value = strings.ToLower(strings.TrimSpace(value))
+			continue
+		}
+		exts, charset, ok := strings.Cut(value, "=")
+		if !ok || strings.TrimSpace(charset) == "" {
+			return policy, fmt.Errorf("invalid charset override %q (expected .ext=charset)", value)
+		}
+		for _, ext := range strings.Split(exts, ",") {
+			policy.byExt[strings.ToLower(strings.TrimSpace(ext))] = strings.ToLower(strings.TrimSpace(charset))
+		}
+	}
+	return policy, nil
+}
+
+// Boolean indicating whether the policy declares any charsets
+func (p charsetPolicy) IsEmpty() bool {
+	return p.value == "" && len(p.byExt) == 0
+}
+
+// Middleware that declares the charsets of the text responses according to the policy: the default
+// charset is added to the Content-Types without one, while the per-extension charsets replace the
+// declared ones (like the utf-8 that Go declares for all HTML files). With auto, the charset is
+// detected from the body (its byte order mark, its declaration, or as utf-8 if it is valid), or left
+// for the browser to detect when it cannot be.
+func declareCharset(policy charsetPolicy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		charset, override := policy.byExt[strings.ToLower(path.Ext(r.URL.Path))]
+		if !override {
+			charset = policy.value
+		}
+		if charset == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &charsetWriter{ResponseWriter: w, charset: charset, override: override || charset == detectCharsetValue}
+		defer cw.finish()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// --------------
+// CHARSET WRITER
+// --------------
+
+// A ResponseWriter that declares the charset in the Content-Type of a text response. To detect the
+// charset, the header is held back until the start of the body is written.
+type charsetWriter struct {
+	http.ResponseWriter
+	charset  string // The charset to declare (or auto to detect it)
+	override bool   // Whether to replace a declared charset
+	status   int    // The status code held back until the body is written (0 if none is held back)
+	wrote    bool   // Whether the header has been written
+}
+
+// Declare the charset and write the header, or hold it back to detect the charset from the body
+func (cw *charsetWriter) WriteHeader(status int) {
+	if cw.wrote || status < 200 { // Informational statuses (like 103 Early Hints) come before the final one
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if cw.charset == detectCharsetValue && status == http.StatusOK && cw.Header().Get("Content-Encoding") == "" {
+		cw.status = status // Detect the charset from the start of the body
+		return
+	}
+	cw.writeHeader(status, nil)
+}
+
+// Write the body (after the header, declaring the charset detected from the start of the body)
+func (cw *charsetWriter) Write(b []byte) (int, error) {
+	if !cw.wrote && cw.status == 0 {
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.wrote {
+		cw.writeHeader(cw.status, b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Write the header held back, if the response had no body
+func (cw *charsetWriter) finish() {
+	if !cw.wrote && cw.status != 0 {
+		cw.writeHeader(cw.status, nil)
+	}
+}
+
+// Declare the charset in the Content-Type (if it is a text one), and write the header. Without the start
+// of the body (like for HEAD and range requests), a declared charset is left as is rather than detected.
+func (cw *charsetWriter) writeHeader(status int, body []byte) {
+	cw.wrote = true
+	h := cw.Header()
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	detect := cw.charset == detectCharsetValue
+	if err == nil && strings.HasPrefix(mediaType, "text/") && (params["charset"] == "" || cw.override) && (!detect || len(body) > 0) {
+		charset := cw.charset
+		if detect {
+			charset = detectCharset(mediaType, body)
+		}
+		if charset != "" {
+			params["charset"] = charset
+		} else {
+			delete(params, "charset") // Let the browser detect it, rather than misdeclaring it
+		}
+		h.Set("Content-Type", mime.FormatMediaType(mediaType, params))
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+// Flush the data written so far to the client
+func (cw *charsetWriter) Flush() {
+	if !cw.wrote && cw.status != 0 {
+		cw.writeHeader(cw.status, nil)
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap the underlying ResponseWriter (for http.ResponseController)
+func (cw *charsetWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Detect the charset of the body from its start: its byte order mark, its declaration (in HTML and XML),
+// or utf-8 if it is valid UTF-8. Returns an empty string if it cannot be told.
+func detectCharset(mediaType string, body []byte) string {
+	switch {
+	case bytes.HasPrefix(body, []byte{0xEF, 0xBB, 0xBF}):
+		return "utf-8"
+	case bytes.HasPrefix(body, []byte{0xFF, 0xFE}):
+		return "utf-16le"
+	case bytes.HasPrefix(body, []byte{0xFE, 0xFF}):
+		return "utf-16be"
+	}
+
+	sniffed := body[:min(len(body), charsetSniffLength)]
+	if mediaType == "text/html" {
+		if match := htmlCharsetPattern.FindSubmatch(sniffed); match != nil {
+			return strings.ToLower(string(match[1]))
+		}
+	} else if mediaType == "text/xml" {
+		if match := xmlCharsetPattern.FindSubmatch(sniffed); match != nil {
+			return strings.ToLower(string(match[1]))
+		}
+	}
+
+	// The start of the body may end in the middle of a character
+	for cut := 0; cut <= utf8.UTFMax-1 && cut < len(body); cut++ {
+		if utf8.Valid(body[:len(body)-cut]) && (cut == 0 || !utf8.FullRune(body[len(body)-cut:])) {
+			return "utf-8"
+		}
+	}
+	return ""
+}
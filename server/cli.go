@@ -0,0 +1,666 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ===
+// CLI
+// ===
+
+const (
+	// The default host to use
+	DEFAULT_HOST = "localhost"
+	// The default port to use
+	DEFAULT_PORT = 5327
+)
+
+// The version number of the application
+const VERSION = "0.1.0"
+
+// Run the command-line interface with the arguments (without the program name): the subcommand,
+// if one is given, or else serve the files as configured by the flags
+func Run(args []string) {
+	if len(args) > 0 {
+		if cmd, ok := findCommand(args[0]); ok {
+			cmd.run(args[1:])
+			return
+		}
+	}
+	runServe(args)
+}
+
+// Serve the files, as configured by the flags
+func runServe(args []string) {
+	// Get current working directory
+	cwd, err := os.Getwd()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	// Get the default host and port configuration from environment variables
+	defaultHost, defaultPort := getDefaultConfiguration()
+
+	// Parse the command line arguments
+	dir := flag.String("dir", cwd, "The directory to serve (or a zip or tar archive, or a single file)")
+	envFile := flag.String("env-file", defaultEnvFile, "The env file to load the environment variables (like PORT and HOST) from, if it exists")
+	profile := flag.String("profile", "", "The profile of the config file to apply (like lan), over its top-level settings")
+	config := flag.String("config", "", "The config file to load the settings from (instead of the selfserve.yaml, .toml or .json in the served directory)")
+	var vhosts listFlag
+	flag.Var(&vhosts, "vhost", "Serve another directory for requests to a host, like docs.local=./docs (repeatable)")
+	var mounts listFlag
+	flag.Var(&mounts, "mount", "Serve another directory under a URL prefix, like /docs=./docs (repeatable)")
+	stdin := flag.Bool("stdin", false, "Serve the content piped into stdin at / (e.g. cat report.html | self-serve --stdin)")
+	contentType := flag.String("type", "", "The Content-Type to serve a single file or --stdin with, like text/html (detected by default)")
+	download := flag.Bool("download", false, "Serve a single file (or --stdin) as an attachment, so that browsers download it")
+	port := flag.Int("port", defaultPort, "The port number to use")
+	host := flag.String("host", defaultHost, "The host to use")
+	portRetry := flag.Int("port-retry", 0, "The number of next ports to try when the port is already in use")
+	tunnel := flag.String("tunnel", "", "Expose the server at a public URL through cloudflared, or an ssh reverse tunnel with ssh:[user@]host")
+	var open openFlag
+	flag.Var(&open, "open", "Open the browser once the server is ready (at a path with --open=/docs/)")
+	qr := flag.Bool("qr", false, "Print a QR code of the address, to open the site on a phone by scanning it")
+	mdns := flag.String("mdns", "", "Advertise the server on the local network over mDNS under the name, like myproject for myproject.local")
+	ipv4Only := flag.Bool("ipv4-only", false, "Only listen over IPv4")
+	ipv6Only := flag.Bool("ipv6-only", false, "Only listen over IPv6")
+	unix := flag.String("unix", "", "Listen on a Unix domain socket at the path, instead of the host and port")
+	cert := flag.String("cert", "", "The TLS certificate file to serve HTTPS with")
+	key := flag.String("key", "", "The TLS private key file to serve HTTPS with")
+	selfSigned := flag.Bool("tls", false, "Serve HTTPS with an auto-generated self-signed certificate")
+	acme := flag.Bool("acme", false, "Serve HTTPS with certificates obtained automatically from Let's Encrypt")
+	domain := flag.String("domain", "", "The comma separated domain names to obtain ACME certificates for")
+	acmeCache := flag.String("acme-cache", "", "The directory to cache ACME certificates in")
+	h2c := flag.Bool("h2c", false, "Serve HTTP/2 over cleartext (h2c)")
+	useHTTP3 := flag.Bool("http3", false, "Experimental: Also serve HTTP/3 over QUIC (requires HTTPS)")
+	compression := flag.Bool("compress", true, "Compress responses when the client accepts it")
+	etag := flag.Bool("etag", true, "Generate ETags and respond to conditional requests with 304 Not Modified")
+	precompressed := flag.Bool("precompressed", true, "Serve precompressed .br, .zst and .gz sidecar files when the client accepts them")
+	var charsets listFlag
+	flag.Var(&charsets, "charset", "The charset to declare on the text responses without one (like utf-8, or auto to detect it), or a per-extension one like .html=shift_jis (repeatable)")
+	cache := flag.Int("cache", 0, "Set Cache-Control: public, max-age=<seconds> on all responses")
+	var cacheControl listFlag
+	flag.Var(&cacheControl, "cache-control", "The Cache-Control header to set on responses, or a per-extension override like .html=no-cache (repeatable)")
+	noCache := flag.Bool("no-cache", false, "Prevent browsers from caching responses (overrides --cache, --cache-control and --etag)")
+	var headers listFlag
+	flag.Var(&headers, "header", "A custom response header like \"X-Foo: bar\", or path-scoped like \"/fonts/*:Access-Control-Allow-Origin=*\" (repeatable)")
+	index := flag.String("index", defaultIndex, "The comma separated filenames to serve as directory indexes, in order of preference")
+	noListing := flag.Bool("no-listing", false, "Do not list the contents of directories without an index file")
+	hideDotfiles := flag.Bool("hide-dotfiles", true, "Hide dotfiles (like .git and .env) from listings and refuse to serve them")
+	var exclude listFlag
+	flag.Var(&exclude, "exclude", "A glob pattern (like node_modules or *.map) of files to hide and refuse to serve (repeatable)")
+	spa := flag.Bool("spa", false, "Single-page app mode: serve the root index.html for paths that do not match a file")
+	cleanURLs := flag.Bool("clean-urls", false, "Serve about.html at /about, and redirect /about.html to /about")
+	notFound := flag.String("not-found", "404.html", "The page to serve (with a 404 status) for missing files, relative to the served directory")
+	var errorPages listFlag
+	flag.Var(&errorPages, "error", "A custom error page like 500=errors/500.html, relative to the served directory (repeatable)")
+	write := flag.Bool("write", false, "Create and overwrite files with PUT, directories with MKCOL, and remove them with DELETE")
+	var proxy listFlag
+	flag.Var(&proxy, "proxy", "Forward requests under a path prefix to a backend, like /api=http://localhost:3000 (repeatable)")
+	mock := flag.String("mock", "", "A directory of JSON files to serve as a mock REST API (e.g. users.json at /users)")
+	cgiDir := flag.String("cgi", "", "A directory of CGI scripts to execute, mounted at its name (e.g. ./cgi-bin at /cgi-bin)")
+	var fastCGIRoutes listFlag
+	flag.Var(&fastCGIRoutes, "fastcgi", "Hand .php scripts under a path prefix off to a FastCGI responder, like /app=127.0.0.1:9000 (repeatable)")
+	var execs listFlag
+	flag.Var(&execs, "exec", "Respond to a path with the output of a command, like \"/build-info=./scripts/build-info.sh\" (repeatable)")
+	renderMarkdown := flag.Bool("render-markdown", false, "Render markdown files as styled HTML (the raw markdown is served with ?raw)")
+	templates := flag.Bool("templates", false, "Execute .tmpl and .gohtml files as Go html/templates with access to the request")
+	layouts := flag.Bool("layouts", false, "Strip the YAML frontmatter from HTML files, and wrap them in the layout it names from _layouts/")
+	liveReload := flag.Bool("live-reload", false, "Reload pages in the browser when files change")
+	watchDebounce := flag.Duration("watch-debounce", defaultWatchDebounce, "How long to wait for file changes to settle before reloading")
+	var watchIgnore listFlag
+	flag.Var(&watchIgnore, "watch-ignore", "A glob pattern (like dist/** or *.tmp) of files whose changes do not trigger a reload (repeatable)")
+	watchPoll := flag.Bool("watch-poll", false, "Poll for file changes instead of relying on file system notifications (e.g. for network file systems)")
+	auth := flag.String("auth", "", "Require HTTP Basic authentication with the credentials, like user:password")
+	htpasswdFile := flag.String("htpasswd", "", "Require HTTP Basic authentication with the users in an htpasswd file (bcrypt, MD5-crypt or SHA-1)")
+	token := flag.String("token", "", "Require a bearer token (as an Authorization header or a ?token= query parameter), or auto to generate one")
+	var allow, deny listFlag
+	flag.Var(&allow, "allow", "A CIDR range (like 192.168.1.0/24) or address to allow access from, taking precedence over --deny (repeatable)")
+	flag.Var(&deny, "deny", "A CIDR range (like 0.0.0.0/0) or address to deny access from (repeatable)")
+	rateValue := flag.String("rate", "", "Limit the rate of requests, like 100/s, 30/m or 1000/h (responding with 429 beyond it)")
+	burst := flag.Int("burst", 0, "The number of requests allowed at once when rate limiting (defaults to the --rate count)")
+	ratePerIP := flag.Bool("rate-per-ip", false, "Apply the --rate limit to each client IP address separately")
+	maxInflight := flag.Int("max-inflight", 0, "The maximum number of requests to serve at once (further ones queue up, with 503s once --max-queue are waiting)")
+	maxQueue := flag.Int("max-queue", 100, "The number of requests that can wait for their turn beyond --max-inflight")
+	maxConns := flag.Int("max-conns", 0, "The maximum number of concurrent connections (further ones wait until others close)")
+	memoryCacheSize := flag.String("memory-cache", "", "Keep the contents of the hot files (and their compressed variants) in memory, up to the size, like 256MB")
+	mmapSize := flag.String("mmap", "", "Serve the files of at least the size from memory maps, like 64MB (for large files and range requests into them)")
+	maxHeaderBytes := flag.String("max-header-bytes", "", "The maximum size of the request headers, like 64KB (responding with 431 beyond it, 1MB by default)")
+	maxBodySize := flag.String("max-body-size", "", "The maximum size of the request bodies, like 100MB for uploads (responding with 413 beyond it)")
+	readTimeout := flag.Duration("read-timeout", defaultTimeouts.read, "How long to allow for reading a request, including its body (0 for no limit, for large uploads)")
+	readHeaderTimeout := flag.Duration("read-header-timeout", defaultTimeouts.readHeader, "How long to allow for reading the headers of a request (against slow clients holding connections open)")
+	writeTimeout := flag.Duration("write-timeout", defaultTimeouts.write, "How long to allow for writing a response (0 for no limit, for large downloads)")
+	idleTimeout := flag.Duration("idle-timeout", defaultTimeouts.idle, "How long to keep idle keep-alive connections open")
+	shutdownTimeout := flag.Duration("shutdown-timeout", defaultShutdownWait, "How long to wait for the in-flight requests to finish on shutdown, before closing their connections (0 to wait indefinitely)")
+	chaos := flag.String("chaos", "", "Fail a percentage of the requests with a status code or drop, truncate or stall, like \"5%=500,2%=drop\"")
+	throttle := flag.String("throttle", "", "Throttle the bandwidth of each connection to simulate a constrained link, like 512kbps or 1MB/s")
+	delayValue := flag.String("delay", "", "Delay the responses to simulate a slow network, like 300ms (or 200ms±100ms with a jitter)")
+	logFile := flag.String("log-file", "", "Log the requests to the file as well as the console (like access.log)")
+	logMaxSize := flag.String("log-max-size", "", "Rotate the --log-file once it grows beyond the size, like 10MB")
+	logRotate := flag.Duration("log-rotate", 0, "Rotate the --log-file at the interval, like 24h")
+	logKeep := flag.Int("log-keep", 0, "The number of rotated log files to keep (0 to keep them all)")
+	noConsoleLog := flag.Bool("no-console-log", false, "Only log the requests to the --log-file, and not the console")
+	quiet := flag.Bool("quiet", false, "Do not log the requests (only the startup, the shutdown and errors)")
+	verbose := flag.Bool("verbose", false, "Log the request headers and how the requests are resolved to files as well")
+	logFormat := flag.String("log-format", "", "The format to log requests in: common or combined (for log analyzers like GoAccess)")
+	metricsEnabled := flag.Bool("metrics", false, "Expose Prometheus metrics of the requests at --metrics-path")
+	metricsPath := flag.String("metrics-path", defaultMetricsPath, "The path to expose the --metrics at")
+	health := flag.Bool("health", false, "Respond to health checks at /__health with JSON, bypassing authentication (for liveness probes)")
+	status := flag.Bool("status", false, "Report the configuration, uptime and request statistics of the server at /__status")
+	har := flag.String("har", "", "Record the requests and responses to an HTTP Archive file (like session.har) on shutdown")
+	inspect := flag.Bool("inspect", false, "Inspect the recent requests and responses live at /__inspect")
+	noColor := flag.Bool("no-color", false, "Do not color the output (also with the NO_COLOR environment variable, and when not output to a terminal)")
+	tui := flag.Bool("tui", false, "Show a live dashboard of the requests, clients and watch events in the terminal, in place of the logs")
+	version := flag.Bool("version", false, "Print the version number")
+	if onlyDefineFlags {
+		return // For the completion scripts
+	}
+	flag.Usage = printUsage
+	flag.CommandLine.Parse(args)
+
+	// Accept the directory as a positional argument (with the flags after it as well), like `self-serve ./dist`
+	if flag.NArg() > 0 {
+		if isFlagSet("dir") {
+			log.Fatalln("The directory to serve can be given either with --dir or as an argument, not both")
+		}
+		flag.Set("dir", flag.Arg(0))
+		flag.CommandLine.Parse(flag.Args()[1:])
+		if flag.NArg() > 0 {
+			log.Fatalf("Unexpected argument %q (only one directory can be served, with --mount for more)\n", flag.Arg(0))
+		}
+	}
+
+	// if --version is set, print the version number and exit (before loading the env and config files,
+	// which could fail)
+	if *version {
+		fmt.Println(VERSION)
+		return
+	}
+
+	// Load the environment variables of the env file (before the config file and the flags, which take
+	// precedence), and read the host and port from them again
+	if err := loadEnvFile(*envFile); err != nil && (isFlagSet("env-file") || !errors.Is(err, fs.ErrNotExist)) {
+		log.Fatalf("Could not load the env file: %v\n", err)
+	}
+	defaultHost, defaultPort = getDefaultConfiguration()
+	if !isFlagSet("host") {
+		*host = defaultHost
+	}
+	if !isFlagSet("port") {
+		*port = defaultPort
+	}
+
+	// Apply the settings of the config file (given with --config, or found in the served directory), if any
+	configFile := *config
+	if configFile == "" {
+		configFile = findConfigFile(*dir)
+	}
+	var configRedirects []redirectRule
+	configPath := "" // The path of the config file in the served directory, if it is in there
+	if configFile == "" && *profile != "" {
+		log.Fatalln("--profile requires a config file (a selfserve.yaml in the served directory, or --config)")
+	}
+	if configFile != "" {
+		settings, err := loadConfigFile(configFile)
+		if err != nil {
+			log.Fatalf("Could not load the config file: %v\n", err)
+		}
+		if settings, err = selectProfile(settings, *profile); err != nil {
+			log.Fatalf("Could not apply the config file: %v\n", err)
+		}
+		if configRedirects, err = applyConfig(settings); err != nil {
+			log.Fatalf("Could not apply the config file: %v\n", err)
+		}
+		// Do not serve the config file (which may have credentials), if it is in the served directory
+		absDir, _ := filepath.Abs(*dir)
+		absConfig, _ := filepath.Abs(configFile)
+		if rel, err := filepath.Rel(absDir, absConfig); err == nil && !strings.HasPrefix(rel, "..") {
+			configPath = "/" + filepath.ToSlash(rel)
+		}
+	}
+
+	// Color the output on terminals, unless disabled
+	setupColor(*noColor)
+
+	// Both the certificate and the key are required to serve HTTPS
+	if (*cert == "") != (*key == "") {
+		log.Fatalln("Both --cert and --key must be provided to serve HTTPS")
+	}
+
+	// Instantiate the Self Serve
+	Self := NewSelf(strings.Trim(*host, "[]"), *dir, *port) // Accept bracketed IPv6 hosts, like [::1]
+	Self.cert, Self.key = *cert, *key
+	if info, err := os.Stat(*dir); err == nil && !info.IsDir() && archiveExtension(*dir) != "" {
+		if Self.archive, err = loadArchive(*dir); err != nil {
+			log.Fatalf("Could not load the archive: %v\n", err)
+		}
+	} else if *stdin {
+		content, err := readStdin()
+		if err != nil {
+			log.Fatalf("Could not read stdin: %v\n", err)
+		}
+		Self.dir, Self.stdin, Self.singleFile = "stdin", &content, true
+	} else if isSingleFile(*dir) {
+		Self.singleFile = true
+	} else if !isFlagSet("dir") {
+		// Serve the site embedded in the binary (by `self-serve embed`), if any
+		if Self.archive, err = loadEmbeddedSite(); err != nil {
+			log.Fatalln(err)
+		}
+		if Self.archive != nil {
+			Self.dir, _ = os.Executable()
+		}
+	}
+	Self.contentType, Self.download = *contentType, *download
+	Self.redirects = configRedirects
+	if Self.mounts, err = parseMounts(mounts); err != nil {
+		log.Fatalln(err)
+	}
+	for _, value := range vhosts {
+		vhost, err := parseVirtualHost(value)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		Self.vhosts = append(Self.vhosts, vhost)
+	}
+	if (Self.archive != nil || Self.singleFile) && (*write || *liveReload || len(fastCGIRoutes) > 0) {
+		log.Fatalln("--write, --live-reload and --fastcgi need a directory, and cannot be used with an archive or a single file")
+	}
+	Self.h2c = *h2c
+	Self.http3 = *useHTTP3
+	Self.compress = *compression
+	Self.precompressed = *precompressed
+	Self.etag = *etag
+	if Self.cache, err = parseCachePolicy(cacheControl, *cache); err != nil {
+		log.Fatalln(err)
+	}
+	Self.noCache = *noCache
+	if Self.charset, err = parseCharsetPolicy(charsets); err != nil {
+		log.Fatalln(err)
+	}
+	Self.spa = *spa
+	Self.markdown = *renderMarkdown
+	Self.templates = *templates
+	Self.layouts = *layouts
+	Self.liveReload = *liveReload
+	Self.cleanURLs = *cleanURLs
+	Self.indexes = parseIndexNames(*index)
+	Self.listing = !*noListing
+	Self.hideDotfiles = *hideDotfiles
+	if len(exclude) > 0 {
+		if Self.exclude, err = globPatterns(exclude); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if configPath != "" {
+		Self.exclude = excludePath(Self.exclude, configPath)
+	}
+	Self.watchDebounce = *watchDebounce
+	Self.watchPoll = *watchPoll
+	if len(watchIgnore) > 0 {
+		if Self.watchIgnore, err = globPatterns(watchIgnore); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	Self.write = *write
+	if Self.pages, err = parseErrorPages(errorPages, *notFound); err != nil {
+		log.Fatalln(err)
+	}
+	if Self.headers, err = parseHeaderRules(headers); err != nil {
+		log.Fatalln(err)
+	}
+	if Self.proxies, err = parseProxyRoutes(proxy); err != nil {
+		log.Fatalln(err)
+	}
+	if *cgiDir != "" {
+		if Self.cgi, err = filepath.Abs(*cgiDir); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	for _, value := range fastCGIRoutes {
+		route, err := parseFastCGIRoute(value)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		Self.fastCGI = append(Self.fastCGI, route)
+	}
+	for _, value := range execs {
+		route, err := parseExecRoute(value)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		Self.exec = append(Self.exec, route)
+	}
+	if *auth != "" {
+		credentials, err := parseCredentials(*auth)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		Self.auth = &credentials
+	}
+	if *htpasswdFile != "" {
+		if Self.htpasswd, err = loadHtpasswd(*htpasswdFile); err != nil {
+			log.Fatalf("Could not load the htpasswd file: %v\n", err)
+		}
+	}
+	if Self.token = *token; Self.token == "auto" {
+		Self.token = generateToken()
+	}
+	if Self.access, err = parseAccessList(allow, deny); err != nil {
+		log.Fatalln(err)
+	}
+	if *rateValue != "" {
+		limit, burstSize, err := parseRate(*rateValue)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if *burst > 0 {
+			burstSize = *burst
+		}
+		Self.rateLimiter = newRateLimiter(limit, burstSize, *ratePerIP)
+	}
+	Self.maxConns = *maxConns
+	if *maxInflight < 0 || *maxQueue < 0 {
+		log.Fatalln("--max-inflight and --max-queue cannot be negative")
+	}
+	if *maxInflight > 0 {
+		Self.inflight = newInflightLimiter(*maxInflight, *maxQueue)
+	}
+	if *memoryCacheSize != "" {
+		size, err := parseSize(*memoryCacheSize)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if size > 0 {
+			Self.memoryCache = newMemoryCache(size)
+		}
+	}
+	if *mmapSize != "" {
+		if Self.mmapSize, err = parseSize(*mmapSize); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if *maxHeaderBytes != "" {
+		size, err := parseSize(*maxHeaderBytes)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		Self.maxHeaderSize = int(min(size, math.MaxInt32))
+	}
+	if *maxBodySize != "" {
+		if Self.maxBodySize, err = parseSize(*maxBodySize); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	Self.timeouts = serverTimeouts{read: *readTimeout, readHeader: *readHeaderTimeout, write: *writeTimeout, idle: *idleTimeout}
+	if min(*readTimeout, *readHeaderTimeout, *writeTimeout, *idleTimeout) < 0 {
+		log.Fatalln("The timeouts cannot be negative")
+	}
+	if *shutdownTimeout < 0 {
+		log.Fatalln("--shutdown-timeout cannot be negative")
+	}
+	Self.shutdownWait = *shutdownTimeout
+	if *delayValue != "" {
+		d, err := parseDelay(*delayValue)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		Self.delay = &d
+	}
+	if *chaos != "" {
+		if Self.chaos, err = parseChaos(*chaos); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if *throttle != "" {
+		if Self.throttle, err = parseBandwidth(*throttle); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	// Log the requests in the common or combined log format, if requested
+	if *logFormat != "" && !slices.Contains(logFormats, *logFormat) {
+		log.Fatalf("Invalid log format %q (expected %s)\n", *logFormat, strings.Join(logFormats, " or "))
+	}
+	Self.logFormat = *logFormat
+
+	// Log the requests to the file, rotating it by size and time, if requested
+	if *logFile != "" {
+		var maxSize int64
+		if *logMaxSize != "" {
+			if maxSize, err = parseSize(*logMaxSize); err != nil {
+				log.Fatalln(err)
+			}
+		}
+		if Self.logFile, err = openRotatingFile(*logFile, maxSize, *logRotate, *logKeep); err != nil {
+			log.Fatalf("Could not open the log file: %v\n", err)
+		}
+	} else if *noConsoleLog || *logMaxSize != "" || *logRotate != 0 || *logKeep != 0 {
+		log.Fatalln("--no-console-log, --log-max-size, --log-rotate and --log-keep need a --log-file")
+	}
+	Self.noConsoleLog = *noConsoleLog
+
+	// Log less or more about the requests, if requested
+	if *quiet && *verbose {
+		log.Fatalln("--quiet cannot be used with --verbose")
+	}
+	Self.quiet, Self.verbose = *quiet, *verbose
+
+	// Respond to health checks, if requested
+	Self.health = *health
+
+	// Report the status of the server, if requested
+	if *status {
+		Self.stats = newServerStats()
+	}
+
+	// Inspect the requests, if requested
+	if *inspect {
+		Self.inspector = newInspector()
+	}
+
+	// Record the requests to an HTTP Archive, if requested
+	if *har != "" {
+		Self.har = &harRecorder{path: *har}
+	}
+
+	// Expose the metrics of the requests, if requested
+	if *metricsEnabled {
+		Self.metrics, Self.metricsPath = newMetrics(), "/"+strings.TrimPrefix(*metricsPath, "/")
+	}
+	if *mock != "" {
+		if Self.mock, err = loadMockAPI(*mock); err != nil {
+			log.Fatalf("Could not load the mock API: %v\n", err)
+		}
+	}
+
+	// Obtain certificates automatically via ACME, if requested
+	if *acme && !Self.IsTLS() {
+		domains := parseDomains(*domain)
+		if len(domains) == 0 {
+			log.Fatalln("At least one --domain must be provided to use --acme")
+		}
+		cacheDir := *acmeCache
+		if cacheDir == "" {
+			if cacheDir, err = configDir("acme"); err != nil {
+				log.Fatalf("Could not create the ACME cache directory: %v\n", err)
+			}
+		}
+		Self.acme = acmeManager(domains, cacheDir)
+		Self.tls = Self.acme.TLSConfig()
+	}
+
+	// Generate (or reuse) a self-signed certificate, if requested
+	if *selfSigned && !Self.IsTLS() {
+		certificate, err := loadOrCreateSelfSignedCert(Self.host)
+		if err != nil {
+			log.Fatalf("Could not create a self-signed certificate: %v\n", err)
+		}
+		Self.tls = &tls.Config{Certificates: []tls.Certificate{certificate}}
+		log.Println("Using self-signed certificate with SHA-256 fingerprint", fingerprint(certificate))
+	}
+
+	// Only listen over IPv4 or IPv6, if requested
+	if *ipv4Only && *ipv6Only {
+		log.Fatalln("--ipv4-only cannot be used with --ipv6-only")
+	}
+	if ip := net.ParseIP(Self.host); *ipv4Only {
+		if ip.IsUnspecified() {
+			Self.host = "0.0.0.0"
+		} else if ip != nil && ip.To4() == nil {
+			log.Fatalf("--ipv4-only cannot be used with the IPv6 host %s\n", Self.host)
+		}
+		Self.network = "tcp4"
+	} else if *ipv6Only {
+		if ip.IsUnspecified() {
+			Self.host = "::"
+		} else if Self.host == "localhost" {
+			Self.host = "::1" // Which localhost may not resolve to
+		} else if ip != nil && ip.To4() != nil {
+			log.Fatalf("--ipv6-only cannot be used with the IPv4 host %s\n", Self.host)
+		}
+		Self.network = "tcp6"
+	}
+
+	// Try the next ports when the port is in use, if enabled
+	Self.portRetry = *portRetry
+
+	// Print a QR code of the address, if requested
+	Self.qr = *qr
+
+	// Listen on the Unix domain socket, if requested (HTTP/3 needs a UDP port)
+	if Self.unix = *unix; Self.unix != "" && Self.http3 {
+		log.Fatalln("--http3 cannot be used with --unix")
+	}
+
+	// Listen on the socket passed by systemd, if socket activated
+	Self.activated = activatedSocket()
+
+	// Open the browser once the server is ready, if requested (browsers cannot open Unix domain sockets,
+	// and the address of the socket passed by systemd is not known)
+	if Self.open = open.path; Self.open != "" && (Self.unix != "" || Self.activated != nil) {
+		log.Fatalln("--open cannot be used with --unix or socket activation")
+	}
+
+	// Expose the server at a public URL, if requested (the tunnels forward to a TCP port)
+	if *tunnel != "" {
+		provider, err := parseTunnel(*tunnel)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if Self.unix != "" {
+			log.Fatalln("--tunnel cannot be used with --unix")
+		}
+		Self.tunnelVia = &provider
+	}
+
+	// Advertise the server over mDNS, if requested (which is only useful when reachable from the network)
+	if *mdns != "" {
+		if Self.mdns, err = parseMDNSName(*mdns); err != nil {
+			log.Fatalln(err)
+		}
+		if Self.unix != "" || !isUnspecifiedHost(Self.host) {
+			log.Fatalln("--mdns needs the server to listen on all interfaces (use --host 0.0.0.0)")
+		}
+	}
+
+	// HTTP/3 is only ever served over TLS
+	if Self.http3 && !Self.IsTLS() {
+		log.Fatalln("--http3 requires HTTPS (use --tls, --acme or --cert and --key)")
+	}
+
+	// Show the dashboard in place of the logs, if requested
+	if *tui {
+		if Self.stdin != nil {
+			log.Fatalln("--tui cannot be used when serving stdin (the dashboard reads its keys from it)")
+		}
+		if info, err := os.Stdout.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+			log.Fatalln("--tui requires a terminal")
+		}
+		Self.dashboard = newDashboard(Self)
+	}
+
+	// Handle graceful exit
+	go Self.handleGracefulExit()
+
+	// Listen for keyboard input to restart the server (or for the keys of the dashboard)
+	if Self.dashboard != nil {
+		Self.dashboard.start()
+	} else if Self.stdin == nil {
+		go Self.handleRestart()
+	}
+
+	// Start serving the files until done
+	for {
+		// Serve the files
+		err := Self.Serve()
+		if err != nil {
+			log.Println(err.Error())
+		}
+
+		// If the server is done serving, break out of the loop
+		if Self.IsDone() {
+			break
+		}
+	}
+
+	// Give the terminal back, if the dashboard took it over
+	if Self.dashboard != nil {
+		Self.dashboard.Close()
+	}
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// A flag that can be repeated to build up a list of values
+type listFlag []string
+
+// The string representation of the list
+func (l *listFlag) String() string {
+	return strings.Join(*l, ", ")
+}
+
+// Add a value to the list
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// Read configuration from Environment Variables
+func getDefaultConfiguration() (host string, port int) {
+	// Read the HOST variable
+	host = os.Getenv("HOST")
+	if host == "" {
+		host = DEFAULT_HOST
+	}
+	// Read the PORT variable
+	port, err := strconv.Atoi(os.Getenv("PORT"))
+	if err != nil {
+		port = DEFAULT_PORT
+	}
+	return host, port
+}
+
+// Boolean indicating whether the flag was set on the command-line
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"os"
+)
+
+// =====
+// COLOR
+// =====
+
+// The ANSI escape codes of the colors of the console output
+const (
+	colorReset  = "\u001b[0m"
+	colorBold   = "\u001b[1m"
+	colorGray   = "\u001b[90m"
+	colorRed    = "\u001b[91m"
+	colorGreen  = "\u001b[92m"
+	colorYellow = "\u001b[93m"
+	colorCyan   = "\u001b[96m"
+	colorLink   = "\u001b[4;36m"   // Underlined cyan, for the addresses
+	colorQR     = "\u001b[30;107m" // Black on white, for the QR codes to scan regardless of the terminal's colors
+)
+
+// Whether to color the output on stdout (the banner) and stderr (the logs). Both stay off until setupColor.
+var stdoutColor, stderrColor bool
+
+// Enable the colors for the outputs that are terminals, unless disabled with --no-color, the NO_COLOR
+// environment variable (see https://no-color.org) or a dumb terminal
+func setupColor(disabled bool) {
+	if disabled || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		stdoutColor, stderrColor = false, false
+		return
+	}
+	stdoutColor, stderrColor = isTerminal(os.Stdout), isTerminal(os.Stderr)
+}
+
+// The text in the color, if enabled (for the banner, with stdoutColor, or the logs, with stderrColor)
+func colorize(enabled bool, color, text string) string {
+	if !enabled || color == "" {
+		return text
+	}
+	return color + text + colorReset
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Boolean indicating whether the file is a terminal (rather than a file or a pipe)
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ===========
+// SUBCOMMANDS
+// ===========
+
+// A subcommand of the CLI, like `self-serve embed`
+type command struct {
+	name        string              // The name of the subcommand
+	description string              // What the subcommand does (for the usage)
+	run         func(args []string) // Run the subcommand with the arguments after its name
+}
+
+// The subcommands of the CLI, with serve as the default when none is given
+func subcommands() []command {
+	return []command{
+		{"serve", "Serve a directory (the default, when no subcommand is given)", runServe},
+		{"embed", "Bundle a directory into a standalone binary that serves it", runEmbed},
+		{"trust", "Create a local certificate authority and install it into the system trust store", runTrust},
+		{"completion", "Print the completion script for bash, zsh, fish or powershell", runCompletion},
+		{"version", "Print the version number", runVersion},
+		{"help", "Print the usage of self-serve, or of a subcommand", runHelp},
+	}
+}
+
+// Find the subcommand by its name
+func findCommand(name string) (command, bool) {
+	for _, cmd := range subcommands() {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// Print the version number
+func runVersion(args []string) {
+	fmt.Println(VERSION)
+}
+
+// Print the usage of self-serve (with its subcommands and the flags of serve), or of the subcommand
+func runHelp(args []string) {
+	if len(args) == 0 {
+		runServe([]string{"-h"}) // Which defines the flags of serve, to print them (and exits)
+		return
+	}
+	cmd, ok := findCommand(args[0])
+	switch {
+	case !ok:
+		fmt.Fprintf(os.Stderr, "Unknown command %q (see self-serve help)\n", args[0])
+		os.Exit(2)
+	case cmd.name == "version" || cmd.name == "help":
+		fmt.Printf("Usage: self-serve %s\n\n%s\n", cmd.name, cmd.description)
+	default:
+		cmd.run([]string{"-h"}) // Print the usage of its flags (and exit)
+	}
+}
+
+// Print the usage of self-serve: the subcommands, and the flags of serve
+func printUsage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintln(w, "Usage: self-serve [serve] [flags] [dir]")
+	fmt.Fprintln(w, "       self-serve <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	commands := subcommands()
+	width := 0
+	for _, cmd := range commands {
+		width = max(width, len(cmd.name))
+	}
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s%s  %s\n", cmd.name, strings.Repeat(" ", width-len(cmd.name)), cmd.description)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Flags of serve:")
+	flag.PrintDefaults()
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ================
+// SHELL COMPLETION
+// ================
+
+// The shells to generate the completion scripts for
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// Whether to only define the flags of serve, without serving (to generate the completion scripts from them)
+var onlyDefineFlags bool
+
+// A flag of serve, as completed by the shells
+type completionFlag struct {
+	name       string // The name of the flag
+	usage      string // The description of the flag
+	takesValue bool   // Whether the flag takes a value (unlike the boolean flags)
+}
+
+// Print the completion script for the shell, which completes the subcommands, the flags of serve
+// and the directory to serve
+func runCompletion(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: self-serve completion %s\n", strings.Join(completionShells, "|"))
+		os.Exit(2)
+	}
+	commands, flags := subcommands(), serveFlags()
+	switch args[0] {
+	case "bash":
+		fmt.Print(bashCompletion(commands, flags))
+	case "zsh":
+		fmt.Print(zshCompletion(commands, flags))
+	case "fish":
+		fmt.Print(fishCompletion(commands, flags))
+	case "powershell":
+		fmt.Print(powershellCompletion(commands, flags))
+	default:
+		fmt.Fprintf(os.Stderr, "Unsupported shell %q (expected one of %s)\n", args[0], strings.Join(completionShells, ", "))
+		os.Exit(2)
+	}
+}
+
+// The flags of serve, sorted by name
+func serveFlags() []completionFlag {
+	onlyDefineFlags = true
+	runServe(nil)
+
+	var flags []completionFlag
+	flag.VisitAll(func(f *flag.Flag) {
+		isBool := false
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok {
+			isBool = b.IsBoolFlag()
+		}
+		flags = append(flags, completionFlag{f.Name, f.Usage, !isBool})
+	})
+	return flags
+}
+
+// -------
+// SCRIPTS
+// -------
+
+// The completion script for bash (to source, or to put in the bash-completion directory)
+func bashCompletion(commands []command, flags []completionFlag) string {
+	var names, allFlags, valueFlags []string
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+	}
+	for _, f := range flags {
+		allFlags = append(allFlags, "--"+f.name)
+		if f.takesValue {
+			valueFlags = append(valueFlags, "--"+f.name)
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# bash completion for self-serve (source it, like: source <(self-serve completion bash))\n")
+	sb.WriteString("_self_serve() {\n")
+	sb.WriteString("    local cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	fmt.Fprintf(&sb, "    local commands=%q\n", strings.Join(names, " "))
+	fmt.Fprintf(&sb, "    local flags=%q\n", strings.Join(allFlags, " "))
+	fmt.Fprintf(&sb, "    local value_flags=%q\n", " "+strings.Join(valueFlags, " ")+" ")
+	sb.WriteString(`    case "${COMP_WORDS[1]}" in
+        completion)
+            [[ $COMP_CWORD -eq 2 ]] && COMPREPLY=($(compgen -W "` + strings.Join(completionShells, " ") + `" -- "$cur"))
+            return ;;
+        help)
+            [[ $COMP_CWORD -eq 2 ]] && COMPREPLY=($(compgen -W "$commands" -- "$cur"))
+            return ;;
+        embed|trust|version)
+            COMPREPLY=($(compgen -d -- "$cur"))
+            return ;;
+    esac
+    if [[ "$value_flags" == *" $prev "* ]]; then
+        COMPREPLY=($(compgen -f -- "$cur"))
+    elif [[ "$cur" == -* ]]; then
+        COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+    elif [[ $COMP_CWORD -eq 1 ]]; then
+        COMPREPLY=($(compgen -W "$commands" -- "$cur") $(compgen -d -- "$cur"))
+    else
+        COMPREPLY=($(compgen -d -- "$cur"))
+    fi
+}
+complete -o filenames -F _self_serve self-serve
+`)
+	return sb.String()
+}
+
+// The completion script for zsh (to put on the fpath as _self-serve)
+func zshCompletion(commands []command, flags []completionFlag) string {
+	var sb strings.Builder
+	sb.WriteString("#compdef self-serve\n\n")
+	sb.WriteString("_self_serve() {\n")
+	sb.WriteString("    local -a commands flags\n")
+	sb.WriteString("    commands=(\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&sb, "        %s\n", shellQuote(cmd.name+":"+strings.ReplaceAll(cmd.description, ":", `\:`)))
+	}
+	sb.WriteString("    )\n")
+	sb.WriteString("    flags=(\n")
+	for _, f := range flags {
+		spec := "--" + f.name + "[" + zshEscape(f.usage) + "]"
+		if f.takesValue {
+			spec += ":" + f.name + ":_files"
+		}
+		fmt.Fprintf(&sb, "        %s\n", shellQuote(spec))
+	}
+	sb.WriteString("    )\n")
+	sb.WriteString(`    case "${words[2]}" in
+        completion) (( CURRENT == 3 )) && _values 'shell' ` + strings.Join(completionShells, " ") + `; return ;;
+        help) (( CURRENT == 3 )) && _describe 'command' commands; return ;;
+        embed|trust|version) _files -/; return ;;
+    esac
+    if (( CURRENT == 2 )) && [[ "${words[2]}" != -* ]]; then
+        _describe 'command' commands
+        _files -/
+        return
+    fi
+    _arguments $flags '*:directory:_files -/'
+}
+
+if [ "$funcstack[1]" = "_self-serve" ]; then
+    _self_serve "$@"
+else
+    compdef _self_serve self-serve
+fi
+`)
+	return sb.String()
+}
+
+// The completion script for fish (to put in ~/.config/fish/completions/self-serve.fish)
+func fishCompletion(commands []command, flags []completionFlag) string {
+	var others []string // The subcommands besides serve, which take the flags
+	for _, cmd := range commands {
+		if cmd.name != "serve" {
+			others = append(others, cmd.name)
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# fish completion for self-serve\n")
+	sb.WriteString("complete -c self-serve -f\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&sb, "complete -c self-serve -n '__fish_use_subcommand' -a %s -d %s\n", cmd.name, shellQuote(cmd.description))
+	}
+	fmt.Fprintf(&sb, "complete -c self-serve -n '__fish_seen_subcommand_from completion' -a '%s'\n", strings.Join(completionShells, " "))
+	fmt.Fprintf(&sb, "complete -c self-serve -n '__fish_seen_subcommand_from help' -a 'serve %s'\n", strings.Join(others, " "))
+	fmt.Fprintf(&sb, "complete -c self-serve -n 'not __fish_seen_subcommand_from completion help' -a '(__fish_complete_directories)'\n")
+	for _, f := range flags {
+		value := ""
+		if f.takesValue {
+			value = " -r -F"
+		}
+		fmt.Fprintf(&sb, "complete -c self-serve -n 'not __fish_seen_subcommand_from %s' -l %s%s -d %s\n",
+			strings.Join(others, " "), f.name, value, shellQuote(f.usage))
+	}
+	return sb.String()
+}
+
+// The completion script for PowerShell (to dot-source in the $PROFILE)
+func powershellCompletion(commands []command, flags []completionFlag) string {
+	var sb strings.Builder
+	sb.WriteString("# PowerShell completion for self-serve\n")
+	sb.WriteString("Register-ArgumentCompleter -Native -CommandName self-serve -ScriptBlock {\n")
+	sb.WriteString("    param($wordToComplete, $commandAst, $cursorPosition)\n")
+	sb.WriteString("    $commands = @(\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&sb, "        @{ Name = %s; Description = %s }\n", powershellQuote(cmd.name), powershellQuote(cmd.description))
+	}
+	sb.WriteString("    )\n")
+	sb.WriteString("    $flags = @(\n")
+	for _, f := range flags {
+		fmt.Fprintf(&sb, "        @{ Name = %s; Description = %s }\n", powershellQuote("--"+f.name), powershellQuote(f.usage))
+	}
+	sb.WriteString("    )\n")
+	sb.WriteString(`    $elements = @($commandAst.CommandElements | ForEach-Object { $_.ToString() })
+    $position = if ($wordToComplete) { $elements.Count - 1 } else { $elements.Count }
+    $subcommand = if ($elements.Count -gt 1) { $elements[1] } else { '' }
+    if ($position -eq 2 -and $subcommand -eq 'completion') {
+        '` + strings.Join(completionShells, "', '") + `' | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+            [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+        }
+        return
+    }
+    if ($wordToComplete -like '-*') {
+        $flags | Where-Object { $_.Name -like "$wordToComplete*" } | ForEach-Object {
+            [System.Management.Automation.CompletionResult]::new($_.Name, $_.Name, 'ParameterName', $_.Description)
+        }
+        return
+    }
+    if ($position -eq 1 -or ($position -eq 2 -and $subcommand -eq 'help')) {
+        $commands | Where-Object { $_.Name -like "$wordToComplete*" } | ForEach-Object {
+            [System.Management.Automation.CompletionResult]::new($_.Name, $_.Name, 'Command', $_.Description)
+        }
+    }
+    Get-ChildItem -Directory -Path "$wordToComplete*" -ErrorAction SilentlyContinue | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_.Name, $_.Name, 'ProviderContainer', $_.Name)
+    }
+}
+`)
+	return sb.String()
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Quote the value in single quotes, for the POSIX shells (and fish)
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// Quote the value in single quotes, for PowerShell
+func powershellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// Escape the brackets and colons of the description of a zsh `_arguments` spec
+func zshEscape(value string) string {
+	return strings.NewReplacer("[", `\[`, "]", `\]`, ":", `\:`).Replace(value)
+}
@@ -0,0 +1,302 @@
+package server
+
+import (
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ===========
+// COMPRESSION
+// ===========
+
+// Responses smaller than this are not worth compressing
+const minCompressSize = 1024
+
+// The brotli quality level to use for on-the-fly compression. Higher levels
+// compress better but are too slow to use for every request.
+const brotliQuality = 5
+
+// A content-encoding the server can compress responses with
+type encoding struct {
+	name      string                           // The Content-Encoding token
+	newWriter func(w io.Writer) io.WriteCloser // Create a compressing writer
+}
+
+// The supported encodings, in order of server preference
+var encodings = []encoding{
+	{"br", func(w io.Writer) io.WriteCloser { return brotli.NewWriterLevel(w, brotliQuality) }},
+	{"zstd", newZstdWriter},
+	{"gzip", func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }},
+}
+
+// Create a zstd writer suitable for compressing a single response. The window size is
+// capped at 8MB, the most browsers are willing to allocate for decompression.
+func newZstdWriter(w io.Writer) io.WriteCloser {
+	enc, _ := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(8<<20))
+	return enc
+}
+
+// Content types that benefit from compression (in addition to text/*)
+var compressibleTypes = []string{
+	"application/javascript",
+	"application/json",
+	"application/ld+json",
+	"application/manifest+json",
+	"application/wasm",
+	"application/xml",
+	"application/xhtml+xml",
+	"application/rss+xml",
+	"application/atom+xml",
+	"image/svg+xml",
+	"font/ttf",
+	"font/otf",
+}
+
+// Middleware that transparently compresses compressible responses using the
+// best encoding accepted by the client
+func compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addVary(w.Header(), "Accept-Encoding")
+
+		// Partial content cannot be compressed on the fly
+		enc, ok := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if !ok || r.Header.Get("Range") != "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: enc}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// Pick the supported encoding with the highest quality value in the Accept-Encoding header
+func negotiateEncoding(header string) (encoding, bool) {
+	best, bestQ := encoding{}, 0.0
+	for _, enc := range encodings {
+		if q := acceptQuality(header, enc.name); q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+// The quality value the Accept-Encoding header gives to the encoding (0 if not accepted)
+func acceptQuality(header, name string) float64 {
+	wildcard := 0.0
+	for _, part := range strings.Split(header, ",") {
+		token, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		switch {
+		case strings.EqualFold(token, name):
+			return q
+		case token == "*":
+			wildcard = q
+		}
+	}
+	return wildcard
+}
+
+// Boolean indicating whether the content type is worth compressing
+func isCompressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") || slices.Contains(compressibleTypes, mediaType)
+}
+
+// -------------
+// PRECOMPRESSED
+// -------------
+
+// The file extensions of precompressed sidecar files, by encoding
+var sidecarExtensions = map[string]string{
+	"br":   ".br",
+	"zstd": ".zst",
+	"gzip": ".gz",
+}
+
+// Middleware that serves precompressed sidecar files (e.g. `app.js.br` next to `app.js`)
+// when they exist and the client accepts their encoding
+func precompressed(fsys http.FileSystem, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || strings.HasSuffix(r.URL.Path, "/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The sidecar is served with the Content-Type of the original file
+		contentType := mime.TypeByExtension(path.Ext(r.URL.Path))
+		if contentType == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		file, info, enc := openSidecar(fsys, r.URL.Path, r.Header.Get("Accept-Encoding"))
+		if file == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		defer file.Close()
+		logDetail(r, "Serving the precompressed %s%s", r.URL.Path, sidecarExtensions[enc])
+
+		addVary(w.Header(), "Accept-Encoding")
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Encoding", enc)
+		if w.Header().Get("ETag") != "" {
+			w.Header().Set("ETag", etag(info)) // The sidecar is a different representation
+		}
+		http.ServeContent(w, r, r.URL.Path, info.ModTime(), file)
+	})
+}
+
+// Open the best precompressed sidecar of the file that the client accepts.
+// Returns a nil file if there is none.
+func openSidecar(fsys http.FileSystem, name, acceptEncoding string) (http.File, fs.FileInfo, string) {
+	bestQ := 0.0
+	var bestFile http.File
+	var bestInfo fs.FileInfo
+	var bestEncoding string
+	for _, enc := range encodings {
+		q := acceptQuality(acceptEncoding, enc.name)
+		if q <= bestQ {
+			continue
+		}
+		file, err := fsys.Open(name + sidecarExtensions[enc.name])
+		if err != nil {
+			continue
+		}
+		info, err := file.Stat()
+		if err != nil || info.IsDir() {
+			file.Close()
+			continue
+		}
+		if bestFile != nil {
+			bestFile.Close()
+		}
+		bestQ, bestFile, bestInfo, bestEncoding = q, file, info, enc.name
+	}
+	return bestFile, bestInfo, bestEncoding
+}
+
+// ------------------
+// COMPRESSION WRITER
+// ------------------
+
+// A ResponseWriter that compresses the body if the response turns out to be compressible
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    encoding       // The encoding to compress with
+	writer      io.WriteCloser // The compressing writer (nil if not compressing)
+	wroteHeader bool           // Whether the header has been written
+}
+
+// Decide whether to compress the response, based on its headers
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+
+	h := cw.Header()
+	length, err := strconv.Atoi(h.Get("Content-Length"))
+	tooSmall := err == nil && length < minCompressSize
+	if status == http.StatusOK && h.Get("Content-Encoding") == "" && !tooSmall && isCompressible(h.Get("Content-Type")) {
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		h.Set("Content-Encoding", cw.encoding.name)
+		if tag := h.Get("ETag"); tag != "" && !strings.HasPrefix(tag, "W/") {
+			h.Set("ETag", "W/"+tag) // The compressed body is not byte-for-byte identical
+		}
+		cw.writer = cw.encoding.newWriter(cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+// Write the (possibly compressed) body
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.writer != nil {
+		return cw.writer.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Write the body read from the source (as http.ServeContent copies the files). A whole file of the
+// memory cache is written from its cached compressed variant, in place of compressing it again.
+func (cw *compressWriter) ReadFrom(src io.Reader) (int64, error) {
+	if limited, ok := src.(*io.LimitedReader); ok && cw.writer != nil {
+		if file, ok := limited.R.(*memoryFile); ok && limited.N == file.Size() {
+			if data, ok := file.compressed(cw.encoding); ok {
+				cw.writer = nil // Never written to, so there is nothing to close
+				file.Seek(0, io.SeekEnd)
+				limited.N = 0
+				_, err := cw.ResponseWriter.Write(data)
+				return file.Size(), err
+			}
+		}
+	}
+	return io.Copy(struct{ io.Writer }{cw}, src) // Hiding ReadFrom, to not recurse into it
+}
+
+// Flush the compressed data written so far to the client
+func (cw *compressWriter) Flush() {
+	if flusher, ok := cw.writer.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Finish writing the compressed body
+func (cw *compressWriter) Close() error {
+	if cw.writer == nil {
+		return nil
+	}
+	return cw.writer.Close()
+}
+
+// Unwrap the underlying ResponseWriter (for http.ResponseController)
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Add the header name to the Vary header, unless it is already there
+func addVary(h http.Header, name string) {
+	for _, value := range h.Values("Vary") {
+		for _, existing := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(existing), name) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", name)
+}
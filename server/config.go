@@ -0,0 +1,296 @@
+package server
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// ===========
+// CONFIG FILE
+// ===========
+
+// The names of the config files to look for in the served directory (in order)
+var configFileNames = []string{"selfserve.yaml", "selfserve.yml", "selfserve.toml", "selfserve.json"}
+
+// Find the config file in the directory, if any
+func findConfigFile(dir string) string {
+	for _, name := range configFileNames {
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && info.Mode().IsRegular() {
+			return filepath.Join(dir, name)
+		}
+	}
+	return ""
+}
+
+// Load the settings of the config file (in YAML, TOML or JSON, by its extension)
+func loadConfigFile(name string) (map[string]any, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	settings := map[string]any{}
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &settings)
+	case ".toml":
+		settings, err = parseTOML(string(data))
+	case ".json":
+		err = json.Unmarshal(data, &settings)
+	default:
+		return nil, fmt.Errorf("unsupported config file format %q (expected .yaml, .toml or .json)", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(name), err)
+	}
+	return settings, nil
+}
+
+// The settings with those of the named profile (under `profiles`) in place of the top-level ones,
+// or without the profiles if none is named
+func selectProfile(settings map[string]any, name string) (map[string]any, error) {
+	profiles, ok := settings["profiles"].(map[string]any)
+	if _, exists := settings["profiles"]; exists && !ok {
+		return nil, fmt.Errorf("invalid profiles: expected a map of names to settings")
+	}
+	selected := maps.Clone(settings)
+	delete(selected, "profiles")
+	if name == "" {
+		return selected, nil
+	}
+
+	profile, ok := profiles[name].(map[string]any)
+	if !ok {
+		if len(profiles) == 0 {
+			return nil, fmt.Errorf("no profile %q (the config file has no profiles)", name)
+		}
+		return nil, fmt.Errorf("no profile %q (expected one of %s)", name, strings.Join(slices.Sorted(maps.Keys(profiles)), ", "))
+	}
+	maps.Copy(selected, profile)
+	return selected, nil
+}
+
+// Apply the settings to the flags that were not given on the command line (which take precedence),
+// returning the redirect rules. Each setting is named after its flag (like `port` or `live-reload`),
+// with lists for the repeatable flags, besides the structured settings:
+//
+//	mounts:    { /docs: ./docs }
+//	proxies:   { /api: http://localhost:3000, /auth: { target: http://localhost:4000, strip: /auth } }
+//	headers:   { /fonts/*: { Access-Control-Allow-Origin: "*" } }
+//	redirects: [ { from: /old, to: /new, status: 301 } ]
+func applyConfig(settings map[string]any) ([]redirectRule, error) {
+	given := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	var rules []redirectRule
+	for _, key := range slices.Sorted(maps.Keys(settings)) {
+		value := settings[key]
+		var values []string
+		var err error
+		name := key
+		switch key {
+		case "mounts":
+			name = "mount"
+			values, err = configPairs(value, func(prefix, dir string) string { return prefix + "=" + dir })
+		case "proxies":
+			name = "proxy"
+			values, err = configProxies(value)
+		case "headers":
+			name = "header"
+			values, err = configHeaders(value)
+		case "redirects":
+			rules, err = configRedirects(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid redirects: %w", err)
+			}
+			continue
+		case "config", "profile", "env-file":
+			return nil, fmt.Errorf("%s cannot be set in the config file", key)
+		default:
+			values, err = configValues(key, value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", key, err)
+		}
+		if given[name] {
+			continue // The command line takes precedence
+		}
+		for _, v := range values {
+			if err := flag.Set(name, v); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", key, err)
+			}
+		}
+	}
+	return rules, nil
+}
+
+// -------------------
+// STRUCTURED SETTINGS
+// -------------------
+
+// The flag values of a setting: the value itself, or each of the values of a list (for the repeatable flags)
+func configValues(name string, value any) ([]string, error) {
+	f := flag.Lookup(name)
+	if f == nil {
+		return nil, fmt.Errorf("unknown setting")
+	}
+	list, ok := value.([]any)
+	if !ok {
+		v, err := configScalar(value)
+		return []string{v}, err
+	}
+	if _, repeatable := f.Value.(*listFlag); !repeatable {
+		return nil, fmt.Errorf("expected a single value, not a list")
+	}
+	values := make([]string, 0, len(list))
+	for _, item := range list {
+		v, err := configScalar(item)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// The flag values of a map setting (like the mounts), each formatted from its key and value
+func configPairs(value any, format func(key, value string) string) ([]string, error) {
+	m, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a map")
+	}
+	values := make([]string, 0, len(m))
+	for _, key := range slices.Sorted(maps.Keys(m)) {
+		v, err := configScalar(m[key])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, format(key, v))
+	}
+	return values, nil
+}
+
+// The --proxy values of the proxies setting, which maps the path prefixes to the backends, or to
+// maps of the backend (as `target`) and the proxy options (like `strip` or `set-header`)
+func configProxies(value any) ([]string, error) {
+	m, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a map of path prefixes to backends")
+	}
+	values := make([]string, 0, len(m))
+	for _, prefix := range slices.Sorted(maps.Keys(m)) {
+		options, ok := m[prefix].(map[string]any)
+		if !ok {
+			target, err := configScalar(m[prefix])
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, prefix+"="+target)
+			continue
+		}
+
+		target, err := configScalar(options["target"])
+		if err != nil || target == "" {
+			return nil, fmt.Errorf("expected a target for the proxy of %s", prefix)
+		}
+		proxy := prefix + "=" + target
+		for _, option := range slices.Sorted(maps.Keys(options)) {
+			if option == "target" {
+				continue
+			}
+			optionValues, isList := options[option].([]any)
+			if !isList {
+				optionValues = []any{options[option]}
+			}
+			for _, optionValue := range optionValues {
+				v, err := configScalar(optionValue)
+				if err != nil {
+					return nil, err
+				}
+				proxy += ";" + option + "=" + v
+			}
+		}
+		values = append(values, proxy)
+	}
+	return values, nil
+}
+
+// The --header values of the headers setting, which maps the path patterns to maps of the headers to set
+func configHeaders(value any) ([]string, error) {
+	m, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a map of path patterns to headers")
+	}
+	var values []string
+	for _, pattern := range slices.Sorted(maps.Keys(m)) {
+		if !strings.HasPrefix(pattern, "/") {
+			return nil, fmt.Errorf("expected a path pattern starting with /, not %q", pattern)
+		}
+		headers, err := configPairs(m[pattern], func(name, value string) string { return pattern + ":" + name + "=" + value })
+		if err != nil {
+			return nil, fmt.Errorf("the headers of %s: %w", pattern, err)
+		}
+		values = append(values, headers...)
+	}
+	return values, nil
+}
+
+// The redirect rules of the redirects setting, which lists the rules as maps of from, to and status
+func configRedirects(value any) ([]redirectRule, error) {
+	list, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a list of rules")
+	}
+	rules := make([]redirectRule, 0, len(list))
+	for _, item := range list {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("expected a rule with from, to and status")
+		}
+		from, _ := configScalar(m["from"])
+		to, _ := configScalar(m["to"])
+		if from == "" || to == "" {
+			return nil, fmt.Errorf("expected a rule with from and to")
+		}
+		status, _ := configScalar(m["status"])
+		rule, err := newRedirectRule(from, to, status)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// The scalar value (a string, number or boolean) as a flag value
+func configScalar(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case nil:
+		return "", nil
+	}
+	return "", fmt.Errorf("expected a string, number or boolean, not %v", value)
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"flag"
+	"net/http"
+	"testing"
+)
+
+// Define the flags of serve on a fresh command line, and parse the arguments with them
+func defineServeFlags(t *testing.T, args ...string) {
+	t.Helper()
+	commandLine, onlyDefine := flag.CommandLine, onlyDefineFlags
+	t.Cleanup(func() { flag.CommandLine, onlyDefineFlags = commandLine, onlyDefine })
+
+	flag.CommandLine = flag.NewFlagSet("self-serve", flag.ContinueOnError)
+	onlyDefineFlags = true
+	runServe(nil)
+	if err := flag.CommandLine.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyConfigPrecedence(t *testing.T) {
+	defineServeFlags(t, "--port", "9000", "--exclude", "*.map")
+	rules, err := applyConfig(map[string]any{
+		"port":        8080,
+		"host":        "0.0.0.0",
+		"live-reload": true,
+		"exclude":     []any{"node_modules", "*.log"},
+		"mounts":      map[string]any{"/docs": "./docs", "/assets": "./static"},
+		"proxies":     map[string]any{"/api": map[string]any{"target": "http://localhost:3000", "strip": "/api"}},
+		"redirects":   []any{map[string]any{"from": "/old", "to": "/new", "status": 302}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "port", value: "9000"},        // Given on the command line
+		{name: "exclude", value: "*.map"},    // Likewise, not appended to
+		{name: "host", value: "0.0.0.0"},     // From the config file
+		{name: "live-reload", value: "true"}, // Likewise
+		{name: "mount", value: "/assets=./static, /docs=./docs"},
+		{name: "proxy", value: "/api=http://localhost:3000;strip=/api"},
+	}
+	for _, tt := range tests {
+		if got := flag.Lookup(tt.name).Value.String(); got != tt.value {
+			t.Errorf("--%s = %q, want %q", tt.name, got, tt.value)
+		}
+	}
+
+	if len(rules) != 1 || rules[0].to != "/new" || rules[0].status != http.StatusFound || !rules[0].from.MatchString("/old") {
+		t.Errorf("applyConfig returned the redirect rules %v, want /old => /new 302", rules)
+	}
+}
+
+func TestApplyConfigErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]any
+	}{
+		{name: "unknown setting", settings: map[string]any{"colour": true}},
+		{name: "list for a single value", settings: map[string]any{"port": []any{80, 81}}},
+		{name: "invalid value", settings: map[string]any{"port": "eighty"}},
+		{name: "config in the config file", settings: map[string]any{"config": "other.yaml"}},
+		{name: "profile in the config file", settings: map[string]any{"profile": "lan"}},
+		{name: "env file in the config file", settings: map[string]any{"env-file": ".env.local"}},
+		{name: "mounts not a map", settings: map[string]any{"mounts": []any{"/docs=./docs"}}},
+		{name: "redirect without a destination", settings: map[string]any{"redirects": []any{map[string]any{"from": "/old"}}}},
+	}
+	for _, tt := range tests {
+		defineServeFlags(t)
+		if _, err := applyConfig(tt.settings); err == nil {
+			t.Errorf("%s: applyConfig succeeded, want an error", tt.name)
+		}
+	}
+}
+
+func TestSelectProfile(t *testing.T) {
+	settings := map[string]any{
+		"port":     8080,
+		"host":     "localhost",
+		"profiles": map[string]any{"lan": map[string]any{"host": "0.0.0.0"}},
+	}
+	selected, err := selectProfile(settings, "lan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if selected["host"] != "0.0.0.0" || selected["port"] != 8080 || selected["profiles"] != nil {
+		t.Errorf("selectProfile(lan) = %v, want the lan host over the top-level settings, without the profiles", selected)
+	}
+	if settings["host"] != "localhost" {
+		t.Errorf("selectProfile changed the settings it was given")
+	}
+
+	if selected, err := selectProfile(settings, ""); err != nil || selected["host"] != "localhost" || selected["profiles"] != nil {
+		t.Errorf("selectProfile without a profile = %v, %v, want the top-level settings", selected, err)
+	}
+	if _, err := selectProfile(settings, "prod"); err == nil {
+		t.Errorf("selectProfile(prod) succeeded, want an error for the missing profile")
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ==================
+// ARTIFICIAL LATENCY
+// ==================
+
+// A delay to respond after, to simulate a slow network
+type delay struct {
+	base   time.Duration // The delay
+	jitter time.Duration // The most the delay varies by, either way
+}
+
+// Parse a delay, like 300ms, optionally with a jitter, like 200ms±100ms (or 200ms+-100ms)
+func parseDelay(value string) (delay, error) {
+	base, jitter, found := strings.Cut(value, "±")
+	if !found {
+		base, jitter, found = strings.Cut(value, "+-")
+	}
+	var d delay
+	var err error
+	if d.base, err = time.ParseDuration(strings.TrimSpace(base)); err != nil || d.base < 0 {
+		return delay{}, fmt.Errorf("invalid delay %q (expected a duration like 300ms, or 200ms±100ms with a jitter)", value)
+	}
+	if found {
+		if d.jitter, err = time.ParseDuration(strings.TrimSpace(jitter)); err != nil || d.jitter < 0 {
+			return delay{}, fmt.Errorf("invalid jitter in the delay %q (expected a duration like 200ms±100ms)", value)
+		}
+	}
+	return d, nil
+}
+
+// A random duration within the jitter of the delay (never negative)
+func (d delay) duration() time.Duration {
+	if d.jitter == 0 {
+		return d.base
+	}
+	return max(0, d.base-d.jitter+rand.N(2*d.jitter+1))
+}
+
+// Middleware that waits for the delay before responding (or until the client gives up)
+func delayResponses(d delay, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timer := time.NewTimer(d.duration())
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			next.ServeHTTP(w, r)
+		case <-r.Context().Done():
+		}
+	})
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// ==============
+// EMBEDDED SITES
+// ==============
+
+// The magic bytes that end a binary with an embedded site. The site is appended to the
+// binary as a zip archive, followed by its size (as 8 big-endian bytes) and the magic.
+const embedMagic = "self-serve:site1"
+
+// The size of the trailer that follows the embedded site
+const embedTrailerSize = 8 + len(embedMagic)
+
+// Load the site embedded in the running binary, if any (returning nil if there is none)
+func loadEmbeddedSite() (fs.FS, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(executable)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset, size, err := embeddedSiteSection(file, info.Size())
+	if err != nil || size == 0 {
+		return nil, err
+	}
+
+	archive, err := zip.NewReader(io.NewSectionReader(file, offset, size), size)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the embedded site: %w", err)
+	}
+	fsys := newArchiveFS(info.ModTime())
+	if err := fsys.addZip(archive); err != nil {
+		return nil, fmt.Errorf("could not read the embedded site: %w", err)
+	}
+	fsys.sortChildren()
+	return fsys, nil
+}
+
+// The offset and size of the site embedded at the end of the binary (with a size of 0 if there is none)
+func embeddedSiteSection(file io.ReaderAt, fileSize int64) (offset, size int64, err error) {
+	if fileSize < int64(embedTrailerSize) {
+		return 0, 0, nil
+	}
+	trailer := make([]byte, embedTrailerSize)
+	if _, err := file.ReadAt(trailer, fileSize-int64(embedTrailerSize)); err != nil {
+		return 0, 0, err
+	}
+	if string(trailer[8:]) != embedMagic {
+		return 0, 0, nil
+	}
+	size = int64(binary.BigEndian.Uint64(trailer[:8]))
+	offset = fileSize - int64(embedTrailerSize) - size
+	if size <= 0 || offset < 0 {
+		return 0, 0, fmt.Errorf("the embedded site is corrupted")
+	}
+	return offset, size, nil
+}
+
+// ----------------
+// EMBED SUBCOMMAND
+// ----------------
+
+// Bundle a directory into a copy of this binary, which serves it (with all the usual flags) when run.
+// Usage: self-serve embed <dir> [-o <output>]
+func runEmbed(args []string) {
+	flags := flag.NewFlagSet("embed", flag.ExitOnError)
+	output := flags.String("o", "", "The path of the binary to create (defaults to the name of the directory)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: self-serve embed <dir> [-o <output>]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	dir := flags.Arg(0)
+	if dir != "" {
+		flags.Parse(flags.Args()[1:]) // Accept the flags after the directory as well
+	}
+	if dir == "" || flags.NArg() > 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		log.Fatalf("Could not embed %s: not a directory\n", dir)
+	}
+
+	if *output == "" {
+		absolute, err := filepath.Abs(dir)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		*output = filepath.Base(absolute)
+		if executable, err := os.Executable(); err == nil {
+			*output += filepath.Ext(executable) // Keep the .exe on Windows
+		}
+	}
+	if err := embedSite(dir, *output); err != nil {
+		log.Fatalf("Could not embed %s: %v\n", dir, err)
+	}
+	log.Printf("Embedded %s into %s\n", dir, *output)
+	fmt.Printf("Run `%s` to serve it\n", *output)
+}
+
+// Write a copy of this binary (without any site it embeds) to the output, with the directory embedded
+func embedSite(dir, output string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	program, err := readBinary(executable)
+	if err != nil {
+		return err
+	}
+
+	// Zip the directory (leaving dotfiles out, as they would not be served anyway)
+	var site bytes.Buffer
+	if err := writeZip(&site, filteredFS{http.Dir(dir), isDotfile}, "/", ""); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o755)
+	if err != nil {
+		return err
+	}
+	trailer := append(binary.BigEndian.AppendUint64(nil, uint64(site.Len())), embedMagic...)
+	for _, part := range [][]byte{program, site.Bytes(), trailer} {
+		if _, err := file.Write(part); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	return file.Close()
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Read the binary, without the site it embeds (if any)
+func readBinary(name string) ([]byte, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	offset, size, err := embeddedSiteSection(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	if size > 0 {
+		data = data[:offset]
+	}
+	return data, nil
+}
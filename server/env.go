@@ -0,0 +1,84 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ========
+// ENV FILE
+// ========
+
+// The env file to load from the working directory, by default
+const defaultEnvFile = ".env"
+
+// Load the variables of the env file into the environment (without overriding the variables that are
+// already set, so that the real environment takes precedence). Lines are like `PORT=8080`, optionally
+// prefixed with `export`, with # comments, and values can be quoted with single or double quotes
+// (the latter with escapes like \n).
+func loadEnvFile(name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return fmt.Errorf("%s:%d: invalid line (expected KEY=value)", name, lineNumber)
+		}
+		value, err := parseEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", name, lineNumber, err)
+		}
+		if _, set := os.LookupEnv(key); !set {
+			os.Setenv(key, value)
+		}
+	}
+	return scanner.Err()
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Parse the value of a variable: unquoted (up to a # comment), 'single quoted' (as is),
+// or "double quoted" (with escapes)
+func parseEnvValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "'"):
+		end := strings.Index(value[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quote")
+		}
+		return value[1 : end+1], nil
+	case strings.HasPrefix(value, `"`):
+		for end := 1; end < len(value); end++ {
+			if value[end] == '\\' {
+				end++ // Skip the escaped character
+			} else if value[end] == '"' {
+				unquoted, err := strconv.Unquote(value[:end+1])
+				if err != nil {
+					return "", fmt.Errorf("invalid quoted value %s", value[:end+1])
+				}
+				return unquoted, nil
+			}
+		}
+		return "", fmt.Errorf("unterminated quote")
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = value[:i]
+	}
+	return strings.TrimSpace(value), nil
+}
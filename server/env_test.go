@@ -0,0 +1,41 @@
+package server
+
+import "testing"
+
+func TestParseEnvValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		err   bool
+	}{
+		{value: "8080", want: "8080"},
+		{value: "", want: ""},
+		{value: "hello world", want: "hello world"},
+		{value: "8080 # the port", want: "8080"},
+		{value: "a#b", want: "a#b"},
+		{value: "'single quoted'", want: "single quoted"},
+		{value: `'no \n escapes'`, want: `no \n escapes`},
+		{value: "'kept # hash' # comment", want: "kept # hash"},
+		{value: `"double quoted"`, want: "double quoted"},
+		{value: `"line\nbreak"`, want: "line\nbreak"},
+		{value: `"escaped \" quote" # comment`, want: `escaped " quote`},
+		{value: "'unterminated", err: true},
+		{value: `"unterminated`, err: true},
+		{value: `"escaped quote at the end\"`, err: true},
+		{value: `"invalid \q escape"`, err: true},
+	}
+	for _, tt := range tests {
+		got, err := parseEnvValue(tt.value)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseEnvValue(%q) = %q, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseEnvValue(%q) failed: %v", tt.value, err)
+		} else if got != tt.want {
+			t.Errorf("parseEnvValue(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ===========
+// ERROR PAGES
+// ===========
+
+// Parse the --error values (in the form `status=page`) into a map of error pages,
+// starting with the --not-found page for 404s
+func parseErrorPages(values []string, notFound string) (map[int]string, error) {
+	pages := map[int]string{}
+	if notFound != "" {
+		pages[http.StatusNotFound] = notFound
+	}
+	for _, value := range values {
+		code, page, ok := strings.Cut(value, "=")
+		status, err := strconv.Atoi(strings.TrimSpace(code))
+		if !ok || err != nil || status < 400 || status > 599 || strings.TrimSpace(page) == "" {
+			return nil, fmt.Errorf("invalid error page %q (expected status=page, e.g. 500=errors/500.html)", value)
+		}
+		pages[status] = strings.TrimSpace(page)
+	}
+	return pages, nil
+}
+
+// Middleware that replaces the body of error responses with custom error pages.
+// The pages map status codes to paths in the file system. The status code of the
+// response is preserved, and pages that do not exist are ignored.
+func errorPages(fsys http.FileSystem, pages map[int]string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ew := &errorPageWriter{ResponseWriter: w, fsys: fsys, pages: pages}
+		next.ServeHTTP(ew, r)
+		if ew.page != nil {
+			logDetail(r, "Serving the error page %s for the %d response", ew.pages[ew.status], ew.status)
+			defer ew.page.Close()
+			if r.Method != http.MethodHead {
+				io.Copy(w, ew.page)
+			}
+		}
+	})
+}
+
+// A ResponseWriter that intercepts error responses that have a custom error page
+type errorPageWriter struct {
+	http.ResponseWriter
+	fsys        http.FileSystem // The file system to read the error pages from
+	pages       map[int]string  // The error pages by status code
+	page        http.File       // The error page to respond with (nil if not intercepted)
+	status      int             // The status code of the response
+	wroteHeader bool            // Whether the header has been written
+}
+
+// Write the header, swapping in the custom error page if there is one for the status
+func (ew *errorPageWriter) WriteHeader(status int) {
+	if ew.wroteHeader {
+		return
+	}
+	ew.wroteHeader = true
+	ew.status = status
+
+	if name, ok := ew.pages[status]; ok {
+		if page, err := ew.fsys.Open(path.Join("/", name)); err == nil {
+			if info, err := page.Stat(); err == nil && !info.IsDir() {
+				ew.page = page
+				h := ew.Header()
+				for _, header := range []string{"Content-Length", "Content-Encoding", "X-Content-Type-Options", "ETag", "Last-Modified"} {
+					h.Del(header)
+				}
+				h.Set("Content-Type", pageContentType(name))
+			} else {
+				page.Close()
+			}
+		}
+	}
+
+	ew.ResponseWriter.WriteHeader(status)
+}
+
+// Write the body, discarding it if the response was replaced by an error page
+func (ew *errorPageWriter) Write(b []byte) (int, error) {
+	ew.WriteHeader(http.StatusOK)
+	if ew.page != nil {
+		return len(b), nil
+	}
+	return ew.ResponseWriter.Write(b)
+}
+
+// Unwrap the underlying ResponseWriter (for http.ResponseController)
+func (ew *errorPageWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// The content type of the error page, based on its extension (defaulting to HTML)
+func pageContentType(name string) string {
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		return contentType
+	}
+	return "text/html; charset=utf-8"
+}
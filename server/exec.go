@@ -0,0 +1,97 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ===========
+// EXEC ROUTES
+// ===========
+
+// A route that responds with the output of an external command
+type execRoute struct {
+	path    string   // The path of the route (e.g. `/build-info`)
+	command []string // The command and its arguments (e.g. `./scripts/build-info.sh`)
+}
+
+// Parse an --exec value (in the form `/path=command args...`) into an exec route
+func parseExecRoute(value string) (execRoute, error) {
+	urlPath, command, ok := strings.Cut(value, "=")
+	urlPath = strings.TrimSpace(urlPath)
+	args := strings.Fields(command)
+	if !ok || !strings.HasPrefix(urlPath, "/") || len(args) == 0 {
+		return execRoute{}, fmt.Errorf("invalid exec route %q (expected /path=command, e.g. /build-info=./scripts/build-info.sh)", value)
+	}
+	return execRoute{path: strings.TrimSuffix(urlPath, "/"), command: args}, nil
+}
+
+// Middleware that runs the routes' commands for requests to their paths (or below them), and
+// responds with the command's standard output. The request body is passed on the standard
+// input, and the request details in CGI-style environment variables (e.g. `REQUEST_METHOD`,
+// `QUERY_STRING`, `PATH_INFO` and `HTTP_USER_AGENT`). Commands that fail respond with a 500.
+func execRoutes(routes []execRoute, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, route := range routes {
+			rest, ok := strings.CutPrefix(r.URL.Path, route.path)
+			if ok && (rest == "" || strings.HasPrefix(rest, "/")) {
+				route.serve(w, r, rest)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Run the command for the request, and respond with its output
+func (route execRoute) serve(w http.ResponseWriter, r *http.Request, pathInfo string) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(r.Context(), route.command[0], route.command[1:]...)
+	cmd.Env = append(os.Environ(), execEnv(r, pathInfo)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = r.Body, &stdout, &stderr
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(r.Context().Err(), context.Canceled) {
+			return // The client went away
+		}
+		requestLogger(r).Printf("Could not run %s: %v\n", route.command[0], err)
+		if stderr.Len() > 0 {
+			requestLogger(r).Println(strings.TrimSpace(stderr.String()))
+		}
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", http.DetectContentType(stdout.Bytes()))
+	w.Header().Set("Cache-Control", "no-store") // The output may differ every time
+	w.Write(stdout.Bytes())
+}
+
+// The environment variables describing the request to the command
+func execEnv(r *http.Request, pathInfo string) []string {
+	env := []string{
+		"REQUEST_METHOD=" + r.Method,
+		"REQUEST_URI=" + r.URL.RequestURI(),
+		"QUERY_STRING=" + r.URL.RawQuery,
+		"PATH_INFO=" + pathInfo,
+		"REMOTE_ADDR=" + r.RemoteAddr,
+		"CONTENT_TYPE=" + r.Header.Get("Content-Type"),
+	}
+	if r.ContentLength >= 0 {
+		env = append(env, fmt.Sprintf("CONTENT_LENGTH=%d", r.ContentLength))
+	}
+	for name, values := range r.Header {
+		name = strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		if name == "PROXY" {
+			continue // Guard against httpoxy (CVE-2016-5385)
+		}
+		env = append(env, "HTTP_"+name+"="+strings.Join(values, ", "))
+	}
+	return env
+}
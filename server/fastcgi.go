@@ -0,0 +1,332 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/textproto"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =======
+// FASTCGI
+// =======
+
+// A route that hands the scripts under a path prefix off to a FastCGI responder (e.g. php-fpm)
+type fastCGIRoute struct {
+	prefix  string   // The path prefix of the route (e.g. `/app`)
+	network string   // The network of the responder (`tcp` or `unix`)
+	address string   // The address of the responder (e.g. `127.0.0.1:9000` or `/run/php-fpm.sock`)
+	exts    []string // The extensions of the scripts to hand off (e.g. `.php`)
+}
+
+// Parse a --fastcgi value (in the form `/prefix=host:port` or `/prefix=unix:/path/to.sock`,
+// optionally followed by `;ext=.php,.phtml`) into a FastCGI route
+func parseFastCGIRoute(value string) (fastCGIRoute, error) {
+	options := strings.Split(value, ";")
+	prefix, address, ok := strings.Cut(options[0], "=")
+	prefix, address = strings.TrimSpace(prefix), strings.TrimSpace(address)
+	if !ok || !strings.HasPrefix(prefix, "/") || address == "" {
+		return fastCGIRoute{}, fmt.Errorf("invalid fastcgi route %q (expected /prefix=address, e.g. /app=127.0.0.1:9000)", value)
+	}
+
+	route := fastCGIRoute{prefix: strings.TrimSuffix(prefix, "/"), network: "tcp", address: address, exts: []string{".php"}}
+	if socket, ok := strings.CutPrefix(address, "unix:"); ok {
+		route.network, route.address = "unix", socket
+	}
+	for _, option := range options[1:] {
+		key, val, _ := strings.Cut(strings.TrimSpace(option), "=")
+		if strings.TrimSpace(key) != "ext" {
+			return fastCGIRoute{}, fmt.Errorf("invalid fastcgi option %q (expected ext=.php)", option)
+		}
+		route.exts = nil
+		for _, ext := range strings.Split(val, ",") {
+			if ext = strings.TrimSpace(ext); ext != "" {
+				route.exts = append(route.exts, "."+strings.TrimPrefix(ext, "."))
+			}
+		}
+	}
+	return route, nil
+}
+
+// Middleware that hands requests for scripts under the routes' prefixes off to their FastCGI
+// responders, with the script's path in the served directory (root), or in the directory mounted at
+// its prefix, as the SCRIPT_FILENAME. Everything else (like static assets) is served by the next handler.
+func fastCGI(routes []fastCGIRoute, root string, mounts []mount, fsys http.FileSystem, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, route := range routes {
+			rest, ok := strings.CutPrefix(r.URL.Path, route.prefix)
+			if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+				continue
+			}
+			if script, pathInfo, ok := route.resolveScript(fsys, r.URL.Path); ok {
+				dir, name := resolveMount(mounts, root, script)
+				route.serve(w, r, root, script, filepath.Join(dir, filepath.FromSlash(name)), pathInfo)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Find the script for the URL path: the first file along the path (with the rest as the
+// PATH_INFO, e.g. `/app/index.php/users`), or the directory's index (e.g. `/app/index.php`)
+func (route fastCGIRoute) resolveScript(fsys http.FileSystem, urlPath string) (script, pathInfo string, ok bool) {
+	segments := strings.Split(strings.TrimPrefix(urlPath, "/"), "/")
+	for i := range segments {
+		candidate := "/" + strings.Join(segments[:i+1], "/")
+		info, err := stat(fsys, candidate)
+		if err != nil {
+			return "", "", false
+		}
+		if info.IsDir() {
+			continue
+		}
+		if !route.isScript(candidate) {
+			return "", "", false // A static file
+		}
+		return candidate, strings.TrimPrefix(urlPath, candidate), true
+	}
+
+	// The directory's index script
+	for _, ext := range route.exts {
+		index := path.Join(urlPath, "index"+ext)
+		if info, err := stat(fsys, index); err == nil && !info.IsDir() {
+			return index, "", true
+		}
+	}
+	return "", "", false
+}
+
+// Boolean indicating whether the file has one of the route's script extensions
+func (route fastCGIRoute) isScript(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	for _, scriptExt := range route.exts {
+		if ext == scriptExt {
+			return true
+		}
+	}
+	return false
+}
+
+// Hand the request for the script (at the filename on disk) off to the responder, and relay its response
+func (route fastCGIRoute) serve(w http.ResponseWriter, r *http.Request, root, script, filename, pathInfo string) {
+	conn, err := net.DialTimeout(route.network, route.address, 5*time.Second)
+	if err != nil {
+		requestLogger(r).Println("Could not connect to the FastCGI responder:", err)
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+	defer conn.Close()
+	go func() {
+		<-r.Context().Done()
+		conn.Close() // Abort when the client goes away
+	}()
+
+	// Send the request (and its body), then relay the response
+	err = writeFastCGIRequest(conn, fastCGIParams(r, root, script, filename, pathInfo))
+	if err == nil {
+		err = writeFastCGIStream(conn, fcgiStdin, r.Body)
+	}
+	if err != nil {
+		requestLogger(r).Println("Could not send the request to the FastCGI responder:", err)
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+
+	stdout, stdoutWriter := io.Pipe()
+	defer stdout.Close() // So that the copying stops, if the response is not read to the end
+	go func() {
+		stdoutWriter.CloseWithError(readFastCGIResponse(conn, stdoutWriter, requestLogger(r)))
+	}()
+	if err := writeCGIResponse(w, stdout); err != nil {
+		requestLogger(r).Println("Could not read the response of the FastCGI responder:", err)
+	}
+}
+
+// The CGI parameters for the request (see RFC 3875)
+func fastCGIParams(r *http.Request, root, script, filename, pathInfo string) map[string]string {
+	host, port, _ := net.SplitHostPort(r.Host)
+	if host == "" {
+		host = r.Host
+	}
+	remoteAddr, remotePort, _ := net.SplitHostPort(r.RemoteAddr)
+	params := map[string]string{
+		"GATEWAY_INTERFACE": "CGI/1.1",
+		"SERVER_SOFTWARE":   "self-serve/" + VERSION,
+		"SERVER_PROTOCOL":   r.Proto,
+		"SERVER_NAME":       host,
+		"SERVER_PORT":       port,
+		"REQUEST_METHOD":    r.Method,
+		"REQUEST_URI":       r.URL.RequestURI(),
+		"QUERY_STRING":      r.URL.RawQuery,
+		"DOCUMENT_ROOT":     root,
+		"SCRIPT_NAME":       script,
+		"SCRIPT_FILENAME":   filename,
+		"PATH_INFO":         pathInfo,
+		"REMOTE_ADDR":       remoteAddr,
+		"REMOTE_PORT":       remotePort,
+		"CONTENT_TYPE":      r.Header.Get("Content-Type"),
+		"CONTENT_LENGTH":    "",
+	}
+	if r.ContentLength >= 0 {
+		params["CONTENT_LENGTH"] = strconv.FormatInt(r.ContentLength, 10)
+	}
+	if r.TLS != nil {
+		params["HTTPS"] = "on"
+	}
+	for name, values := range r.Header {
+		name = strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		if name == "PROXY" {
+			continue // Guard against httpoxy (CVE-2016-5385)
+		}
+		params["HTTP_"+name] = strings.Join(values, ", ")
+	}
+	return params
+}
+
+// Relay a CGI-style response (headers, with an optional `Status` header, and the body)
+func writeCGIResponse(w http.ResponseWriter, response io.Reader) error {
+	reader := bufio.NewReader(response)
+	header, err := textproto.NewReader(reader).ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return err
+	}
+
+	status := http.StatusOK
+	if value := header.Get("Status"); value != "" {
+		code, _, _ := strings.Cut(value, " ")
+		if status, err = strconv.Atoi(code); err != nil {
+			http.Error(w, "Bad Gateway", http.StatusBadGateway)
+			return fmt.Errorf("invalid status %q", value)
+		}
+		header.Del("Status")
+	} else if header.Get("Location") != "" {
+		status = http.StatusFound
+	}
+	for name, values := range header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(status)
+	_, err = io.Copy(w, reader)
+	return err
+}
+
+// ----------------
+// FASTCGI PROTOCOL
+// ----------------
+
+// The FastCGI record types (see the FastCGI specification)
+const (
+	fcgiBeginRequest = 1
+	fcgiEndRequest   = 3
+	fcgiParams       = 4
+	fcgiStdin        = 5
+	fcgiStdout       = 6
+	fcgiStderr       = 7
+)
+
+// The id of the (only) request sent on each connection
+const fcgiRequestID = 1
+
+// The largest content of a single record
+const fcgiMaxContent = 65535
+
+// Write a FastCGI record of the type with the content
+func writeFastCGIRecord(w io.Writer, recordType uint8, content []byte) error {
+	header := [8]byte{1, recordType}
+	binary.BigEndian.PutUint16(header[2:], fcgiRequestID)
+	binary.BigEndian.PutUint16(header[4:], uint16(len(content)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(content)
+	return err
+}
+
+// Write the start of a request for the responder role, with the parameters
+func writeFastCGIRequest(w io.Writer, params map[string]string) error {
+	const responderRole = 1
+	begin := []byte{0, responderRole, 0, 0, 0, 0, 0, 0} // Close the connection after the request
+	if err := writeFastCGIRecord(w, fcgiBeginRequest, begin); err != nil {
+		return err
+	}
+
+	var encoded []byte
+	for name, value := range params {
+		encoded = appendFastCGILength(encoded, len(name))
+		encoded = appendFastCGILength(encoded, len(value))
+		encoded = append(encoded, name...)
+		encoded = append(encoded, value...)
+	}
+	return writeFastCGIStream(w, fcgiParams, strings.NewReader(string(encoded)))
+}
+
+// Write the stream as records of the type, followed by the empty record that ends the stream
+func writeFastCGIStream(w io.Writer, recordType uint8, stream io.Reader) error {
+	buffer := make([]byte, fcgiMaxContent)
+	for {
+		n, err := stream.Read(buffer)
+		if n > 0 {
+			if err := writeFastCGIRecord(w, recordType, buffer[:n]); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return writeFastCGIRecord(w, recordType, nil)
+}
+
+// Append the length of a name or value, in one byte if short or four bytes otherwise
+func appendFastCGILength(b []byte, length int) []byte {
+	if length < 128 {
+		return append(b, byte(length))
+	}
+	return binary.BigEndian.AppendUint32(b, uint32(length)|1<<31)
+}
+
+// Read the response records until the end of the request, writing the standard output
+// to stdout and logging the standard error to the logger
+func readFastCGIResponse(r io.Reader, stdout io.Writer, logger *log.Logger) error {
+	reader := bufio.NewReader(r)
+	var header [8]byte
+	for {
+		if _, err := io.ReadFull(reader, header[:]); err != nil {
+			return err
+		}
+		length := binary.BigEndian.Uint16(header[4:])
+		content := make([]byte, int(length)+int(header[6])) // Including the padding
+		if _, err := io.ReadFull(reader, content); err != nil {
+			return err
+		}
+		content = content[:length]
+
+		switch header[1] {
+		case fcgiStdout:
+			if _, err := stdout.Write(content); err != nil {
+				return err
+			}
+		case fcgiStderr:
+			if len(content) > 0 {
+				logger.Println("FastCGI:", strings.TrimSpace(string(content)))
+			}
+		case fcgiEndRequest:
+			return io.EOF
+		}
+	}
+}
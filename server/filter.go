@@ -0,0 +1,132 @@
+package server
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// ======
+// FILTER
+// ======
+
+// A file system that hides the files for which the hide function returns true.
+// Hidden files cannot be opened, and are omitted from directory listings.
+type filteredFS struct {
+	http.FileSystem
+	hide func(name string) bool // Reports whether the file (a slash separated path) should be hidden
+}
+
+// Open the named file, unless it (or one of its parent directories) is hidden
+func (fsys filteredFS) Open(name string) (http.File, error) {
+	name = path.Clean("/" + name)
+	for dir := name; dir != "/"; dir = path.Dir(dir) {
+		if fsys.hide(dir) {
+			return nil, fs.ErrNotExist
+		}
+	}
+	file, err := fsys.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return filteredFile{File: file, name: name, hide: fsys.hide}, nil
+}
+
+// A file whose directory listing omits hidden files
+type filteredFile struct {
+	http.File
+	name string                 // The path of the file
+	hide func(name string) bool // Reports whether a file should be hidden
+}
+
+// Read the directory entries, omitting the hidden ones
+func (f filteredFile) Readdir(count int) ([]fs.FileInfo, error) {
+	infos, err := f.File.Readdir(count)
+	visible := infos[:0]
+	for _, info := range infos {
+		if !f.hide(path.Join(f.name, info.Name())) {
+			visible = append(visible, info)
+		}
+	}
+	return visible, err
+}
+
+// Boolean indicating whether the file (a slash separated path) is hidden by the --hide-dotfiles
+// or --exclude filters
+func (s *Self) isHidden(name string) bool {
+	return (s.hideDotfiles && isDotfile(name)) || (s.exclude != nil && s.exclude(name))
+}
+
+// -----------------
+// FILTER PREDICATES
+// -----------------
+
+// Boolean indicating whether the file is a dotfile (e.g. `.git`, `.env` or `.DS_Store`).
+// The `.well-known` directory is not considered a dotfile.
+func isDotfile(name string) bool {
+	base := path.Base(name)
+	return strings.HasPrefix(base, ".") && base != ".well-known"
+}
+
+// Create a predicate that reports whether the file matches any of the glob patterns.
+// Patterns without a slash (like `node_modules` or `*.map`) are matched against the
+// name of the file, and patterns with a slash (like `docs/drafts/*`) against its path,
+// where `**` matches any number of directories (like `dist/**`).
+func globPatterns(patterns []string) (func(name string) bool, error) {
+	for _, pattern := range patterns {
+		if _, err := path.Match(strings.ReplaceAll(strings.Trim(pattern, "/"), "**", "*"), ""); err != nil {
+			return nil, fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+		}
+	}
+	return func(name string) bool {
+		for _, pattern := range patterns {
+			pattern = strings.Trim(pattern, "/")
+			if !strings.Contains(pattern, "/") {
+				if matched, _ := path.Match(pattern, path.Base(name)); matched {
+					return true
+				}
+			} else if matchGlob(strings.Split(pattern, "/"), strings.Split(strings.Trim(name, "/"), "/")) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// Create a predicate that reports the file at the exact (slash separated) path as excluded,
+// in addition to the ones the exclude predicate (if any) reports
+func excludePath(exclude func(name string) bool, excluded string) func(name string) bool {
+	excluded = path.Clean("/" + excluded)
+	return func(name string) bool {
+		return path.Clean("/"+name) == excluded || (exclude != nil && exclude(name))
+	}
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Boolean indicating whether the path segments match the pattern segments,
+// where a `**` segment matches any number of path segments
+func matchGlob(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchGlob(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+		return false
+	}
+	return matchGlob(pattern[1:], segments[1:])
+}
@@ -0,0 +1,60 @@
+package server
+
+import "testing"
+
+func TestGlobPatterns(t *testing.T) {
+	exclude, err := globPatterns([]string{"node_modules", "*.map", "docs/drafts/*", "dist/**"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		excluded bool
+	}{
+		{name: "/node_modules", excluded: true},
+		{name: "/lib/node_modules", excluded: true},
+		{name: "/app.js.map", excluded: true},
+		{name: "/js/app.js.map", excluded: true},
+		{name: "/app.js", excluded: false},
+		{name: "/docs/drafts/post.md", excluded: true},
+		{name: "/docs/drafts", excluded: false},
+		{name: "/docs/post.md", excluded: false},
+		{name: "/dist", excluded: true},
+		{name: "/dist/js/app.js", excluded: true},
+		{name: "/src/dist/app.js", excluded: false},
+	}
+	for _, tt := range tests {
+		if got := exclude(tt.name); got != tt.excluded {
+			t.Errorf("excluded(%q) = %v, want %v", tt.name, got, tt.excluded)
+		}
+	}
+
+	if _, err := globPatterns([]string{"[invalid"}); err == nil {
+		t.Errorf("globPatterns accepted an invalid pattern")
+	}
+}
+
+func TestExcludePath(t *testing.T) {
+	globs, err := globPatterns([]string{"*.map"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		exclude  func(name string) bool
+		name     string
+		excluded bool
+	}{
+		{exclude: excludePath(nil, "/selfserve.yaml"), name: "/selfserve.yaml", excluded: true},
+		{exclude: excludePath(nil, "/selfserve.yaml"), name: "selfserve.yaml", excluded: true},
+		{exclude: excludePath(nil, "/selfserve.yaml"), name: "/sub/selfserve.yaml", excluded: false},
+		{exclude: excludePath(nil, "/config/[prod].yaml"), name: "/config/[prod].yaml", excluded: true},
+		{exclude: excludePath(nil, "/config/[prod].yaml"), name: "/config/p.yaml", excluded: false},
+		{exclude: excludePath(globs, "/selfserve.yaml"), name: "/app.js.map", excluded: true},
+		{exclude: excludePath(globs, "/selfserve.yaml"), name: "/app.js", excluded: false},
+	}
+	for _, tt := range tests {
+		if got := tt.exclude(tt.name); got != tt.excluded {
+			t.Errorf("excluded(%q) = %v, want %v", tt.name, got, tt.excluded)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// =============
+// HAR RECORDING
+// =============
+
+// Records the requests and their responses, to write them out as an HTTP Archive (HAR) on shutdown,
+// for replaying or analyzing a session in the browser's devtools (or other HAR tooling)
+type harRecorder struct {
+	path string // The path of the HAR file to write
+
+	mu        sync.Mutex
+	exchanges []*exchange // The recorded exchanges, in the order they completed
+}
+
+// Middleware that records the requests and their responses
+func (h *harRecorder) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ex := captureExchange(w, r, next)
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.exchanges = append(h.exchanges, ex)
+	})
+}
+
+// Write out the recorded exchanges to the HAR file
+func (h *harRecorder) save() error {
+	h.mu.Lock()
+	entries := make([]harEntry, 0, len(h.exchanges))
+	for _, ex := range h.exchanges {
+		entries = append(entries, newHAREntry(ex))
+	}
+	h.mu.Unlock()
+	slices.SortStableFunc(entries, func(a, b harEntry) int { return a.StartedDateTime.Compare(b.StartedDateTime) })
+
+	data, err := json.MarshalIndent(harFile{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "self-serve", Version: VERSION},
+		Entries: entries,
+	}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(h.path, data, 0o644)
+}
+
+// ----------
+// HAR FORMAT
+// ----------
+
+// The HTTP Archive format (http://www.softwareishard.com/blog/har-12-spec/)
+type (
+	harFile struct {
+		Log harLog `json:"log"`
+	}
+	harLog struct {
+		Version string     `json:"version"`
+		Creator harCreator `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	}
+	harCreator struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	harEntry struct {
+		StartedDateTime time.Time   `json:"startedDateTime"`
+		Time            float64     `json:"time"`
+		Request         harRequest  `json:"request"`
+		Response        harResponse `json:"response"`
+		Cache           struct{}    `json:"cache"`
+		Timings         harTimings  `json:"timings"`
+		Comment         string      `json:"comment,omitempty"`
+	}
+	harRequest struct {
+		Method      string         `json:"method"`
+		URL         string         `json:"url"`
+		HTTPVersion string         `json:"httpVersion"`
+		Cookies     []harNameValue `json:"cookies"`
+		Headers     []harNameValue `json:"headers"`
+		QueryString []harNameValue `json:"queryString"`
+		PostData    *harPostData   `json:"postData,omitempty"`
+		HeadersSize int            `json:"headersSize"`
+		BodySize    int64          `json:"bodySize"`
+	}
+	harResponse struct {
+		Status      int            `json:"status"`
+		StatusText  string         `json:"statusText"`
+		HTTPVersion string         `json:"httpVersion"`
+		Cookies     []harNameValue `json:"cookies"`
+		Headers     []harNameValue `json:"headers"`
+		Content     harContent     `json:"content"`
+		RedirectURL string         `json:"redirectURL"`
+		HeadersSize int            `json:"headersSize"`
+		BodySize    int64          `json:"bodySize"`
+	}
+	harNameValue struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	harPostData struct {
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+		Encoding string `json:"encoding,omitempty"` // Not in the spec, but understood by the devtools for binary bodies
+	}
+	harContent struct {
+		Size     int64  `json:"size"`
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text,omitempty"`
+		Encoding string `json:"encoding,omitempty"`
+		Comment  string `json:"comment,omitempty"`
+	}
+	harTimings struct {
+		Send    float64 `json:"send"`
+		Wait    float64 `json:"wait"`
+		Receive float64 `json:"receive"`
+	}
+)
+
+// Convert the exchange to an entry of the HAR file
+func newHAREntry(ex *exchange) harEntry {
+	scheme := "http"
+	if ex.tls {
+		scheme = "https"
+	}
+	requestURL := scheme + "://" + ex.host + ex.URL
+
+	entry := harEntry{
+		StartedDateTime: ex.Time,
+		Time:            ex.Duration,
+		Request: harRequest{
+			Method:      ex.Method,
+			URL:         requestURL,
+			HTTPVersion: ex.Proto,
+			Cookies:     harCookies(ex.RequestHeaders),
+			Headers:     harHeaders(ex.RequestHeaders),
+			QueryString: harQueryString(ex.URL),
+			HeadersSize: -1,
+			BodySize:    ex.RequestSize,
+		},
+		Response: harResponse{
+			Status:      ex.Status,
+			StatusText:  http.StatusText(ex.Status),
+			HTTPVersion: ex.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(ex.ResponseHeaders),
+			RedirectURL: ex.ResponseHeaders.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    ex.ResponseSize,
+		},
+		Timings: harTimings{Wait: ex.Duration},
+		Comment: ex.RequestID,
+	}
+
+	if ex.RequestSize > 0 {
+		body, headers := ex.body(false)
+		text, encoding := harText(body)
+		entry.Request.PostData = &harPostData{MimeType: headers.Get("Content-Type"), Text: text, Encoding: encoding}
+	}
+	body, headers := ex.body(true)
+	entry.Response.Content = harContent{Size: int64(len(body)), MimeType: headers.Get("Content-Type")}
+	entry.Response.Content.Text, entry.Response.Content.Encoding = harText(body)
+	if int64(len(ex.responseBody)) < ex.ResponseSize {
+		entry.Response.Content.Size = ex.ResponseSize
+		entry.Response.Content.Comment = "Truncated to the first 64 KB"
+	}
+	return entry
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// The headers as name-value pairs, sorted by name
+func harHeaders(headers http.Header) []harNameValue {
+	pairs := []harNameValue{}
+	for _, name := range slices.Sorted(maps.Keys(headers)) {
+		for _, value := range headers[name] {
+			pairs = append(pairs, harNameValue{name, value})
+		}
+	}
+	return pairs
+}
+
+// The cookies of the request headers, as name-value pairs
+func harCookies(headers http.Header) []harNameValue {
+	pairs := []harNameValue{}
+	for _, cookie := range (&http.Request{Header: headers}).Cookies() {
+		pairs = append(pairs, harNameValue{cookie.Name, cookie.Value})
+	}
+	return pairs
+}
+
+// The query parameters of the URL, as name-value pairs
+func harQueryString(rawURL string) []harNameValue {
+	pairs := []harNameValue{}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return pairs
+	}
+	for _, param := range strings.Split(u.RawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(param, "=")
+		name, _ = url.QueryUnescape(name)
+		value, _ = url.QueryUnescape(value)
+		pairs = append(pairs, harNameValue{name, value})
+	}
+	return pairs
+}
+
+// The body as text, or base64-encoded (with the encoding) if it is binary
+func harText(body []byte) (text string, encoding string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
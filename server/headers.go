@@ -0,0 +1,163 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// =======
+// HEADERS
+// =======
+
+// A custom header to set on responses whose path matches the pattern
+type headerRule struct {
+	pattern *regexp.Regexp // The path pattern the rule applies to (nil for all paths)
+	name    string         // The header name
+	value   string         // The header value
+}
+
+// Parse a --header value: either `Name: value` for all responses,
+// or `/path/pattern:Name=value` for responses whose path matches the pattern
+func parseHeaderRule(rule string) (headerRule, error) {
+	if strings.HasPrefix(rule, "/") {
+		pattern, header, ok := strings.Cut(rule, ":")
+		name, value, found := strings.Cut(header, "=")
+		if !ok || !found || strings.TrimSpace(name) == "" {
+			return headerRule{}, fmt.Errorf("invalid header %q (expected /path/pattern:Name=value)", rule)
+		}
+		return headerRule{compilePathPattern(pattern), strings.TrimSpace(name), strings.TrimSpace(value)}, nil
+	}
+
+	name, value, ok := strings.Cut(rule, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return headerRule{}, fmt.Errorf("invalid header %q (expected Name: value)", rule)
+	}
+	return headerRule{nil, strings.TrimSpace(name), strings.TrimSpace(value)}, nil
+}
+
+// Parse all the --header values
+func parseHeaderRules(rules []string) ([]headerRule, error) {
+	parsed := make([]headerRule, 0, len(rules))
+	for _, rule := range rules {
+		headerRule, err := parseHeaderRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, headerRule)
+	}
+	return parsed, nil
+}
+
+// ---------------------
+// NETLIFY _HEADERS FILE
+// ---------------------
+
+// The name of the Netlify-style headers file in the served directory
+const headersFileName = "_headers"
+
+// Load the header rules from the Netlify-style `_headers` file at the root of the file system.
+// Returns no rules if the file does not exist.
+//
+//	/path/*
+//	  X-Frame-Options: DENY
+//	  # Comments are ignored
+//	  Access-Control-Allow-Origin: *
+func loadHeadersFile(fsys http.FileSystem) ([]headerRule, error) {
+	file, err := fsys.Open("/" + headersFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules []headerRule
+	var pattern *regexp.Regexp
+	byName := map[string]int{} // Index of the rule for each header of the current path
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "/"):
+			pattern, byName = compilePathPattern(line), map[string]int{}
+		case pattern == nil:
+			return nil, fmt.Errorf("%s:%d: header %q is not under a path", headersFileName, lineNumber, line)
+		default:
+			name, value, ok := strings.Cut(line, ":")
+			if !ok {
+				return nil, fmt.Errorf("%s:%d: invalid header %q (expected Name: value)", headersFileName, lineNumber, line)
+			}
+			name, value = http.CanonicalHeaderKey(strings.TrimSpace(name)), strings.TrimSpace(value)
+			// Repeated headers for the same path are combined into one
+			if i, exists := byName[name]; exists {
+				rules[i].value += ", " + value
+				continue
+			}
+			byName[name] = len(rules)
+			rules = append(rules, headerRule{pattern, name, value})
+		}
+	}
+	return rules, scanner.Err()
+}
+
+// Middleware that sets the custom headers on responses
+func customHeaders(rules []headerRule, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, rule := range rules {
+			if rule.pattern == nil || rule.pattern.MatchString(r.URL.Path) {
+				w.Header().Set(rule.name, rule.value)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Compile a path pattern into a regular expression, where `*` matches any sequence
+// of characters (including `/`) and a `:placeholder` matches a single path segment.
+// The matches are captured in groups named `splat` and `placeholder` respectively.
+func compilePathPattern(pattern string) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i, segment := range strings.Split(pattern, "/") {
+		if i > 0 {
+			expr.WriteString("/")
+		}
+		if name, ok := strings.CutPrefix(segment, ":"); ok && isPlaceholderName(name) {
+			expr.WriteString("(?P<" + name + ">[^/]+)")
+			continue
+		}
+		parts := strings.Split(segment, "*")
+		for j, part := range parts {
+			if j > 0 {
+				expr.WriteString("(?P<splat>.*)")
+			}
+			expr.WriteString(regexp.QuoteMeta(part))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
+
+// Boolean indicating whether the name can be used as a placeholder (and regexp group) name
+func isPlaceholderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
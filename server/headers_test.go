@@ -0,0 +1,39 @@
+package server
+
+import "testing"
+
+func TestCompilePathPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		matches bool
+		groups  map[string]string
+	}{
+		{pattern: "/about", path: "/about", matches: true},
+		{pattern: "/about", path: "/about/team", matches: false},
+		{pattern: "/about", path: "/aboutus", matches: false},
+		{pattern: "/*", path: "/", matches: true, groups: map[string]string{"splat": ""}},
+		{pattern: "/blog/*", path: "/blog/2024/post", matches: true, groups: map[string]string{"splat": "2024/post"}},
+		{pattern: "/blog/*", path: "/blogs/post", matches: false},
+		{pattern: "/*.css", path: "/styles/site.css", matches: true, groups: map[string]string{"splat": "styles/site"}},
+		{pattern: "/users/:id", path: "/users/42", matches: true, groups: map[string]string{"id": "42"}},
+		{pattern: "/users/:id", path: "/users/42/posts", matches: false},
+		{pattern: "/users/:id/posts/:post", path: "/users/42/posts/7", matches: true, groups: map[string]string{"id": "42", "post": "7"}},
+		{pattern: "/a.b", path: "/aXb", matches: false}, // Not a regular expression
+		{pattern: "/:not-a-name", path: "/:not-a-name", matches: true},
+		{pattern: "/:not-a-name", path: "/value", matches: false},
+	}
+	for _, tt := range tests {
+		re := compilePathPattern(tt.pattern)
+		match := re.FindStringSubmatch(tt.path)
+		if (match != nil) != tt.matches {
+			t.Errorf("compilePathPattern(%q) matches %q = %v, want %v", tt.pattern, tt.path, match != nil, tt.matches)
+			continue
+		}
+		for name, want := range tt.groups {
+			if got := match[re.SubexpIndex(name)]; got != want {
+				t.Errorf("compilePathPattern(%q) captures %s = %q from %q, want %q", tt.pattern, name, got, tt.path, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// ============
+// HEALTH CHECK
+// ============
+
+// The path of the health check endpoint
+const healthPath = "/__health"
+
+// The response of the health check
+type healthStatus struct {
+	Status  string  `json:"status"`  // Always "ok", as the server is up to respond
+	Version string  `json:"version"` // The version of self-serve
+	Uptime  float64 `json:"uptime"`  // How long the server has been up, in seconds
+	Dir     string  `json:"dir"`     // The directory being served
+}
+
+// Middleware that responds to the health check endpoint with the status of the server, ahead of
+// everything else (like authentication and logging), for the liveness probes of Docker and Kubernetes
+func healthCheck(started time.Time, dir string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != healthPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(healthStatus{
+			Status:  "ok",
+			Version: VERSION,
+			Uptime:  time.Since(started).Round(time.Millisecond).Seconds(),
+			Dir:     dir,
+		})
+	})
+}
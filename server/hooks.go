@@ -0,0 +1,107 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// =====
+// HOOKS
+// =====
+
+// A served request, as reported to the OnRequest hooks
+type RequestInfo struct {
+	ID         string        // The ID of the request (as in its X-Request-Id header)
+	Method     string        // The method of the request
+	URL        string        // The URL of the request
+	RemoteAddr string        // The address of the client
+	Status     int           // The status code of the response
+	Size       int64         // The size of the response body
+	Started    time.Time     // When the request came in
+	Duration   time.Duration // How long the response took
+}
+
+// The functions to call on the events of the server (see OnListen, OnRequest, OnError and OnShutdown)
+type hooks struct {
+	listen   []func(addr net.Addr)
+	request  []func(info RequestInfo)
+	error    []func(err error)
+	shutdown []func()
+}
+
+// Call the function with the address the server is listening on, each time it starts
+// (including the restarts). The hooks are to be added before Serve, and are called in order.
+func (s *Self) OnListen(fn func(addr net.Addr)) {
+	s.hooks.listen = append(s.hooks.listen, fn)
+}
+
+// Call the function with each request once it has been served (from the goroutine serving it)
+func (s *Self) OnRequest(fn func(info RequestInfo)) {
+	s.hooks.request = append(s.hooks.request, fn)
+}
+
+// Call the function with the errors of the server: the ones Serve returns, and the ones it logs
+// while serving (like a file watcher, tunnel or mDNS responder that could not start)
+func (s *Self) OnError(fn func(err error)) {
+	s.hooks.error = append(s.hooks.error, fn)
+}
+
+// Call the function each time the server has shut down (including for the restarts)
+func (s *Self) OnShutdown(fn func()) {
+	s.hooks.shutdown = append(s.hooks.shutdown, fn)
+}
+
+// Call the OnListen hooks
+func (s *Self) listened(addr net.Addr) {
+	for _, fn := range s.hooks.listen {
+		fn(addr)
+	}
+}
+
+// Log the error with the message, and call the OnError hooks with it
+func (s *Self) logError(message string, err error) {
+	s.logger.Println(message, err)
+	s.failed(err)
+}
+
+// Call the OnError hooks
+func (s *Self) failed(err error) {
+	for _, fn := range s.hooks.error {
+		fn(err)
+	}
+}
+
+// Call the OnShutdown hooks
+func (s *Self) shutDown() {
+	for _, fn := range s.hooks.shutdown {
+		fn()
+	}
+}
+
+// Middleware that reports the served requests to the OnRequest hooks
+func (s *Self) reportRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		lw := &loggingWriter{ResponseWriter: w}
+		next.ServeHTTP(lw, r)
+		status := lw.status
+		if status == 0 {
+			status = http.StatusOK // Nothing was written
+		}
+
+		info := RequestInfo{
+			ID:         r.Header.Get(requestIDHeader),
+			Method:     r.Method,
+			URL:        r.URL.String(),
+			RemoteAddr: r.RemoteAddr,
+			Status:     status,
+			Size:       lw.size,
+			Started:    start,
+			Duration:   time.Since(start),
+		}
+		for _, fn := range s.hooks.request {
+			fn(info)
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ========
+// HTPASSWD
+// ========
+
+// The password hashes of the users in an htpasswd file
+type htpasswd map[string]string
+
+// Load the users from an htpasswd file (in the form `user:hash`, one per line), as created by
+// `htpasswd -B` (bcrypt), `htpasswd -m` (MD5-crypt) or `htpasswd -s` (SHA-1)
+func loadHtpasswd(name string) (htpasswd, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	users := htpasswd{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(text, ":")
+		if !ok || user == "" || !isSupportedHash(hash) {
+			return nil, fmt.Errorf("%s:%d: invalid entry (expected user:hash, with a bcrypt, MD5-crypt or SHA-1 hash)", name, line)
+		}
+		users[user] = hash
+	}
+	return users, scanner.Err()
+}
+
+// Boolean indicating whether the password matches the user's hash
+func (users htpasswd) verify(user, password string) bool {
+	hash, ok := users[user]
+	if !ok {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case strings.HasPrefix(hash, "$apr1$"):
+		return constantTimeEqual(md5Crypt(password, hash, "$apr1$"), hash)
+	case strings.HasPrefix(hash, "$1$"):
+		return constantTimeEqual(md5Crypt(password, hash, "$1$"), hash)
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		return constantTimeEqual("{SHA}"+base64.StdEncoding.EncodeToString(sum[:]), hash)
+	}
+	return false
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Boolean indicating whether the hash is in one of the supported formats
+func isSupportedHash(hash string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$", "$apr1$", "$1$", "{SHA}"} {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// The alphabet of the MD5-crypt encoding
+const md5CryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Hash the password with MD5-crypt (`$1$`) or Apache's variant (`$apr1$`), using the salt
+// of the existing hash (in the form `<magic><salt>$<digest>`)
+func md5Crypt(password, hash, magic string) string {
+	salt := strings.TrimPrefix(hash, magic)
+	salt, _, _ = strings.Cut(salt, "$")
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+
+	alternate := md5.Sum([]byte(password + salt + password))
+	digest := md5.New()
+	digest.Write([]byte(password + magic + salt))
+	for i := len(password); i > 0; i -= 16 {
+		digest.Write(alternate[:min(i, 16)])
+	}
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			digest.Write([]byte{0})
+		} else {
+			digest.Write([]byte{password[0]})
+		}
+	}
+	final := digest.Sum(nil)
+
+	// Stretch the hash, to slow down brute forcing
+	for i := 0; i < 1000; i++ {
+		round := md5.New()
+		if i&1 != 0 {
+			round.Write([]byte(password))
+		} else {
+			round.Write(final)
+		}
+		if i%3 != 0 {
+			round.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			round.Write([]byte(password))
+		}
+		if i&1 != 0 {
+			round.Write(final)
+		} else {
+			round.Write([]byte(password))
+		}
+		final = round.Sum(nil)
+	}
+
+	// Encode the bytes in the (shuffled) order of the algorithm
+	var encoded strings.Builder
+	encode := func(value uint, n int) {
+		for ; n > 0; n-- {
+			encoded.WriteByte(md5CryptAlphabet[value&0x3f])
+			value >>= 6
+		}
+	}
+	for _, group := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(uint(final[group[0]])<<16|uint(final[group[1]])<<8|uint(final[group[2]]), 4)
+	}
+	encode(uint(final[11]), 2)
+	return magic + salt + "$" + encoded.String()
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMD5Crypt(t *testing.T) {
+	// The hashes of `openssl passwd -1` and `openssl passwd -apr1`
+	tests := []struct {
+		password string
+		hash     string
+		magic    string
+	}{
+		{password: "password", hash: "$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/", magic: "$1$"},
+		{password: "", hash: "$1$ab$rn6aQS/o7141mj179E/zA.", magic: "$1$"},
+		{password: "password", hash: "$apr1$xxxxxxxx$dxHfLAsjHkDRmG83UXe8K0", magic: "$apr1$"},
+	}
+	for _, tt := range tests {
+		if got := md5Crypt(tt.password, tt.hash, tt.magic); got != tt.hash {
+			t.Errorf("md5Crypt(%q, %q) = %q, want %q", tt.password, tt.hash, got, tt.hash)
+		}
+	}
+}
+
+func TestHtpasswdVerify(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := htpasswd{
+		"md5":    "$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/",
+		"apr1":   "$apr1$xxxxxxxx$dxHfLAsjHkDRmG83UXe8K0",
+		"sha":    "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", // password
+		"bcrypt": string(bcryptHash),
+		"plain":  "password",
+	}
+	tests := []struct {
+		user     string
+		password string
+		valid    bool
+	}{
+		{user: "md5", password: "password", valid: true},
+		{user: "md5", password: "Password", valid: false},
+		{user: "apr1", password: "password", valid: true},
+		{user: "apr1", password: "", valid: false},
+		{user: "sha", password: "password", valid: true},
+		{user: "sha", password: "wrong", valid: false},
+		{user: "bcrypt", password: "secret", valid: true},
+		{user: "bcrypt", password: "password", valid: false},
+		{user: "plain", password: "password", valid: false}, // Plain text passwords are not supported
+		{user: "nobody", password: "password", valid: false},
+	}
+	for _, tt := range tests {
+		if got := users.verify(tt.user, tt.password); got != tt.valid {
+			t.Errorf("verify(%q, %q) = %v, want %v", tt.user, tt.password, got, tt.valid)
+		}
+	}
+}
+
+func TestLoadHtpasswd(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		users int
+		err   bool
+	}{
+		{name: "users", file: "# users\nalice:$apr1$xxxxxxxx$dxHfLAsjHkDRmG83UXe8K0\n\nbob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n", users: 2},
+		{name: "plain text", file: "alice:password\n", err: true},
+		{name: "no hash", file: "alice\n", err: true},
+		{name: "no user", file: ":$1$saltsalt$qjXMvbEw8oaL.CzflDtaK/\n", err: true},
+	}
+	for _, tt := range tests {
+		name := filepath.Join(t.TempDir(), ".htpasswd")
+		if err := os.WriteFile(name, []byte(tt.file), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		users, err := loadHtpasswd(name)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: loadHtpasswd succeeded, want an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: loadHtpasswd failed: %v", tt.name, err)
+		} else if len(users) != tt.users {
+			t.Errorf("%s: loadHtpasswd loaded %d users, want %d", tt.name, len(users), tt.users)
+		}
+	}
+}
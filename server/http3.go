@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// ======
+// HTTP/3
+// ======
+
+// Create an HTTP/3 (QUIC) server on the given UDP address, serving the handler (to start with startHTTP3).
+// Returns a handler that advertises the HTTP/3 listener to clients via the Alt-Svc header.
+func (s *Self) serveHTTP3(addr string, handler http.Handler) (*http3.Server, http.Handler) {
+	quic := &http3.Server{Addr: addr, Handler: handler, IdleTimeout: s.timeouts.idle}
+	if s.tls != nil {
+		quic.TLSConfig = http3.ConfigureTLSConfig(s.tls.Clone())
+	}
+
+	return quic, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		quic.SetQUICHeaders(w.Header()) // Advertise HTTP/3 via Alt-Svc
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Start the HTTP/3 listener of the server, in the background
+func (s *Self) startHTTP3(quic *http3.Server) {
+	go func() {
+		s.logger.Println("HTTP/3 server started on", quic.Addr, "(udp)")
+		var err error
+		if s.tls != nil {
+			err = quic.ListenAndServe()
+		} else {
+			err = quic.ListenAndServeTLS(s.cert, s.key)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			s.logError("HTTP/3 server:", err)
+		}
+	}()
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// ==================
+// IN-FLIGHT REQUESTS
+// ==================
+
+// How long a queued request waits for its turn, before it is refused
+const maxQueueWait = 30 * time.Second
+
+// How long to ask the refused clients to wait before retrying, in seconds
+const inflightRetryAfter = 1
+
+// A limit on the number of requests served at once, with a queue for the requests beyond it
+type inflightLimiter struct {
+	slots    chan struct{} // A slot for each request that can be served at once
+	maxQueue int64         // The number of requests that can wait for a slot
+	queued   atomic.Int64  // The number of requests waiting for a slot
+}
+
+// Create a limit of the requests served at once, queueing up to maxQueue requests beyond it
+func newInflightLimiter(maxInflight, maxQueue int) *inflightLimiter {
+	return &inflightLimiter{slots: make(chan struct{}, maxInflight), maxQueue: int64(maxQueue)}
+}
+
+// Wait for a slot to serve the request in, returning false (without one) if the queue is full,
+// the request waited for too long, or the client went away
+func (il *inflightLimiter) acquire(r *http.Request) bool {
+	select {
+	case il.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if il.queued.Add(1) > il.maxQueue {
+		il.queued.Add(-1)
+		return false
+	}
+	defer il.queued.Add(-1)
+	timer := time.NewTimer(maxQueueWait)
+	defer timer.Stop()
+	select {
+	case il.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// Free the slot of a served request, for the next one
+func (il *inflightLimiter) release() {
+	<-il.slots
+}
+
+// Middleware that serves up to the limit of requests at once, queueing the ones beyond it and responding
+// with a 503 (and a Retry-After header) once the queue is full. The event streams of the live reload and
+// the inspector are not counted, as they stay open as long as their pages do.
+func limitInflight(il *inflightLimiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case liveReloadEventsPath, liveReloadWebSocketPath, inspectEventsPath:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !il.acquire(r) {
+			w.Header().Set("Retry-After", strconv.Itoa(inflightRetryAfter))
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		defer il.release()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,464 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// =================
+// REQUEST INSPECTOR
+// =================
+
+// The paths of the request inspector
+const (
+	inspectPath       = "/__inspect"         // The inspector page
+	inspectEventsPath = "/__inspect/events"  // The server-sent events stream of the requests
+	inspectBodiesPath = "/__inspect/bodies/" // The bodies of the requests and responses, like /__inspect/bodies/42/response
+)
+
+// The number of recent requests the inspector keeps
+const inspectHistory = 100
+
+// The most bytes of each request and response body the inspector keeps
+const maxInspectedBody = 64 << 10
+
+// A request and its response, as recorded by the inspector
+type exchange struct {
+	ID              int64       `json:"id"`              // The sequence number of the exchange
+	RequestID       string      `json:"requestId"`       // The X-Request-Id of the request
+	Time            time.Time   `json:"time"`            // When the request came in
+	Duration        float64     `json:"duration"`        // How long it took to respond, in milliseconds
+	RemoteAddr      string      `json:"remoteAddr"`      // The address of the client
+	Method          string      `json:"method"`          // The request method
+	URL             string      `json:"url"`             // The request URL
+	Proto           string      `json:"proto"`           // The protocol of the request (like HTTP/1.1)
+	Status          int         `json:"status"`          // The status code of the response
+	RequestHeaders  http.Header `json:"requestHeaders"`  // The headers of the request
+	ResponseHeaders http.Header `json:"responseHeaders"` // The headers of the response
+	RequestSize     int64       `json:"requestSize"`     // The size of the request body
+	ResponseSize    int64       `json:"responseSize"`    // The size of the response body
+
+	host         string // The host the request was made to
+	tls          bool   // Whether the request was made over TLS
+	requestBody  []byte // The start of the request body
+	responseBody []byte // The start of the response body (as written, so possibly compressed)
+}
+
+// Serve the request, capturing it and its response (with the start of their bodies)
+func captureExchange(w http.ResponseWriter, r *http.Request, next http.Handler) *exchange {
+	ex := &exchange{
+		RequestID:      r.Header.Get(requestIDHeader),
+		Time:           time.Now(),
+		RemoteAddr:     r.RemoteAddr,
+		Method:         r.Method,
+		URL:            r.URL.String(),
+		Proto:          r.Proto,
+		RequestHeaders: r.Header.Clone(),
+		host:           r.Host,
+		tls:            r.TLS != nil,
+	}
+
+	// Read the start of the request body up front (as the handler may not read it at all),
+	// and count the rest as the handler reads it
+	var requestBody []byte
+	rest := &limitedBuffer{}
+	if r.Body != nil && r.Body != http.NoBody {
+		requestBody, _ = io.ReadAll(io.LimitReader(r.Body, maxInspectedBody))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(requestBody), io.TeeReader(r.Body, rest)), r.Body}
+	}
+	responseBody := &limitedBuffer{limit: maxInspectedBody}
+	iw := &inspectWriter{loggingWriter: &loggingWriter{ResponseWriter: w}, body: responseBody}
+	next.ServeHTTP(iw, r)
+
+	ex.Duration = float64(time.Since(ex.Time).Microseconds()) / 1000
+	ex.Status = iw.status
+	if ex.Status == 0 {
+		ex.Status = http.StatusOK // Nothing was written
+	}
+	ex.ResponseHeaders = w.Header().Clone()
+	ex.RequestSize, ex.requestBody = int64(len(requestBody))+rest.size, requestBody
+	ex.ResponseSize, ex.responseBody = iw.size, responseBody.Bytes()
+	return ex
+}
+
+// The captured body of the request (or the response), decompressed if it was captured whole, and its headers
+func (ex *exchange) body(response bool) ([]byte, http.Header) {
+	body, headers, size := ex.requestBody, ex.RequestHeaders, ex.RequestSize
+	if response {
+		body, headers, size = ex.responseBody, ex.ResponseHeaders, ex.ResponseSize
+	}
+	if encoding := headers.Get("Content-Encoding"); encoding != "" && int64(len(body)) == size {
+		if decoded, err := decodeBody(body, encoding); err == nil {
+			body = decoded
+		}
+	}
+	return body, headers
+}
+
+// Records the recent requests and their responses, and streams them to the inspector page
+type inspector struct {
+	mu        sync.Mutex
+	nextID    int64                   // The ID of the next exchange
+	exchanges []*exchange             // The recent exchanges, oldest first
+	clients   map[chan *exchange]bool // The connected inspector pages' event channels
+}
+
+// Create an empty inspector
+func newInspector() *inspector {
+	return &inspector{clients: map[chan *exchange]bool{}}
+}
+
+// Middleware that records the requests and their responses (except the inspector's own)
+func (ins *inspector) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, inspectPath) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ins.add(captureExchange(w, r, next))
+	})
+}
+
+// Keep the exchange (forgetting the oldest one, beyond the history), and send it to the inspector pages
+func (ins *inspector) add(ex *exchange) {
+	ins.mu.Lock()
+	defer ins.mu.Unlock()
+	ins.nextID++
+	ex.ID = ins.nextID
+	ins.exchanges = append(ins.exchanges, ex)
+	if len(ins.exchanges) > inspectHistory {
+		ins.exchanges = ins.exchanges[1:]
+	}
+	for client := range ins.clients {
+		select {
+		case client <- ex:
+		default: // The page is not keeping up, so it misses out on this one
+		}
+	}
+}
+
+// Middleware that serves the inspector page, its event stream and the recorded bodies
+func (ins *inspector) serve(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == inspectPath:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Cache-Control", "no-store")
+			io.WriteString(w, inspectorPage)
+		case r.URL.Path == inspectEventsPath:
+			ins.streamEvents(w, r)
+		case strings.HasPrefix(r.URL.Path, inspectBodiesPath):
+			ins.serveBody(w, r)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// Stream the recent exchanges, and then the new ones as they come in, as server-sent events
+func (ins *inspector) streamEvents(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w) // Flushes through the middleware's ResponseWriters
+	events := make(chan *exchange, inspectHistory)
+	ins.mu.Lock()
+	for _, ex := range ins.exchanges {
+		events <- ex
+	}
+	ins.clients[events] = true
+	ins.mu.Unlock()
+	defer ins.unsubscribe(events)
+
+	keepOpen(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no") // Ask proxies not to buffer the stream
+	fmt.Fprint(w, "retry: 1000\n\n")
+	if err := rc.Flush(); err != nil {
+		return // Streaming is not supported
+	}
+
+	for {
+		select {
+		case ex, ok := <-events:
+			if !ok {
+				return // Disconnected, as the server is shutting down
+			}
+			data, _ := json.Marshal(ex)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			rc.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Disconnect the inspector page
+func (ins *inspector) unsubscribe(events chan *exchange) {
+	ins.mu.Lock()
+	defer ins.mu.Unlock()
+	if ins.clients[events] {
+		delete(ins.clients, events)
+		close(events)
+	}
+}
+
+// Disconnect the inspector pages, so that the connections can close (they reconnect once the server restarts)
+func (ins *inspector) disconnect() {
+	ins.mu.Lock()
+	defer ins.mu.Unlock()
+	for client := range ins.clients {
+		delete(ins.clients, client)
+		close(client)
+	}
+}
+
+// Serve the recorded body of a request or response (like /__inspect/bodies/42/response), decompressed.
+// The body is sandboxed, so that any scripts it has do not run.
+func (ins *inspector) serveBody(w http.ResponseWriter, r *http.Request) {
+	idValue, part, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, inspectBodiesPath), "/")
+	id, err := strconv.ParseInt(idValue, 10, 64)
+	if err != nil || (part != "request" && part != "response") {
+		http.NotFound(w, r)
+		return
+	}
+	var ex *exchange
+	ins.mu.Lock()
+	for _, candidate := range ins.exchanges {
+		if candidate.ID == id {
+			ex = candidate
+		}
+	}
+	ins.mu.Unlock()
+	if ex == nil {
+		http.Error(w, "The request is no longer in the inspector's history", http.StatusNotFound)
+		return
+	}
+
+	body, headers := ex.body(part == "response")
+	if contentType := headers.Get("Content-Type"); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(body)
+}
+
+// A ResponseWriter that keeps the start of the body, besides recording its status code and size
+type inspectWriter struct {
+	*loggingWriter
+	body *limitedBuffer // The start of the body
+}
+
+// Write the body, keeping its start
+func (iw *inspectWriter) Write(b []byte) (int, error) {
+	iw.body.Write(b)
+	return iw.loggingWriter.Write(b)
+}
+
+// A buffer that keeps up to a limit of the bytes written to it, while counting all of them
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int   // The most bytes to keep
+	size  int64 // The number of bytes written
+}
+
+// Keep the bytes, up to the limit
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.size += int64(len(p))
+	if room := b.limit - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(room, len(p))])
+	}
+	return len(p), nil
+}
+
+// --------------
+// INSPECTOR PAGE
+// --------------
+
+// The inspector page, which lists the requests as they come in, with their details on click
+const inspectorPage = `<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Request inspector</title>
+<style>
+	:root { color-scheme: light dark; --muted: #888; --hover: rgba(127, 127, 127, 0.1); }
+	body { font-family: system-ui, sans-serif; margin: 0; }
+	header { align-items: baseline; border-bottom: 1px solid var(--muted); display: flex; gap: 1rem; padding: 0.5rem 1rem; }
+	h1 { font-size: 1.25rem; font-weight: 500; margin: 0; }
+	#state { color: var(--muted); flex: 1; }
+	main { display: flex; height: calc(100vh - 3rem); }
+	#list { flex: 1; overflow: auto; }
+	#details { border-left: 1px solid var(--muted); flex: 1; overflow: auto; padding: 0 1rem; }
+	#details:empty { display: none; }
+	table { border-collapse: collapse; width: 100%; }
+	th, td { padding: 0.3rem 0.6rem; text-align: left; white-space: nowrap; }
+	th { border-bottom: 1px solid var(--muted); font-weight: 500; position: sticky; top: 0; background: Canvas; }
+	tbody tr { cursor: pointer; }
+	tbody tr:hover, tbody tr.selected { background: var(--hover); }
+	td.url { max-width: 30rem; overflow: hidden; text-overflow: ellipsis; width: 100%; }
+	td.number { color: var(--muted); font-variant-numeric: tabular-nums; text-align: right; }
+	.s2 { color: #2a2; } .s3 { color: #29c; } .s4 { color: #c90; } .s5 { color: #d33; }
+	h2 { font-size: 1rem; font-weight: 500; margin: 1rem 0 0.5rem; word-break: break-all; }
+	dl { display: grid; font-family: ui-monospace, monospace; font-size: 0.85rem; gap: 0.2rem 1rem; grid-template-columns: max-content 1fr; margin: 0; }
+	dt { color: var(--muted); }
+	dd { margin: 0; word-break: break-all; }
+</style>
+</head>
+<body>
+<header>
+	<h1>Request inspector</h1>
+	<span id="state">Connecting…</span>
+	<button id="clear">Clear</button>
+</header>
+<main>
+	<div id="list">
+		<table>
+			<thead><tr><th>Time</th><th>Method</th><th>URL</th><th>Status</th><th>Size</th><th>Duration</th></tr></thead>
+			<tbody id="rows"></tbody>
+		</table>
+	</div>
+	<div id="details"></div>
+</main>
+<script>
+	const rows = document.getElementById('rows');
+	const details = document.getElementById('details');
+	const state = document.getElementById('state');
+	const seen = new Set();
+
+	function element(tag, text, className) {
+		const el = document.createElement(tag);
+		if (text !== undefined) el.textContent = text;
+		if (className) el.className = className;
+		return el;
+	}
+
+	function size(bytes) {
+		if (bytes < 1024) return bytes + ' B';
+		const units = 'KMGT';
+		let i = -1;
+		do { bytes /= 1024; i++; } while (bytes >= 1024 && i < units.length - 1);
+		return bytes.toFixed(1) + ' ' + units[i] + 'B';
+	}
+
+	function headers(title, values) {
+		const section = element('div');
+		section.append(element('h2', title));
+		const list = element('dl');
+		for (const name of Object.keys(values || {}).sort()) {
+			for (const value of values[name]) {
+				list.append(element('dt', name), element('dd', value));
+			}
+		}
+		section.append(list);
+		return section;
+	}
+
+	function body(ex, part, bodySize) {
+		const section = element('div');
+		section.append(element('h2', part === 'request' ? 'Request body' : 'Response body'));
+		if (!bodySize) {
+			section.append(element('span', 'Empty', 'number'));
+			return section;
+		}
+		const link = element('a', 'View (' + size(bodySize) + ')');
+		link.href = '/__inspect/bodies/' + ex.id + '/' + part;
+		link.target = '_blank';
+		section.append(link);
+		if (bodySize > 65536) section.append(element('span', ' (only the first 64 KB were kept)', 'number'));
+		return section;
+	}
+
+	function show(ex, row) {
+		for (const selected of rows.querySelectorAll('.selected')) selected.classList.remove('selected');
+		row.classList.add('selected');
+		details.replaceChildren(
+			element('h2', ex.method + ' ' + ex.url + ' → ' + ex.status),
+			headers('General', {
+				'Time': [new Date(ex.time).toLocaleString()],
+				'Duration': [ex.duration + ' ms'],
+				'Client': [ex.remoteAddr],
+				'Protocol': [ex.proto],
+				'Request ID': [ex.requestId],
+			}),
+			headers('Request headers', ex.requestHeaders),
+			body(ex, 'request', ex.requestSize),
+			headers('Response headers', ex.responseHeaders),
+			body(ex, 'response', ex.responseSize),
+		);
+	}
+
+	function add(ex) {
+		if (seen.has(ex.id)) return; // Sent again on reconnecting
+		seen.add(ex.id);
+		const row = element('tr');
+		row.append(
+			element('td', new Date(ex.time).toLocaleTimeString(), 'number'),
+			element('td', ex.method),
+			element('td', ex.url, 'url'),
+			element('td', ex.status, 's' + String(ex.status)[0]),
+			element('td', size(ex.responseSize), 'number'),
+			element('td', ex.duration + ' ms', 'number'),
+		);
+		row.addEventListener('click', () => show(ex, row));
+		rows.prepend(row);
+		while (rows.children.length > 500) rows.lastChild.remove();
+	}
+
+	document.getElementById('clear').addEventListener('click', () => {
+		rows.replaceChildren();
+		details.replaceChildren();
+	});
+
+	const events = new EventSource('/__inspect/events');
+	events.onopen = () => state.textContent = 'Live';
+	events.onerror = () => state.textContent = 'Reconnecting…';
+	events.onmessage = (e) => add(JSON.parse(e.data));
+</script>
+</body>
+</html>
+`
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Decompress the body of the Content-Encoding
+func decodeBody(body []byte, encoding string) ([]byte, error) {
+	var reader io.Reader
+	switch encoding {
+	case "gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		reader = gz
+	case "br":
+		reader = brotli.NewReader(bytes.NewReader(body))
+	case "zstd":
+		dec, err := zstd.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer dec.Close()
+		reader = dec
+	default:
+		return nil, fmt.Errorf("unsupported encoding %s", encoding)
+	}
+	return io.ReadAll(reader)
+}
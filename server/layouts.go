@@ -0,0 +1,189 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// =======
+// LAYOUTS
+// =======
+
+// The directory (relative to the served directory) that contains the layout templates
+const layoutsDir = "/_layouts"
+
+// How deeply layouts can be nested (to guard against layouts that use themselves)
+const maxLayoutDepth = 10
+
+// The data passed to the layout (and markdown page) templates
+type pageData struct {
+	Title   string         // The title of the page (the frontmatter's title, if any)
+	Content template.HTML  // The content of the page (or of the layout nested inside this one)
+	Page    map[string]any // The page's frontmatter (e.g. {{.Page.author}})
+	Path    string         // The request path
+}
+
+// Middleware that serves HTML files that start with YAML frontmatter, stripping the
+// frontmatter and wrapping the content in the `layout:` it names (if any). Files without
+// frontmatter (or whose frontmatter is not valid YAML) are served as they are.
+func layouts(fsys http.FileSystem, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Path
+		if strings.HasSuffix(name, "/") {
+			name += defaultIndex
+		} else if path.Base(name) == defaultIndex {
+			next.ServeHTTP(w, r) // Leave the redirect to the directory to the file server
+			return
+		}
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || path.Ext(name) != ".html" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		file, err := fsys.Open(name)
+		if err != nil {
+			next.ServeHTTP(w, r) // Leave the error to the file server
+			return
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil || info.IsDir() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Only read the whole file if it starts like frontmatter
+		reader := bufio.NewReader(file)
+		if start, _ := reader.Peek(len(frontmatterDelimiter)); string(start) != frontmatterDelimiter {
+			next.ServeHTTP(w, r)
+			return
+		}
+		source, err := io.ReadAll(reader)
+		if err != nil {
+			requestLogger(r).Println("Could not read the file:", err)
+			http.Error(w, "Error reading file", http.StatusInternalServerError)
+			return
+		}
+		matter, content, err := parseFrontmatter(source)
+		if err != nil {
+			logDetail(r, "Serving the file as is, as its frontmatter is not valid YAML: %v", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if matter == nil {
+			next.ServeHTTP(w, r) // No frontmatter, serve the file as is
+			return
+		}
+
+		data := pageData{Title: frontmatterTitle(matter, ""), Content: template.HTML(content), Page: matter, Path: r.URL.Path}
+		page, err := applyLayout(fsys, matter, data)
+		if err != nil {
+			requestLogger(r).Println("Could not render the layout:", err)
+			http.Error(w, "Error rendering layout", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		http.ServeContent(w, r, info.Name(), info.ModTime(), bytes.NewReader(page))
+	})
+}
+
+// Wrap the page's content in the layout named by the frontmatter (and in the layouts those
+// layouts name, in turn). Without a layout, the content is returned as is.
+func applyLayout(fsys http.FileSystem, matter map[string]any, data pageData) ([]byte, error) {
+	for depth := 0; ; depth++ {
+		name, _ := matter["layout"].(string)
+		if name == "" {
+			return []byte(data.Content), nil
+		}
+		if depth == maxLayoutDepth {
+			return nil, fmt.Errorf("layouts nested more than %d deep", maxLayoutDepth)
+		}
+
+		if path.Ext(name) == "" {
+			name += ".html"
+		}
+		source, err := readFile(fsys, path.Join(layoutsDir, name))
+		if err != nil {
+			return nil, fmt.Errorf("could not read layout %q: %w", name, err)
+		}
+		layoutMatter, layout, err := parseFrontmatter(source)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse the frontmatter of layout %q: %w", name, err)
+		}
+		tmpl, err := template.New(name).Parse(string(layout))
+		if err != nil {
+			return nil, err
+		}
+		var output bytes.Buffer
+		if err := tmpl.Execute(&output, data); err != nil {
+			return nil, err
+		}
+		data.Content, matter = template.HTML(output.String()), layoutMatter
+	}
+}
+
+// -----------
+// FRONTMATTER
+// -----------
+
+// The line that opens and closes the frontmatter
+const frontmatterDelimiter = "---"
+
+// Split the YAML frontmatter (delimited by `---` lines at the start of the file) from the content.
+// The frontmatter is nil if the file has none.
+func parseFrontmatter(source []byte) (map[string]any, []byte, error) {
+	rest, ok := cutLine(source, frontmatterDelimiter)
+	if !ok {
+		return nil, source, nil
+	}
+	for offset := 0; offset < len(rest); {
+		line, next, _ := bytes.Cut(rest[offset:], []byte("\n"))
+		if string(bytes.TrimRight(line, " \t\r")) == frontmatterDelimiter {
+			matter := map[string]any{}
+			if err := yaml.Unmarshal(rest[:offset], &matter); err != nil {
+				return nil, nil, err
+			}
+			return matter, next, nil
+		}
+		offset += len(line) + 1
+	}
+	return nil, source, nil // Not closed, so not frontmatter
+}
+
+// The title from the frontmatter, or the fallback if it has none
+func frontmatterTitle(matter map[string]any, fallback string) string {
+	if title, ok := matter["title"].(string); ok && title != "" {
+		return title
+	}
+	return fallback
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Cut the first line off the source, if it is the given line (ignoring trailing whitespace)
+func cutLine(source []byte, line string) ([]byte, bool) {
+	first, rest, found := bytes.Cut(source, []byte("\n"))
+	if !found || string(bytes.TrimRight(first, " \t\r")) != line {
+		return source, false
+	}
+	return rest, true
+}
+
+// Read the contents of the named file
+func readFile(fsys http.FileSystem, name string) ([]byte, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
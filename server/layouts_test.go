@@ -0,0 +1,50 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLayouts(t *testing.T) {
+	fsys := http.FS(fstest.MapFS{
+		"_layouts/base.html": {Data: []byte("<title>{{.Title}}</title>{{.Content}}")},
+		"_layouts/post.html": {Data: []byte("---\nlayout: base\n---\n<article>{{.Content}}</article>")},
+		"page.html":          {Data: []byte("---\ntitle: Hello\nlayout: base\n---\n<p>Hello</p>")},
+		"post.html":          {Data: []byte("---\ntitle: Post\nlayout: post\n---\n<p>Post</p>")},
+		"bare.html":          {Data: []byte("---\ntitle: Bare\n---\n<p>Bare</p>")},
+		"plain.html":         {Data: []byte("<p>Plain</p>")},
+		"invalid.html":       {Data: []byte("---\ntitle: [unclosed\n---\n<p>Invalid</p>")},
+		"unclosed.html":      {Data: []byte("---\n<p>Unclosed</p>")},
+		"missing.html":       {Data: []byte("---\nlayout: missing\n---\n<p>Missing</p>")},
+		"notes.txt":          {Data: []byte("---\ntitle: Notes\n---\n")},
+	})
+	handler := layouts(fsys, http.FileServer(fsys))
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{path: "/page.html", status: http.StatusOK, body: "<title>Hello</title><p>Hello</p>"},
+		{path: "/post.html", status: http.StatusOK, body: "<title>Post</title><article><p>Post</p></article>"},
+		{path: "/bare.html", status: http.StatusOK, body: "<p>Bare</p>"},
+		{path: "/plain.html", status: http.StatusOK, body: "<p>Plain</p>"},
+		{path: "/invalid.html", status: http.StatusOK, body: "---\ntitle: [unclosed\n---\n<p>Invalid</p>"},
+		{path: "/unclosed.html", status: http.StatusOK, body: "---\n<p>Unclosed</p>"},
+		{path: "/missing.html", status: http.StatusInternalServerError},
+		{path: "/notes.txt", status: http.StatusOK, body: "---\ntitle: Notes\n---"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, quietRequest(httptest.NewRequest(http.MethodGet, tt.path, nil)))
+		if rec.Code != tt.status {
+			t.Errorf("GET %s = %d, want %d", tt.path, rec.Code, tt.status)
+		}
+		if body := strings.TrimSpace(rec.Body.String()); tt.body != "" && body != tt.body {
+			t.Errorf("GET %s = %q, want %q", tt.path, body, tt.body)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ===========
+// BODY LIMITS
+// ===========
+
+// Middleware that limits the size of the request bodies (for uploads, the mock API and the backends),
+// refusing larger ones with 413 Request Entity Too Large: up front when their Content-Length is known,
+// and otherwise once the handler reads past the limit
+func limitBodies(maxSize int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > maxSize {
+			w.Header().Set("Connection", "close") // Rather than reading the rest of the body
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Boolean indicating whether the error is from reading past the limit of the request body
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
@@ -0,0 +1,416 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// =================
+// DIRECTORY LISTING
+// =================
+
+// An entry in a directory listing
+type listingEntry struct {
+	Name     string    // The name of the file (with a trailing slash for directories)
+	URL      string    // The (escaped) relative URL of the file
+	IsDir    bool      // Whether the entry is a directory
+	Size     int64     // The size of the file in bytes
+	Modified time.Time // The last modification time of the file
+}
+
+// The icon for the entry, based on its type
+func (e listingEntry) Icon() string {
+	if e.IsDir {
+		return "📁"
+	}
+	ext := strings.ToLower(path.Ext(e.Name))
+	switch ext {
+	case ".zip", ".tar", ".gz", ".tgz", ".bz2", ".xz", ".7z", ".rar", ".zst":
+		return "📦"
+	case ".js", ".mjs", ".ts", ".go", ".py", ".rs", ".c", ".cpp", ".h", ".java", ".rb", ".sh", ".css", ".html", ".htm", ".json", ".xml", ".yaml", ".yml", ".toml":
+		return "📜"
+	case ".pdf":
+		return "📕"
+	case ".md", ".txt":
+		return "📝"
+	}
+	mediaType, _, _ := strings.Cut(mime.TypeByExtension(ext), "/")
+	switch mediaType {
+	case "image":
+		return "🖼️"
+	case "video":
+		return "🎞️"
+	case "audio":
+		return "🎵"
+	case "font":
+		return "🔤"
+	}
+	return "📄"
+}
+
+// The human readable size of the entry
+func (e listingEntry) HumanSize() string {
+	if e.IsDir {
+		return "—"
+	}
+	return humanSize(e.Size)
+}
+
+// The data passed to the directory listing template
+type listingData struct {
+	Path    string         // The URL path of the directory
+	Entries []listingEntry // The entries in the directory
+	Sort    string         // The column the entries are sorted by
+	Desc    bool           // Whether the entries are sorted in descending order
+	IsRoot  bool           // Whether the directory is the root
+	Upload  bool           // Whether to show the upload form (in --write mode)
+}
+
+// The link to sort by the column (toggling the order if already sorted by it)
+func (d listingData) SortLink(column string) string {
+	order := "asc"
+	if d.Sort == column && !d.Desc {
+		order = "desc"
+	}
+	return "?sort=" + column + "&order=" + order
+}
+
+// The arrow indicating the sort order of the column, if sorted by it
+func (d listingData) SortArrow(column string) string {
+	if d.Sort != column {
+		return ""
+	}
+	if d.Desc {
+		return " ▾"
+	}
+	return " ▴"
+}
+
+// Handler that serves an HTML listing of the requested directory,
+// sortable by name, size and modification time (with an upload form, if enabled)
+func listDirectory(fsys http.FileSystem, upload bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entries, err := readDirectory(fsys, r.URL.Path)
+		if err != nil {
+			requestLogger(r).Println("Could not read the directory:", err)
+			http.Error(w, "Error reading directory", http.StatusInternalServerError)
+			return
+		}
+
+		// Respond with JSON, if requested
+		addVary(w.Header(), "Accept")
+		if wantsJSON(r) {
+			writeListingJSON(w, entries)
+			return
+		}
+
+		data := listingData{
+			Path:    r.URL.Path,
+			Entries: entries,
+			Sort:    r.URL.Query().Get("sort"),
+			Desc:    r.URL.Query().Get("order") == "desc",
+			IsRoot:  r.URL.Path == "/",
+			Upload:  upload,
+		}
+		if data.Sort != "size" && data.Sort != "modified" {
+			data.Sort = "name"
+		}
+		sortEntries(data.Entries, data.Sort, data.Desc)
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := listingTemplate.Execute(w, data); err != nil {
+			requestLogger(r).Println("Could not render the directory listing:", err)
+		}
+	})
+}
+
+// Read the entries of the directory
+func readDirectory(fsys http.FileSystem, dir string) ([]listingEntry, error) {
+	file, err := fsys.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	infos, err := file.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]listingEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, newListingEntry(info))
+	}
+	return entries, nil
+}
+
+// Create a listing entry from the file info
+func newListingEntry(info fs.FileInfo) listingEntry {
+	name := info.Name()
+	if info.IsDir() {
+		name += "/"
+	}
+	return listingEntry{
+		Name:     name,
+		URL:      (&url.URL{Path: name}).String(),
+		IsDir:    info.IsDir(),
+		Size:     info.Size(),
+		Modified: info.ModTime(),
+	}
+}
+
+// Sort the entries by the column, with directories first
+func sortEntries(entries []listingEntry, column string, desc bool) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		var less bool
+		switch column {
+		case "size":
+			less = a.Size < b.Size
+		case "modified":
+			less = a.Modified.Before(b.Modified)
+		default:
+			less = strings.ToLower(a.Name) < strings.ToLower(b.Name)
+		}
+		if desc {
+			return !less
+		}
+		return less
+	})
+}
+
+// ------------
+// JSON LISTING
+// ------------
+
+// An entry in a JSON directory listing
+type jsonListingEntry struct {
+	Name     string    `json:"name"`  // The name of the file
+	Size     int64     `json:"size"`  // The size of the file in bytes
+	Modified time.Time `json:"mtime"` // The last modification time of the file
+	Type     string    `json:"type"`  // Either "file" or "directory"
+}
+
+// Boolean indicating whether the client asked for a JSON listing
+// (with `?format=json` or an `Accept: application/json` header)
+func wantsJSON(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "json"
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(accept, ";")
+		if strings.TrimSpace(mediaType) == "application/json" {
+			return true
+		}
+	}
+	return false
+}
+
+// Write the entries as a JSON array, sorted by name with directories first
+func writeListingJSON(w http.ResponseWriter, entries []listingEntry) {
+	sortEntries(entries, "name", false)
+	list := make([]jsonListingEntry, 0, len(entries))
+	for _, entry := range entries {
+		item := jsonListingEntry{Name: strings.TrimSuffix(entry.Name, "/"), Size: entry.Size, Modified: entry.Modified, Type: "file"}
+		if entry.IsDir {
+			item.Type = "directory"
+		}
+		list = append(list, item)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(list); err != nil {
+		log.Println("Could not write the JSON directory listing:", err)
+	}
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Format the number of bytes as a human readable size (e.g. 1.5 MB)
+func humanSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// --------
+// TEMPLATE
+// --------
+
+// The HTML template for directory listings
+var listingTemplate = template.Must(template.New("listing").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Index of {{.Path}}</title>
+<style>
+	:root { color-scheme: light dark; --muted: #888; --hover: rgba(127, 127, 127, 0.1); }
+	body { font-family: system-ui, sans-serif; margin: 2rem auto; max-width: 960px; padding: 0 1rem; }
+	header { align-items: baseline; display: flex; gap: 1rem; justify-content: space-between; }
+	h1 { font-size: 1.25rem; font-weight: 500; word-break: break-all; }
+	.download { white-space: nowrap; }
+	table { border-collapse: collapse; width: 100%; }
+	th, td { padding: 0.4rem 0.6rem; text-align: left; white-space: nowrap; }
+	th { border-bottom: 1px solid var(--muted); font-weight: 500; }
+	th a { color: inherit; text-decoration: none; }
+	tbody tr:hover { background: var(--hover); }
+	td.name { width: 100%; white-space: normal; word-break: break-all; }
+	td.name a { text-decoration: none; }
+	td.size, th.size { text-align: right; }
+	td.size, td.modified { color: var(--muted); font-variant-numeric: tabular-nums; }
+	.icon { display: inline-block; width: 1.5em; }
+	#filter { box-sizing: border-box; font: inherit; margin-bottom: 1rem; padding: 0.4rem 0.6rem; width: 100%; }
+	{{- if .Upload}}
+	#upload { border: 2px dashed var(--muted); border-radius: 0.5rem; margin-bottom: 1rem; padding: 1rem; text-align: center; }
+	#upload.dragging { background: var(--hover); border-color: currentColor; }
+	#upload label { cursor: pointer; text-decoration: underline; }
+	#upload input[type="file"] { display: none; }
+	#uploads { list-style: none; margin: 0.5rem 0 0; padding: 0; text-align: left; }
+	#uploads li { align-items: center; display: flex; gap: 0.6rem; padding: 0.2rem 0; }
+	#uploads span { flex: 1; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+	#uploads progress { width: 40%; }
+	#uploads .failed { color: #d33; }
+	{{- end}}
+</style>
+</head>
+<body>
+<header>
+	<h1>Index of {{.Path}}</h1>
+	<span class="download">⬇️ Download as <a href="?zip" download>ZIP</a> · <a href="?tar" download>tar.gz</a></span>
+</header>
+{{- if .Upload}}
+<form id="upload" method="post" enctype="multipart/form-data">
+	Drop files here or <label for="files">choose files</label> to upload them to this directory
+	<input type="file" id="files" name="files" multiple>
+	<noscript><button type="submit">Upload</button></noscript>
+	<ul id="uploads"></ul>
+</form>
+{{- end}}
+<input type="search" id="filter" placeholder="Filter (press / to focus)" aria-label="Filter entries" autocomplete="off">
+<table>
+	<thead>
+		<tr>
+			<th><a href="{{.SortLink "name"}}">Name{{.SortArrow "name"}}</a></th>
+			<th class="size"><a href="{{.SortLink "size"}}">Size{{.SortArrow "size"}}</a></th>
+			<th><a href="{{.SortLink "modified"}}">Modified{{.SortArrow "modified"}}</a></th>
+		</tr>
+	</thead>
+	<tbody>
+		{{- if not .IsRoot}}
+		<tr>
+			<td class="name"><a href="../"><span class="icon">⬆️</span>../</a></td>
+			<td class="size"></td>
+			<td class="modified"></td>
+		</tr>
+		{{- end}}
+		{{- range .Entries}}
+		<tr data-name="{{.Name}}">
+			<td class="name"><a href="{{.URL}}"><span class="icon">{{.Icon}}</span>{{.Name}}</a></td>
+			<td class="size" title="{{.Size}} bytes">{{.HumanSize}}</td>
+			<td class="modified"><time datetime="{{.Modified.Format "2006-01-02T15:04:05Z07:00"}}">{{.Modified.Format "2006-01-02 15:04"}}</time></td>
+		</tr>
+		{{- end}}
+	</tbody>
+</table>
+<script>
+	const filter = document.getElementById("filter");
+	const rows = document.querySelectorAll("tbody tr[data-name]");
+	filter.addEventListener("input", () => {
+		const query = filter.value.toLowerCase();
+		for (const row of rows) {
+			row.hidden = !row.dataset.name.toLowerCase().includes(query);
+		}
+	});
+	document.addEventListener("keydown", (event) => {
+		if (event.key === "/" && document.activeElement !== filter) {
+			event.preventDefault();
+			filter.focus();
+		}
+	});
+</script>
+{{- if .Upload}}
+<script>
+	const upload = document.getElementById("upload");
+	const picker = document.getElementById("files");
+	const uploads = document.getElementById("uploads");
+	let pending = 0;
+
+	// Upload each file separately, so that each gets its own progress bar
+	function send(file) {
+		const item = document.createElement("li");
+		const name = document.createElement("span");
+		const progress = document.createElement("progress");
+		name.textContent = file.name;
+		progress.max = 1;
+		progress.value = 0;
+		item.append(name, progress);
+		uploads.append(item);
+
+		const body = new FormData();
+		body.append("files", file);
+		const request = new XMLHttpRequest();
+		request.open("POST", location.pathname);
+		request.setRequestHeader("Accept", "application/json");
+		request.upload.addEventListener("progress", (event) => {
+			if (event.lengthComputable) progress.value = event.loaded / event.total;
+		});
+		request.addEventListener("loadend", () => {
+			if (request.status === 201) {
+				progress.value = 1;
+			} else {
+				item.classList.add("failed");
+				name.textContent = file.name + " (" + (request.statusText || "failed") + ")";
+			}
+			if (--pending === 0 && !uploads.querySelector(".failed")) location.reload();
+		});
+		pending++;
+		request.send(body);
+	}
+
+	picker.addEventListener("change", () => {
+		for (const file of picker.files) send(file);
+		picker.value = "";
+	});
+	// Accept drops anywhere on the page (instead of the browser opening the file)
+	document.addEventListener("dragover", (event) => {
+		event.preventDefault();
+		upload.classList.add("dragging");
+	});
+	document.addEventListener("dragleave", (event) => {
+		if (!event.relatedTarget) upload.classList.remove("dragging");
+	});
+	document.addEventListener("drop", (event) => {
+		event.preventDefault();
+		upload.classList.remove("dragging");
+		for (const file of event.dataTransfer.files) send(file);
+	});
+</script>
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,389 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// ===========
+// LIVE RELOAD
+// ===========
+
+// The paths of the live reload endpoints
+const (
+	liveReloadEventsPath    = "/__events"        // The server-sent events stream
+	liveReloadWebSocketPath = "/__ws"            // The WebSocket alternative to the events stream
+	liveReloadScriptPath    = "/__livereload.js" // The client script injected into HTML pages
+)
+
+// The script tag injected into HTML pages to load the live reload client
+var liveReloadScriptTag = []byte(`<script src="` + liveReloadScriptPath + `"></script>`)
+
+// An event sent to the live reload clients
+type reloadEvent struct {
+	Type  string   `json:"type"`            // Either "reload" (reload the page) or "css" (replace the stylesheets)
+	Paths []string `json:"paths,omitempty"` // The changed files
+}
+
+// Broadcasts reload events to the connected live reload clients
+type liveReload struct {
+	mu      sync.Mutex                // Guards the clients
+	clients map[chan reloadEvent]bool // The connected clients' event channels
+	done    chan struct{}             // Closed when the server shuts down
+	observe func(event reloadEvent)   // Called with each event before it is broadcast (if set, for the memory cache and the dashboard)
+}
+
+// Start watching the served directory, and broadcasting reload events on changes (with the returned broadcaster)
+func (s *Self) startLiveReload() (*liveReload, error) {
+	ignore := func(name string) bool {
+		return (s.hideDotfiles && isDotfile(name)) ||
+			(s.exclude != nil && s.exclude(name)) ||
+			(s.watchIgnore != nil && s.watchIgnore(name))
+	}
+	w, err := newWatcher(s.dir, ignore, s.watchDebounce, s.watchPoll)
+	if err != nil {
+		return nil, fmt.Errorf("could not watch %s: %w", s.dir, err)
+	}
+	reload := newLiveReload()
+	reload.observe = func(event reloadEvent) {
+		if s.memoryCache != nil {
+			s.memoryCache.invalidate(s.dir, event.Paths) // Rather than waiting for the files to be served again
+		}
+		if s.dashboard != nil {
+			s.dashboard.watched(event)
+		}
+	}
+	s.mu.Lock()
+	s.watcher, s.reload = w, reload
+	s.mu.Unlock()
+	go reload.watch(w)
+	return reload, nil
+}
+
+// Stop watching the files and disconnect the live reload clients (so that the connections can close),
+// if started. Called with s.mu held, and only stops them once.
+func (s *Self) stopLiveReload() {
+	if s.reload == nil {
+		return
+	}
+	s.reload.Close()
+	s.watcher.Close()
+	s.reload, s.watcher = nil, nil
+}
+
+// Create a new live reload broadcaster
+func newLiveReload() *liveReload {
+	return &liveReload{clients: map[chan reloadEvent]bool{}, done: make(chan struct{})}
+}
+
+// Broadcast reload events to the clients whenever the watched files change
+func (lr *liveReload) watch(w *watcher) {
+	for {
+		select {
+		case changes := <-w.Changes:
+			event := eventFor(changes)
+			if lr.observe != nil {
+				lr.observe(event)
+			}
+			lr.broadcast(event)
+		case <-lr.done:
+			return
+		}
+	}
+}
+
+// The event to send for the changed files. When only stylesheets have changed,
+// they can be replaced in place instead of reloading the whole page.
+func eventFor(changes []string) reloadEvent {
+	for _, name := range changes {
+		if path.Ext(name) != ".css" {
+			return reloadEvent{Type: "reload", Paths: changes}
+		}
+	}
+	return reloadEvent{Type: "css", Paths: changes}
+}
+
+// Send the event to all connected clients
+func (lr *liveReload) broadcast(event reloadEvent) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	for client := range lr.clients {
+		select {
+		case client <- event:
+		default:
+			// The client already has an event pending, replace it with a full reload
+			select {
+			case <-client:
+			default:
+			}
+			client <- reloadEvent{Type: "reload"}
+		}
+	}
+}
+
+// Connect a client, returning the channel its events are sent on
+func (lr *liveReload) subscribe() chan reloadEvent {
+	events := make(chan reloadEvent, 1)
+	lr.mu.Lock()
+	lr.clients[events] = true
+	lr.mu.Unlock()
+	return events
+}
+
+// Disconnect the client
+func (lr *liveReload) unsubscribe(events chan reloadEvent) {
+	lr.mu.Lock()
+	delete(lr.clients, events)
+	lr.mu.Unlock()
+}
+
+// Disconnect all clients, so that the server can shutdown
+func (lr *liveReload) Close() {
+	close(lr.done)
+}
+
+// Stream the events to the client as server-sent events
+func (lr *liveReload) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w) // Flushes through the middleware's ResponseWriters
+	events := lr.subscribe()
+	defer lr.unsubscribe(events)
+
+	keepOpen(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no") // Ask proxies not to buffer the stream
+	fmt.Fprint(w, "retry: 1000\n\n")
+	if err := rc.Flush(); err != nil {
+		return // Streaming is not supported
+	}
+
+	for {
+		select {
+		case event := <-events:
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			rc.Flush()
+		case <-r.Context().Done():
+			return
+		case <-lr.done:
+			return
+		}
+	}
+}
+
+// Stream the events to the client over a WebSocket, for environments where
+// server-sent events are blocked or buffered
+func (lr *liveReload) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 1 {
+		http.Error(w, "WebSockets not supported", http.StatusNotImplemented) // Only HTTP/1 connections can be hijacked
+		return
+	}
+	keepOpen(w) // The deadlines outlive the hijacking of the connection
+	websocket.Handler(func(ws *websocket.Conn) {
+		events := lr.subscribe()
+		defer lr.unsubscribe(events)
+
+		// Read (and discard) incoming messages to notice when the client disconnects
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			var message string
+			for websocket.Message.Receive(ws, &message) == nil {
+			}
+		}()
+
+		for {
+			select {
+			case event := <-events:
+				if err := websocket.JSON.Send(ws, event); err != nil {
+					return
+				}
+			case <-closed:
+				return
+			case <-lr.done:
+				return
+			}
+		}
+	}).ServeHTTP(hijackableWriter{w}, r)
+}
+
+// A ResponseWriter that hijacks the connection through the http.ResponseController, for the handlers
+// that require an http.Hijacker (like the WebSocket one) behind the middleware's ResponseWriters
+type hijackableWriter struct {
+	http.ResponseWriter
+}
+
+// Hijack the connection of the underlying ResponseWriter (or one it unwraps to)
+func (hw hijackableWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(hw.ResponseWriter).Hijack()
+}
+
+// Unwrap the underlying ResponseWriter (for http.ResponseController)
+func (hw hijackableWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
+
+// Serve the live reload client script
+func serveLiveReloadScript(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprint(w, liveReloadClient)
+}
+
+// The live reload client script. Reloads the page when the server reports a change,
+// or replaces the stylesheets in place when only they have changed.
+// Listens for server-sent events, falling back to the WebSocket if the event stream
+// cannot be opened (e.g. because a proxy blocks or buffers it).
+const liveReloadClient = `(() => {
+	const replaceStylesheets = (paths) => {
+		const links = [...document.querySelectorAll('link[rel="stylesheet"]')].filter((link) => {
+			const url = new URL(link.href, location.href);
+			return url.origin === location.origin && paths.includes(url.pathname);
+		});
+		if (links.length === 0) return location.reload(); // e.g. the stylesheet is imported
+		for (const link of links) {
+			const url = new URL(link.href, location.href);
+			url.searchParams.set("__reload", Date.now());
+			const replacement = link.cloneNode();
+			replacement.href = url.href;
+			replacement.addEventListener("load", () => link.remove()); // Swap once loaded, to avoid a flash of unstyled content
+			link.after(replacement);
+		}
+	};
+
+	const handle = (event) => {
+		if (event.type === "css") replaceStylesheets(event.paths);
+		else location.reload();
+	};
+
+	const connectWebSocket = (delay = 1000) => {
+		const protocol = location.protocol === "https:" ? "wss:" : "ws:";
+		const ws = new WebSocket(protocol + "//" + location.host + "` + liveReloadWebSocketPath + `");
+		ws.addEventListener("open", () => (delay = 1000));
+		ws.addEventListener("message", (message) => handle(JSON.parse(message.data)));
+		ws.addEventListener("close", () => setTimeout(() => connectWebSocket(Math.min(delay * 2, 10000)), delay));
+	};
+
+	if (!("EventSource" in window)) return connectWebSocket();
+
+	const source = new EventSource("` + liveReloadEventsPath + `");
+	let opened = false;
+	const fallback = () => {
+		if (opened) return;
+		source.close();
+		connectWebSocket();
+	};
+	const timeout = setTimeout(fallback, 3000);
+	source.addEventListener("open", () => {
+		opened = true;
+		clearTimeout(timeout);
+	});
+	source.addEventListener("error", () => {
+		clearTimeout(timeout);
+		fallback();
+	});
+	for (const type of ["reload", "css"]) {
+		source.addEventListener(type, (message) => handle(JSON.parse(message.data)));
+	}
+})();
+`
+
+// ---------
+// INJECTION
+// ---------
+
+// Middleware that injects the live reload client script into HTML responses
+func injectLiveReload(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The script cannot be injected into precompressed or partial content
+		r = r.Clone(r.Context())
+		r.Header.Del("Accept-Encoding")
+		r.Header.Del("Range")
+
+		iw := &injectWriter{ResponseWriter: w}
+		next.ServeHTTP(iw, r)
+		iw.Close()
+	})
+}
+
+// A ResponseWriter that buffers HTML responses to inject the live reload script into them
+type injectWriter struct {
+	http.ResponseWriter
+	buffer      *bytes.Buffer // The buffered HTML body (nil if not injecting)
+	wroteHeader bool          // Whether the header has been written
+}
+
+// Write the header, deciding whether to inject the script into the body
+func (iw *injectWriter) WriteHeader(status int) {
+	if iw.wroteHeader {
+		return
+	}
+	iw.wroteHeader = true
+
+	h := iw.Header()
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if mediaType == "text/html" && h.Get("Content-Encoding") == "" && status != http.StatusNotModified {
+		iw.buffer = new(bytes.Buffer)
+		if length, err := strconv.Atoi(h.Get("Content-Length")); err == nil {
+			h.Set("Content-Length", strconv.Itoa(length+len(liveReloadScriptTag)))
+		}
+	}
+	iw.ResponseWriter.WriteHeader(status)
+}
+
+// Write (or buffer) the body
+func (iw *injectWriter) Write(b []byte) (int, error) {
+	if !iw.wroteHeader {
+		if iw.Header().Get("Content-Type") == "" {
+			iw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		iw.WriteHeader(http.StatusOK)
+	}
+	if iw.buffer != nil {
+		return iw.buffer.Write(b)
+	}
+	return iw.ResponseWriter.Write(b)
+}
+
+// Inject the script (before the closing body tag, if there is one) and write the buffered body
+func (iw *injectWriter) Close() {
+	if iw.buffer == nil {
+		return
+	}
+	body := iw.buffer.Bytes()
+	i := bytes.LastIndex(bytes.ToLower(body), []byte("</body>"))
+	if i < 0 {
+		i = len(body)
+	}
+	iw.ResponseWriter.Write(body[:i])
+	iw.ResponseWriter.Write(liveReloadScriptTag)
+	iw.ResponseWriter.Write(body[i:])
+}
+
+// Unwrap the underlying ResponseWriter (for http.ResponseController)
+func (iw *injectWriter) Unwrap() http.ResponseWriter {
+	return iw.ResponseWriter
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Lift the read and write deadlines of the connection (from --read-timeout and --write-timeout),
+// so that a long-lived stream of events is not cut off by them
+func keepOpen(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ========
+// LOG FILE
+// ========
+
+// The layout of the timestamps in the names of the rotated log files (like `access-2006-01-02T15-04-05.000.log`)
+const rotatedLogLayout = "2006-01-02T15-04-05.000"
+
+// A log file that is rotated once it grows beyond a size, or gets older than an interval,
+// keeping a number of the rotated files around
+type rotatingFile struct {
+	name     string        // The path of the log file
+	maxSize  int64         // The size to rotate the file at (0 to not rotate by size)
+	interval time.Duration // How often to rotate the file (0 to not rotate by time)
+	keep     int           // The number of rotated files to keep (0 to keep them all)
+
+	mu      sync.Mutex
+	file    *os.File  // The open log file
+	size    int64     // The size of the log file
+	created time.Time // When the log file was started
+}
+
+// Open the log file (appending to it, if it exists) to rotate it by size and time
+func openRotatingFile(name string, maxSize int64, interval time.Duration, keep int) (*rotatingFile, error) {
+	f := &rotatingFile{name: name, maxSize: maxSize, interval: interval, keep: keep}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write the bytes to the log file, rotating it first if it is due
+func (f *rotatingFile) Write(b []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if (f.maxSize > 0 && f.size > 0 && f.size+int64(len(b)) > f.maxSize) || (f.interval > 0 && time.Since(f.created) >= f.interval) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(b)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close the log file
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+// Open the log file for appending
+func (f *rotatingFile) open() error {
+	if dir := filepath.Dir(f.name); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	file, err := os.OpenFile(f.name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.created = file, info.Size(), time.Now()
+	return nil
+}
+
+// Move the log file aside (under the current time), start a new one, and remove the old rotated files
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	ext := filepath.Ext(f.name)
+	rotated := strings.TrimSuffix(f.name, ext) + "-" + time.Now().Format(rotatedLogLayout) + ext
+	if err := os.Rename(f.name, rotated); err != nil {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	return f.prune()
+}
+
+// Remove the oldest rotated files, beyond the number to keep
+func (f *rotatingFile) prune() error {
+	if f.keep <= 0 {
+		return nil
+	}
+	dir, base := filepath.Split(f.name)
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext) + "-"
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return err
+	}
+	var rotated []string
+	for _, entry := range entries {
+		name := entry.Name()
+		timestamp, ok := strings.CutPrefix(strings.TrimSuffix(name, ext), prefix)
+		if _, err := time.Parse(rotatedLogLayout, timestamp); ok && err == nil && strings.HasSuffix(name, ext) {
+			rotated = append(rotated, name)
+		}
+	}
+	slices.Sort(rotated) // Oldest first, as the timestamps sort chronologically
+	for len(rotated) > f.keep {
+		if err := os.Remove(filepath.Join(dir, rotated[0])); err != nil {
+			return err
+		}
+		rotated = rotated[1:]
+	}
+	return nil
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Parse a size, like 512KB, 10MB or 1GB (or a number of bytes)
+func parseSize(value string) (int64, error) {
+	number := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"B", 1}} {
+		if strings.HasSuffix(number, unit.suffix) {
+			number, multiplier = strings.TrimSpace(strings.TrimSuffix(number, unit.suffix)), unit.size
+			break
+		}
+	}
+	size, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size %q (expected a size like 512KB, 10MB or 1GB)", value)
+	}
+	return size * multiplier, nil
+}
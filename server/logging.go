@@ -0,0 +1,255 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ===========
+// REQUEST LOG
+// ===========
+
+// The formats the requests can be logged in (besides the default, colored one), as used by
+// Apache and the log analyzers built for it (like GoAccess and AWStats)
+var logFormats = []string{"common", "combined"}
+
+// Middleware that logs the requests in the format, to the console (if enabled) and the log file (if any),
+// once served: with the status code, the size of the response and how long it took (by default),
+// or in the common and combined formats. In verbose mode, the request headers and the details of
+// how the request was resolved to a file follow on the console. The logger is also passed on to the
+// handlers in the context of the requests, to log their errors to (see requestLogger).
+func logRequests(logger *log.Logger, format string, console, verbose bool, file io.Writer, next http.Handler) http.Handler {
+	accessLog := log.New(logger.Writer(), "", 0) // The common and combined formats have timestamps of their own
+	var fileLog *log.Logger
+	if file != nil {
+		fileLog = log.New(file, "", 0)
+		if format == "" {
+			fileLog.SetFlags(log.LstdFlags) // Timestamp the lines, like the console
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		lw := &loggingWriter{ResponseWriter: w}
+		var details []string
+		r = r.WithContext(context.WithValue(r.Context(), loggerKey{}, logger))
+		if verbose && console {
+			r = r.WithContext(context.WithValue(r.Context(), logDetailsKey{}, &details))
+		}
+		next.ServeHTTP(lw, r) // Serve the files
+		if verbose && console {
+			defer logVerboseDetails(r, details) // After the line of the request itself
+		}
+		status := lw.status
+		if status == 0 {
+			status = http.StatusOK // Nothing was written
+		}
+
+		// Log the request
+		if format == "" {
+			elapsed := roundDuration(time.Since(start))
+			if console {
+				logger.Println(formatDefaultLogLine(stderrColor, r, status, lw.size, elapsed))
+			}
+			if fileLog != nil {
+				fileLog.Println(formatDefaultLogLine(false, r, status, lw.size, elapsed)) // Without the colors
+			}
+			return
+		}
+		line := formatLogLine(format, r, start, status, lw.size)
+		if console {
+			accessLog.Println(line)
+		}
+		if fileLog != nil {
+			fileLog.Println(line)
+		}
+	})
+}
+
+// The context key of the logger of the server that is serving a request
+type loggerKey struct{}
+
+// The logger of the server that is serving the request (or the standard logger, outside of logRequests)
+func requestLogger(r *http.Request) *log.Logger {
+	if logger, ok := r.Context().Value(loggerKey{}).(*log.Logger); ok {
+		return logger
+	}
+	return log.Default()
+}
+
+// Format the line for a served request in the default format, like
+// `-- 127.0.0.1:52414 GET /index.html 200 1.2 KB 350µs #3f9a1c2e` (colored, if enabled)
+func formatDefaultLogLine(color bool, r *http.Request, status int, size int64, elapsed time.Duration) string {
+	return fmt.Sprintf("%s %s %s %s %s",
+		colorize(color, colorGray, "-- "+r.RemoteAddr), colorize(color, colorGreen, r.Method), r.URL,
+		colorize(color, statusColor(status), strconv.Itoa(status)),
+		colorize(color, colorGray, fmt.Sprintf("%s %s #%s", humanSize(size), elapsed, r.Header.Get(requestIDHeader))))
+}
+
+// Format the line for a served request, like
+// `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /index.html HTTP/1.1" 200 2326`,
+// followed by the quoted referer and user agent in the combined format
+func formatLogLine(format string, r *http.Request, start time.Time, status int, size int64) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil || host == "" {
+		host = "-" // Served over a Unix domain socket
+	}
+	user := "-"
+	if username, _, ok := r.BasicAuth(); ok && username != "" {
+		user = escapeLogValue(username)
+	}
+	sent := "-"
+	if size > 0 {
+		sent = strconv.FormatInt(size, 10)
+	}
+	line := fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %s`,
+		host, user, start.Format("02/Jan/2006:15:04:05 -0700"),
+		escapeLogValue(r.Method), escapeLogValue(r.RequestURI), escapeLogValue(r.Proto), status, sent)
+	if format == "combined" {
+		line += fmt.Sprintf(` "%s" "%s"`, logValueOrDash(r.Referer()), logValueOrDash(r.UserAgent()))
+	}
+	return line
+}
+
+// -------
+// VERBOSE
+// -------
+
+// The context key of the details logged about a request, in verbose mode
+type logDetailsKey struct{}
+
+// Note a detail about how the request is being resolved (like the index file or the rewrite it is served with),
+// to log along with the request in verbose mode
+func logDetail(r *http.Request, format string, args ...any) {
+	if details, ok := r.Context().Value(logDetailsKey{}).(*[]string); ok {
+		*details = append(*details, fmt.Sprintf(format, args...))
+	}
+}
+
+// Log the request headers (sorted by name), and the details about how the request was resolved
+func logVerboseDetails(r *http.Request, details []string) {
+	requestLogger(r).Println(colorize(stderrColor, colorGray, "   > Host: "+r.Host)) // Which is not kept with the other headers
+	names := slices.Sorted(maps.Keys(r.Header))
+	for _, name := range names {
+		for _, value := range r.Header[name] {
+			if name == "Authorization" || name == "Cookie" {
+				value = "(redacted)" // Keep the credentials out of the logs
+			}
+			requestLogger(r).Println(colorize(stderrColor, colorGray, "   > "+name+": "+value))
+		}
+	}
+	for _, detail := range details {
+		requestLogger(r).Println(colorize(stderrColor, colorGray, "   "+detail))
+	}
+}
+
+// ---------------
+// RESPONSE WRITER
+// ---------------
+
+// A ResponseWriter that records the status code and the size of the response
+type loggingWriter struct {
+	http.ResponseWriter
+	status int   // The status code written (0 if none was written yet)
+	size   int64 // The number of bytes of the body written
+}
+
+// Record the status code, and write the header
+func (lw *loggingWriter) WriteHeader(status int) {
+	if lw.status == 0 || lw.status < 200 { // Informational statuses (like 103 Early Hints) come before the final one
+		lw.status = status
+	}
+	lw.ResponseWriter.WriteHeader(status)
+}
+
+// Write the body, recording its size
+func (lw *loggingWriter) Write(b []byte) (int, error) {
+	if lw.status == 0 {
+		lw.status = http.StatusOK
+	}
+	n, err := lw.ResponseWriter.Write(b)
+	lw.size += int64(n)
+	return n, err
+}
+
+// Flush the data written so far to the client (for the live reload event stream)
+func (lw *loggingWriter) Flush() {
+	if flusher, ok := lw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Take over the connection (for WebSockets)
+func (lw *loggingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if lw.status == 0 {
+		lw.status = http.StatusSwitchingProtocols
+	}
+	return http.NewResponseController(lw.ResponseWriter).Hijack()
+}
+
+// Unwrap the underlying ResponseWriter (for http.ResponseController)
+func (lw *loggingWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Escape the quotes, backslashes and control characters of the value, to keep it on one line and within its quotes
+func escapeLogValue(value string) string {
+	var sb strings.Builder
+	for _, c := range []byte(value) {
+		switch {
+		case c == '"' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&sb, `\x%02x`, c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// The color of the status code: green for success, cyan for redirects, yellow for client
+// errors and red for server errors
+func statusColor(status int) string {
+	switch {
+	case status >= 500:
+		return colorRed
+	case status >= 400:
+		return colorYellow
+	case status >= 300:
+		return colorCyan
+	default:
+		return colorGreen
+	}
+}
+
+// Round the duration to a readable precision (like 1.2ms or 350µs)
+func roundDuration(d time.Duration) time.Duration {
+	if d >= time.Millisecond {
+		return d.Round(100 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
+
+// The escaped value, or a dash if it is empty
+func logValueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return escapeLogValue(value)
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"html/template"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+// ========
+// MARKDOWN
+// ========
+
+// The markdown converter, with GitHub Flavored Markdown (tables, task lists, etc.)
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+	goldmark.WithRendererOptions(html.WithUnsafe()), // Allow raw HTML, as the served files are trusted
+)
+
+// Middleware that renders markdown files as styled HTML pages (or in the `layout:`
+// named by their frontmatter). The raw markdown is still served with `?raw`.
+func renderMarkdown(fsys http.FileSystem, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || !isMarkdown(r.URL.Path) || r.URL.Query().Has("raw") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		file, err := fsys.Open(r.URL.Path)
+		if err != nil {
+			next.ServeHTTP(w, r) // Leave the error to the file server
+			return
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil || info.IsDir() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		source, err := io.ReadAll(file)
+		if err != nil {
+			requestLogger(r).Println("Could not read the markdown file:", err)
+			http.Error(w, "Error reading file", http.StatusInternalServerError)
+			return
+		}
+
+		page, err := renderMarkdownPage(fsys, source, r.URL.Path)
+		if err != nil {
+			requestLogger(r).Println("Could not render the markdown file:", err)
+			http.Error(w, "Error rendering markdown", http.StatusInternalServerError)
+			return
+		}
+		logDetail(r, "Rendering the markdown file %s as HTML", r.URL.Path)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		http.ServeContent(w, r, info.Name(), info.ModTime(), bytes.NewReader(page))
+	})
+}
+
+// Render the markdown source as a complete HTML page, using the layout named by the
+// frontmatter (or the default markdown template)
+func renderMarkdownPage(fsys http.FileSystem, source []byte, urlPath string) ([]byte, error) {
+	matter, source, err := parseFrontmatter(source)
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	if err := markdown.Convert(source, &body); err != nil {
+		return nil, err
+	}
+	data := pageData{
+		Title:   frontmatterTitle(matter, markdownTitle(source, path.Base(urlPath))),
+		Content: template.HTML(body.String()),
+		Page:    matter,
+		Path:    urlPath,
+	}
+	if _, ok := matter["layout"]; ok {
+		return applyLayout(fsys, matter, data)
+	}
+	var page bytes.Buffer
+	err = markdownTemplate.Execute(&page, data)
+	return page.Bytes(), err
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Boolean indicating whether the file is a markdown file
+func isMarkdown(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".md", ".markdown":
+		return true
+	}
+	return false
+}
+
+// The title of the markdown document (its first top-level heading), defaulting to the file name
+func markdownTitle(source []byte, name string) string {
+	scanner := bufio.NewScanner(bytes.NewReader(source))
+	for scanner.Scan() {
+		if title, ok := strings.CutPrefix(scanner.Text(), "# "); ok {
+			return strings.TrimSpace(title)
+		}
+	}
+	return name
+}
+
+// --------
+// TEMPLATE
+// --------
+
+// The HTML template for rendered markdown pages
+var markdownTemplate = template.Must(template.New("markdown").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+	:root { color-scheme: light dark; --muted: #888; --border: rgba(127, 127, 127, 0.3); --code: rgba(127, 127, 127, 0.12); }
+	body { font-family: system-ui, sans-serif; line-height: 1.6; margin: 2rem auto; max-width: 800px; padding: 0 1rem; }
+	h1, h2 { border-bottom: 1px solid var(--border); padding-bottom: 0.3em; }
+	h1, h2, h3, h4, h5, h6 { font-weight: 600; line-height: 1.25; margin: 1.5em 0 0.75em; }
+	a { color: #0969da; }
+	@media (prefers-color-scheme: dark) { a { color: #4493f8; } }
+	code, pre { background: var(--code); border-radius: 6px; font-family: ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; font-size: 0.9em; }
+	code { padding: 0.2em 0.4em; }
+	pre { overflow: auto; padding: 1rem; }
+	pre code { background: none; padding: 0; }
+	blockquote { border-left: 0.25em solid var(--border); color: var(--muted); margin: 0; padding: 0 1em; }
+	table { border-collapse: collapse; display: block; overflow: auto; }
+	th, td { border: 1px solid var(--border); padding: 0.4rem 0.8rem; }
+	img { max-width: 100%; }
+	hr { border: 0; border-top: 1px solid var(--border); }
+</style>
+</head>
+<body>
+{{.Content}}
+</body>
+</html>
+`))
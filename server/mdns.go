@@ -0,0 +1,167 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// ====
+// MDNS
+// ====
+
+// The multicast group and port of mDNS queries and responses
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// How long the advertised records can be cached for, in seconds
+const mdnsTTL = 120
+
+// The pattern of the names that can be advertised (a single DNS label)
+var mdnsNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// An mDNS responder that advertises the server on the local network (as `name.local`,
+// and as an `_http._tcp` service instance for Bonjour browsers)
+type mdnsResponder struct {
+	host     string       // The host name (like `myproject.local.`)
+	service  string       // The service type (like `_http._tcp.local.`)
+	instance string       // The service instance (like `myproject._http._tcp.local.`)
+	port     int          // The port the server listens on
+	conn     *net.UDPConn // The connection to the multicast group
+}
+
+// Parse a --mdns value into the name to advertise (without the `.local` suffix)
+func parseMDNSName(value string) (string, error) {
+	name := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(value)), ".local")
+	if !mdnsNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid mDNS name %q (expected letters, digits and dashes, like myproject)", value)
+	}
+	return name, nil
+}
+
+// Start advertising the server under the name, and answering the queries for it
+func startMDNS(name, scheme string, port int) (*mdnsResponder, error) {
+	conn, err := net.ListenMulticastUDP("udp4", nil, mdnsGroup)
+	if err != nil {
+		return nil, err
+	}
+	service := "_" + scheme + "._tcp.local."
+	m := &mdnsResponder{
+		host:     name + ".local.",
+		service:  service,
+		instance: name + "." + service,
+		port:     port,
+		conn:     conn,
+	}
+	go m.serve()
+	go func() {
+		// Announce the records (twice, a second apart, in case the first one is lost)
+		for i := 0; i < 2; i++ {
+			if err := m.send(dnsmessage.Header{}, nil, mdnsTTL, mdnsGroup); err != nil {
+				log.Println("Could not announce over mDNS:", err)
+			}
+			time.Sleep(time.Second)
+		}
+	}()
+	return m, nil
+}
+
+// Answer the queries for the advertised names, until the connection is closed
+func (m *mdnsResponder) serve() {
+	buf := make([]byte, 9000)
+	for {
+		n, addr, err := m.conn.ReadFromUDP(buf)
+		if err != nil {
+			return // The responder was closed
+		}
+		var parser dnsmessage.Parser
+		header, err := parser.Start(buf[:n])
+		if err != nil || header.Response {
+			continue
+		}
+		questions, err := parser.AllQuestions()
+		if err != nil || !m.isAsked(questions) {
+			continue
+		}
+
+		// Respond to the multicast group, except to one-shot (legacy unicast) queries,
+		// which do not come from the mDNS port and expect a regular DNS response
+		if addr.Port != mdnsGroup.Port {
+			err = m.send(dnsmessage.Header{ID: header.ID}, questions, 10, addr)
+		} else {
+			err = m.send(dnsmessage.Header{}, nil, mdnsTTL, mdnsGroup)
+		}
+		if err != nil {
+			log.Println("Could not respond over mDNS:", err)
+		}
+	}
+}
+
+// Stop advertising the server, telling the network to forget the records
+func (m *mdnsResponder) Close() error {
+	m.send(dnsmessage.Header{}, nil, 0, mdnsGroup) // A TTL of 0 says goodbye
+	return m.conn.Close()
+}
+
+// Boolean indicating whether any of the questions are about the advertised names
+func (m *mdnsResponder) isAsked(questions []dnsmessage.Question) bool {
+	for _, q := range questions {
+		name := q.Name.String()
+		for _, ours := range []string{m.host, m.service, m.instance} {
+			if strings.EqualFold(name, ours) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Send a response with all of the records (with the TTL) to the address (the multicast group, or
+// the sender of a legacy unicast query, which does not know about cache flushing)
+func (m *mdnsResponder) send(header dnsmessage.Header, questions []dnsmessage.Question, ttl uint32, addr *net.UDPAddr) error {
+	header.Response, header.Authoritative = true, true
+	message := dnsmessage.Message{Header: header, Questions: questions, Answers: m.records(ttl, addr == mdnsGroup)}
+	packet, err := message.Pack()
+	if err != nil {
+		return err
+	}
+	_, err = m.conn.WriteToUDP(packet, addr)
+	return err
+}
+
+// The records that advertise the server: the PTR, SRV and TXT records of the service instance,
+// and the A and AAAA records of the host. The unique records get the cache-flush bit, if flush is set.
+func (m *mdnsResponder) records(ttl uint32, flush bool) []dnsmessage.Resource {
+	host, service, instance := dnsmessage.MustNewName(m.host), dnsmessage.MustNewName(m.service), dnsmessage.MustNewName(m.instance)
+	unique := dnsmessage.ClassINET
+	if flush {
+		unique |= 0x8000 // The cache-flush bit, as nobody else owns these records
+	}
+	records := []dnsmessage.Resource{
+		{
+			Header: dnsmessage.ResourceHeader{Name: service, Class: dnsmessage.ClassINET, TTL: ttl},
+			Body:   &dnsmessage.PTRResource{PTR: instance},
+		},
+		{
+			Header: dnsmessage.ResourceHeader{Name: instance, Class: unique, TTL: ttl},
+			Body:   &dnsmessage.SRVResource{Target: host, Port: uint16(m.port)},
+		},
+		{
+			Header: dnsmessage.ResourceHeader{Name: instance, Class: unique, TTL: ttl},
+			Body:   &dnsmessage.TXTResource{TXT: []string{"path=/"}},
+		},
+	}
+	for _, ip := range lanIPs() {
+		header := dnsmessage.ResourceHeader{Name: host, Class: unique, TTL: ttl}
+		if ip4 := ip.To4(); ip4 != nil {
+			records = append(records, dnsmessage.Resource{Header: header, Body: &dnsmessage.AResource{A: [4]byte(ip4)}})
+		} else {
+			records = append(records, dnsmessage.Resource{Header: header, Body: &dnsmessage.AAAAResource{AAAA: [16]byte(ip.To16())}})
+		}
+	}
+	return records
+}
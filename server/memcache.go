@@ -0,0 +1,214 @@
+package server
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"sync"
+)
+
+// ============
+// MEMORY CACHE
+// ============
+
+// The share of the memory cache a single file can take up (files larger than this are read from the disk)
+const maxCachedFileShare = 8
+
+// A cache of the contents of the most recently served files (and their compressed variants), up to
+// a total size in bytes. Each file is kept by its path and validated by its modification time and
+// size, so that a changed file is read afresh (and the file watcher drops the changed files early).
+type memoryCache struct {
+	maxSize int64 // The maximum total size of the cached contents
+
+	mu      sync.Mutex
+	size    int64                    // The total size of the cached contents
+	lru     *list.List               // The cached files, the most recently served first
+	entries map[string]*list.Element // The cached files' elements in the list, by key
+}
+
+// A file's contents in the memory cache
+type cacheEntry struct {
+	key      string            // The key of the file (its site's directory and its path)
+	info     fs.FileInfo       // The file's info, when its contents were read
+	data     []byte            // The file's contents
+	variants map[string][]byte // The file's contents compressed on the fly, by encoding
+}
+
+// Create an empty memory cache of the size
+func newMemoryCache(maxSize int64) *memoryCache {
+	return &memoryCache{maxSize: maxSize, lru: list.New(), entries: map[string]*list.Element{}}
+}
+
+// The file system that serves the files of the site's directory from the cache
+func (mc *memoryCache) fileSystem(dir string, fsys http.FileSystem) http.FileSystem {
+	return cachedFS{fsys, mc, dir}
+}
+
+// The cached entry of the file, if its contents are still current
+func (mc *memoryCache) get(key string, info fs.FileInfo) *cacheEntry {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	element, ok := mc.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := element.Value.(*cacheEntry)
+	if !entry.info.ModTime().Equal(info.ModTime()) || entry.info.Size() != info.Size() {
+		mc.remove(element) // The file has changed since
+		return nil
+	}
+	mc.lru.MoveToFront(element)
+	return entry
+}
+
+// Cache the contents of the file, evicting the least recently served files to make room
+func (mc *memoryCache) put(key string, info fs.FileInfo, data []byte) *cacheEntry {
+	entry := &cacheEntry{key: key, info: info, data: data, variants: map[string][]byte{}}
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if element, ok := mc.entries[key]; ok {
+		mc.remove(element)
+	}
+	mc.entries[key] = mc.lru.PushFront(entry)
+	mc.size += int64(len(data))
+	mc.evict()
+	return entry
+}
+
+// The contents of the cached file compressed with the encoding, compressing them on first use
+func (mc *memoryCache) compressed(entry *cacheEntry, enc encoding) ([]byte, error) {
+	mc.mu.Lock()
+	data, ok := entry.variants[enc.name]
+	mc.mu.Unlock()
+	if ok {
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	writer := enc.newWriter(&buf)
+	if _, err := writer.Write(entry.data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if element, ok := mc.entries[entry.key]; ok && element.Value == entry {
+		if _, ok := entry.variants[enc.name]; !ok {
+			entry.variants[enc.name] = buf.Bytes()
+			mc.size += int64(buf.Len())
+			mc.evict()
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Drop the changed files of the site's directory (as reported by the file watcher)
+func (mc *memoryCache) invalidate(dir string, paths []string) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if len(paths) == 0 {
+		mc.lru.Init() // Unknown changes, drop everything
+		clear(mc.entries)
+		mc.size = 0
+		return
+	}
+	for _, name := range paths {
+		if element, ok := mc.entries[dir+name]; ok {
+			mc.remove(element)
+		}
+	}
+}
+
+// Remove the least recently served files until the cache fits in its size (with mu held)
+func (mc *memoryCache) evict() {
+	for mc.size > mc.maxSize && mc.lru.Len() > 0 {
+		mc.remove(mc.lru.Back())
+	}
+}
+
+// Remove the file from the cache (with mu held)
+func (mc *memoryCache) remove(element *list.Element) {
+	entry := mc.lru.Remove(element).(*cacheEntry)
+	delete(mc.entries, entry.key)
+	mc.size -= int64(len(entry.data))
+	for _, variant := range entry.variants {
+		mc.size -= int64(len(variant))
+	}
+}
+
+// ------------
+// CACHED FILES
+// ------------
+
+// A file system that serves the regular files from the memory cache, reading them into it on first use
+type cachedFS struct {
+	http.FileSystem
+	cache *memoryCache // The cache to keep the files in
+	dir   string       // The directory of the site, to tell its files apart from other sites' in the cache
+}
+
+// Open the file, from the cache if its contents are current
+func (c cachedFS) Open(name string) (http.File, error) {
+	file, err := c.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return file, nil // Directories (and the like) are left to the file system
+	}
+
+	key := c.dir + name
+	if entry := c.cache.get(key, info); entry != nil {
+		file.Close()
+		return &memoryFile{bytes.NewReader(entry.data), entry, c.cache}, nil
+	}
+	if info.Size() > c.cache.maxSize/maxCachedFileShare {
+		return file, nil // Too large to cache
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	entry := c.cache.put(key, info, data)
+	return &memoryFile{bytes.NewReader(entry.data), entry, c.cache}, nil
+}
+
+// A file served from the memory cache
+type memoryFile struct {
+	*bytes.Reader
+	entry *cacheEntry  // The cached file
+	cache *memoryCache // The cache the file is in (for its compressed variants)
+}
+
+// Nothing to close, as the contents stay in the cache
+func (f *memoryFile) Close() error {
+	return nil
+}
+
+// The info of the file, from when its contents were read
+func (f *memoryFile) Stat() (fs.FileInfo, error) {
+	return f.entry.info, nil
+}
+
+// A regular file has no directory entries
+func (f *memoryFile) Readdir(count int) ([]fs.FileInfo, error) {
+	return nil, errors.New("not a directory")
+}
+
+// The whole contents compressed with the encoding, if the file has not been read from yet
+// (to serve the cached variant of the compressed response, in place of compressing it again)
+func (f *memoryFile) compressed(enc encoding) ([]byte, bool) {
+	if f.Len() != len(f.entry.data) {
+		return nil, false
+	}
+	data, err := f.cache.compressed(f.entry, enc)
+	return data, err == nil
+}
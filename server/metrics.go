@@ -0,0 +1,175 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// =======
+// METRICS
+// =======
+
+// The default path of the metrics endpoint
+const defaultMetricsPath = "/__metrics"
+
+// The upper bounds of the buckets of the request duration histogram, in seconds
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// The upper bounds of the buckets of the response size histogram, in bytes
+var sizeBuckets = []float64{100, 1 << 10, 10 << 10, 100 << 10, 1 << 20, 10 << 20, 100 << 20}
+
+// The metrics of the requests served, exposed in the Prometheus text format
+type metrics struct {
+	started  time.Time    // When the server started
+	inFlight atomic.Int64 // The number of requests being served
+
+	mu       sync.Mutex
+	requests map[requestLabels]int64 // The number of requests served, by method and status code
+	duration *histogram              // How long the requests took to serve
+	size     *histogram              // The sizes of the responses
+}
+
+// The labels of a request
+type requestLabels struct {
+	method string
+	code   int
+}
+
+// Create an empty set of metrics
+func newMetrics() *metrics {
+	return &metrics{
+		started:  time.Now(),
+		requests: make(map[requestLabels]int64),
+		duration: newHistogram(durationBuckets),
+		size:     newHistogram(sizeBuckets),
+	}
+}
+
+// Middleware that records the metrics of the requests
+func (m *metrics) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.inFlight.Add(1)
+		defer m.inFlight.Add(-1)
+		start := time.Now()
+		lw := &loggingWriter{ResponseWriter: w}
+		next.ServeHTTP(lw, r)
+
+		status := lw.status
+		if status == 0 {
+			status = http.StatusOK // Nothing was written
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.requests[requestLabels{normalizeMethod(r.Method), status}]++
+		m.duration.observe(time.Since(start).Seconds())
+		m.size.observe(float64(lw.size))
+	})
+}
+
+// Middleware that serves the metrics at the path
+func (m *metrics) serve(path string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		m.write(w)
+	})
+}
+
+// Write out the metrics in the Prometheus text format
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP self_serve_requests_total The number of requests served, by method and status code.")
+	fmt.Fprintln(w, "# TYPE self_serve_requests_total counter")
+	labels := slices.SortedFunc(maps.Keys(m.requests), func(a, b requestLabels) int {
+		if a.method != b.method {
+			return strings.Compare(a.method, b.method)
+		}
+		return a.code - b.code
+	})
+	for _, l := range labels {
+		fmt.Fprintf(w, "self_serve_requests_total{method=%q,code=\"%d\"} %d\n", l.method, l.code, m.requests[l])
+	}
+
+	fmt.Fprintln(w, "# HELP self_serve_requests_in_flight The number of requests being served.")
+	fmt.Fprintln(w, "# TYPE self_serve_requests_in_flight gauge")
+	fmt.Fprintf(w, "self_serve_requests_in_flight %d\n", m.inFlight.Load())
+
+	fmt.Fprintln(w, "# HELP self_serve_request_duration_seconds How long the requests took to serve.")
+	fmt.Fprintln(w, "# TYPE self_serve_request_duration_seconds histogram")
+	m.duration.write(w, "self_serve_request_duration_seconds")
+
+	fmt.Fprintln(w, "# HELP self_serve_response_size_bytes The sizes of the response bodies.")
+	fmt.Fprintln(w, "# TYPE self_serve_response_size_bytes histogram")
+	m.size.write(w, "self_serve_response_size_bytes")
+
+	fmt.Fprintln(w, "# HELP self_serve_start_time_seconds When the server started, in seconds since the Unix epoch.")
+	fmt.Fprintln(w, "# TYPE self_serve_start_time_seconds gauge")
+	fmt.Fprintf(w, "self_serve_start_time_seconds %d\n", m.started.Unix())
+}
+
+// ---------
+// HISTOGRAM
+// ---------
+
+// A histogram of observed values, in cumulative buckets
+type histogram struct {
+	bounds []float64 // The upper bounds of the buckets
+	counts []int64   // The number of values in each bucket (not cumulative)
+	count  int64     // The number of values observed
+	sum    float64   // The sum of the values observed
+}
+
+// Create an empty histogram with the buckets
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]int64, len(bounds))}
+}
+
+// Observe a value
+func (h *histogram) observe(value float64) {
+	if i, _ := slices.BinarySearch(h.bounds, value); i < len(h.bounds) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += value
+}
+
+// Write out the buckets, the sum and the count under the name
+func (h *histogram) write(w io.Writer, name string) {
+	var cumulative int64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, strconv.FormatFloat(bound, 'f', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// The method as a label, with the non-standard methods grouped together (so that clients
+// cannot create an unbounded number of series)
+func normalizeMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, "MKCOL":
+		return method
+	}
+	return "OTHER"
+}
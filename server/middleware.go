@@ -0,0 +1,28 @@
+package server
+
+import (
+	"net/http"
+)
+
+// ==========
+// MIDDLEWARE
+// ==========
+
+// A middleware wraps the next handler in a handler of its own, to serve the requests before (or in place of) it
+type Middleware func(next http.Handler) http.Handler
+
+// Add the middleware around the routes of the server (the files, the proxies, the mock API and so on),
+// in the order added (the first outermost). The requests reach the middleware once they have been
+// logged, counted and authenticated, and after the built-in endpoints (like /__status). It takes
+// effect on the next Serve.
+func (s *Self) Use(middleware ...Middleware) {
+	s.middleware = append(s.middleware, middleware...)
+}
+
+// Wrap the handler in the middleware, the first of it outermost
+func chain(handler http.Handler, middleware ...Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"runtime/debug"
+)
+
+// ===========
+// MEMORY MAPS
+// ===========
+
+// The error of reading a memory-mapped file that was truncated while it was being served
+var errMappedFileChanged = errors.New("the memory-mapped file was truncated while being read")
+
+// A file system that serves the regular files of at least the minimum size from memory maps
+// (where supported), so that they are read straight from the page cache rather than copied
+// through buffers, and seeking into them for range requests is free
+type mmapFS struct {
+	http.FileSystem
+	minSize int64 // The size of the files to map, and up
+}
+
+// Open the file, mapping it into memory if it is large enough
+func (m mmapFS) Open(name string) (http.File, error) {
+	file, err := m.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	osFile, ok := file.(*os.File) // Only the files on the disk can be mapped (not those of archives)
+	if !ok {
+		return file, nil
+	}
+	info, err := osFile.Stat()
+	if err != nil || !info.Mode().IsRegular() || info.Size() < m.minSize || info.Size() == 0 {
+		return file, nil
+	}
+	data, err := mmapFile(osFile, info.Size())
+	if err != nil {
+		return file, nil // Serve it as usual, where it cannot be mapped
+	}
+	return &mappedFile{file: osFile, data: data}, nil
+}
+
+// A file served from its memory map
+type mappedFile struct {
+	file   *os.File // The mapped file (for its info)
+	data   []byte   // The mapped contents
+	offset int64    // The offset of the next read
+}
+
+// Read from the mapped contents. If the file is truncated meanwhile, reading past its new end
+// faults, which is turned into an error rather than crashing the server.
+func (f *mappedFile) Read(p []byte) (n int, err error) {
+	if f.offset >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if recover() != nil {
+			n, err = 0, errMappedFileChanged
+		}
+	}()
+	n = copy(p, f.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+// Seek to the offset, for range requests
+func (f *mappedFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.data))
+	}
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Unmap the contents, and close the file
+func (f *mappedFile) Close() error {
+	err := munmapFile(f.data)
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// The info of the file
+func (f *mappedFile) Stat() (fs.FileInfo, error) {
+	return f.file.Stat()
+}
+
+// A regular file has no directory entries
+func (f *mappedFile) Readdir(count int) ([]fs.FileInfo, error) {
+	return nil, errors.New("not a directory")
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package server
+
+import (
+	"errors"
+	"os"
+)
+
+// Memory maps are not supported here, so the files are served as usual
+func mmapFile(file *os.File, size int64) ([]byte, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// Nothing was mapped, so there is nothing to unmap
+func munmapFile(data []byte) error {
+	return nil
+}
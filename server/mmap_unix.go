@@ -0,0 +1,22 @@
+//go:build unix
+
+package server
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// Map the contents of the file into memory, read-only
+func mmapFile(file *os.File, size int64) ([]byte, error) {
+	if int64(int(size)) != size {
+		return nil, errors.New("too large to map") // Beyond the address space (of 32-bit systems)
+	}
+	return syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// Unmap the contents of the file
+func munmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
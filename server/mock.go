@@ -0,0 +1,267 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ========
+// MOCK API
+// ========
+
+// The query parameters handled by the server itself (like `?token=` and `?view=source`), which are not
+// field filters. The archive downloads' parameters (like `?zip`) are not either.
+var reservedQueryParams = []string{"token", "view", "raw", "__reload"}
+
+// A mock REST API backed by JSON files (in the style of json-server). Each `name.json`
+// file becomes a resource at `/name`: arrays are collections of items (identified by
+// their `id`), and anything else is a singular resource. Changes are kept in memory,
+// the files are never modified.
+type mockAPI struct {
+	mu        sync.Mutex     // Guards the resources
+	resources map[string]any // The resources by name
+}
+
+// Load the JSON files in the directory as the resources of a mock API
+func loadMockAPI(dir string) (*mockAPI, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	api := &mockAPI{resources: map[string]any{}}
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		var resource any
+		if err := json.Unmarshal(data, &resource); err != nil {
+			return nil, fmt.Errorf("invalid JSON in %s: %w", name, err)
+		}
+		api.resources[strings.TrimSuffix(filepath.Base(name), ".json")] = resource
+	}
+	if len(api.resources) == 0 {
+		return nil, fmt.Errorf("no JSON files found in %s", dir)
+	}
+	return api, nil
+}
+
+// Middleware that serves the mock API's resources, leaving all other paths to the next handler
+func (api *mockAPI) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, id, _ := strings.Cut(strings.Trim(r.URL.Path, "/"), "/")
+		api.mu.Lock()
+		resource, ok := api.resources[name]
+		if !ok || strings.Contains(id, "/") {
+			api.mu.Unlock()
+			next.ServeHTTP(w, r)
+			return
+		}
+		defer api.mu.Unlock()
+
+		items, isCollection := resource.([]any)
+		switch {
+		case !isCollection:
+			api.serveSingular(w, r, name, id)
+		case id == "":
+			api.serveCollection(w, r, name, items)
+		default:
+			api.serveItem(w, r, name, items, id)
+		}
+	})
+}
+
+// Serve a request for a collection (e.g. `GET /users` or `POST /users`)
+func (api *mockAPI) serveCollection(w http.ResponseWriter, r *http.Request, name string, items []any) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		writeJSON(w, http.StatusOK, filterItems(items, r.URL.Query()))
+	case http.MethodPost:
+		item, err := readJSONObject(r)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if _, ok := item["id"]; !ok {
+			item["id"] = nextID(items)
+		}
+		api.resources[name] = append(items, item)
+		writeJSON(w, http.StatusCreated, item)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+// Serve a request for an item in a collection (e.g. `GET /users/3`)
+func (api *mockAPI) serveItem(w http.ResponseWriter, r *http.Request, name string, items []any, id string) {
+	index := findItem(items, id)
+	if index < 0 {
+		writeJSONError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	item := items[index].(map[string]any)
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		writeJSON(w, http.StatusOK, item)
+	case http.MethodPut, http.MethodPatch:
+		update, err := readJSONObject(r)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if r.Method == http.MethodPatch {
+			update = mergeObjects(item, update)
+		}
+		update["id"] = item["id"] // The id cannot be changed
+		items[index] = update
+		writeJSON(w, http.StatusOK, update)
+	case http.MethodDelete:
+		api.resources[name] = append(items[:index:index], items[index+1:]...)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, PATCH, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+// Serve a request for a singular resource (e.g. `GET /profile`)
+func (api *mockAPI) serveSingular(w http.ResponseWriter, r *http.Request, name string, id string) {
+	if id != "" {
+		writeJSONError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		writeJSON(w, http.StatusOK, api.resources[name])
+	case http.MethodPut, http.MethodPatch:
+		update, err := readJSONObject(r)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if current, ok := api.resources[name].(map[string]any); ok && r.Method == http.MethodPatch {
+			update = mergeObjects(current, update)
+		}
+		api.resources[name] = update
+		writeJSON(w, http.StatusOK, update)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, PATCH")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// The items whose fields equal the query parameters (e.g. `?role=admin`), besides the reserved ones
+func filterItems(items []any, query map[string][]string) []any {
+	filtered := make([]any, 0, len(items))
+	for _, item := range items {
+		object, _ := item.(map[string]any)
+		matches := true
+		for field, values := range query {
+			if isReservedQueryParam(field) {
+				continue
+			}
+			if object == nil || formatField(object[field]) != values[0] {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered
+}
+
+// The index of the item with the id (-1 if there is none)
+func findItem(items []any, id string) int {
+	for i, item := range items {
+		if object, ok := item.(map[string]any); ok && object["id"] != nil && formatField(object["id"]) == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Boolean indicating whether the query parameter is one of the server's own, rather than a field filter
+func isReservedQueryParam(name string) bool {
+	return slices.Contains(reservedQueryParams, name) ||
+		slices.ContainsFunc(archiveFormats, func(format archiveFormat) bool { return format.query == name })
+}
+
+// The field's value as it would appear in a URL: JSON numbers in full (1000000, not 1e+06)
+func formatField(value any) string {
+	if number, ok := value.(float64); ok {
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// The id for a new item: one more than the largest numeric id in the collection
+func nextID(items []any) float64 {
+	largest := 0.0
+	for _, item := range items {
+		if object, ok := item.(map[string]any); ok {
+			if id, ok := object["id"].(float64); ok && id > largest {
+				largest = id
+			}
+		}
+	}
+	return largest + 1
+}
+
+// A copy of the object with the fields of the update applied
+func mergeObjects(object, update map[string]any) map[string]any {
+	merged := make(map[string]any, len(object)+len(update))
+	for key, value := range object {
+		merged[key] = value
+	}
+	for key, value := range update {
+		merged[key] = value
+	}
+	return merged
+}
+
+// Read the request body as a JSON object
+func readJSONObject(r *http.Request) (map[string]any, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	object := map[string]any{}
+	if err := json.Unmarshal(body, &object); err != nil {
+		return nil, fmt.Errorf("expected a JSON object: %w", err)
+	}
+	return object, nil
+}
+
+// Write the value as an indented JSON response with the status
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		log.Println("Could not write the JSON response:", err)
+	}
+}
+
+// Write a JSON error response (e.g. `{"error": "Not Found"}`) with the status
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
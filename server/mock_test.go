@@ -0,0 +1,78 @@
+package server
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+)
+
+func TestFilterItems(t *testing.T) {
+	var items []any
+	if err := json.Unmarshal([]byte(`[
+		{"id": 1, "role": "admin", "active": true},
+		{"id": 2, "role": "user", "active": false},
+		{"id": 1000000, "role": "user", "active": true, "score": 0.5}
+	]`), &items); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		ids   []string
+	}{
+		{query: "", ids: []string{"1", "2", "1000000"}},
+		{query: "role=user", ids: []string{"2", "1000000"}},
+		{query: "role=user&active=true", ids: []string{"1000000"}},
+		{query: "id=1000000", ids: []string{"1000000"}},
+		{query: "score=0.5", ids: []string{"1000000"}},
+		{query: "role=guest", ids: []string{}},
+		{query: "token=secret", ids: []string{"1", "2", "1000000"}},
+		{query: "role=admin&token=secret&view=source&__reload=1", ids: []string{"1"}},
+		{query: "zip", ids: []string{"1", "2", "1000000"}},
+	}
+	for _, tt := range tests {
+		query, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filtered := filterItems(items, query)
+		ids := []string{}
+		for _, item := range filtered {
+			ids = append(ids, formatField(item.(map[string]any)["id"]))
+		}
+		if len(ids) != len(tt.ids) {
+			t.Errorf("filterItems(?%s) = %v, want %v", tt.query, ids, tt.ids)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != tt.ids[i] {
+				t.Errorf("filterItems(?%s) = %v, want %v", tt.query, ids, tt.ids)
+				break
+			}
+		}
+	}
+}
+
+func TestFindItem(t *testing.T) {
+	var items []any
+	if err := json.Unmarshal([]byte(`[{"id": 1}, {"id": "abc"}, {"id": 1000000}, {"id": 2.5}, {"name": "no id"}]`), &items); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		id    string
+		index int
+	}{
+		{id: "1", index: 0},
+		{id: "abc", index: 1},
+		{id: "1000000", index: 2},
+		{id: "2.5", index: 3},
+		{id: "1e+06", index: -1},
+		{id: "<nil>", index: -1},
+		{id: "3", index: -1},
+	}
+	for _, tt := range tests {
+		if index := findItem(items, tt.id); index != tt.index {
+			t.Errorf("findItem(%q) = %d, want %d", tt.id, index, tt.index)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+// ============
+// MOUNT POINTS
+// ============
+
+// A directory mounted at a URL prefix
+type mount struct {
+	prefix string          // The URL prefix (like `/docs`)
+	dir    string          // The directory on disk
+	fsys   http.FileSystem // The files of the directory
+}
+
+// Parse a --mount value (in the form `/prefix=dir`) into a mount point
+func parseMount(value string) (mount, error) {
+	prefix, dir, ok := strings.Cut(value, "=")
+	prefix = path.Clean("/" + strings.TrimSpace(prefix))
+	dir = strings.TrimSpace(dir)
+	if !ok || prefix == "/" || dir == "" {
+		return mount{}, fmt.Errorf("invalid mount %q (expected /prefix=dir)", value)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return mount{}, fmt.Errorf("invalid mount %q (%s is not a directory)", value, dir)
+	}
+	return mount{prefix: prefix, dir: dir, fsys: http.Dir(dir)}, nil
+}
+
+// Parse the --mount values, ordered with the longest (most specific) prefixes first
+func parseMounts(values []string) ([]mount, error) {
+	mounts := make([]mount, 0, len(values))
+	for _, value := range values {
+		m, err := parseMount(value)
+		if err != nil {
+			return nil, err
+		}
+		mounts = append(mounts, m)
+	}
+	slices.SortStableFunc(mounts, func(a, b mount) int { return len(b.prefix) - len(a.prefix) })
+	return mounts, nil
+}
+
+// A file system that serves the mounted directories under their prefixes, and the
+// underlying file system everywhere else. Mount points show up in their parents' listings.
+type mountFS struct {
+	http.FileSystem
+	mounts []mount
+}
+
+// Open the named file from the directory mounted at its prefix (or the underlying file system)
+func (fsys mountFS) Open(name string) (http.File, error) {
+	name = path.Clean("/" + name)
+	for _, m := range fsys.mounts {
+		if name == m.prefix || strings.HasPrefix(name, m.prefix+"/") {
+			return m.fsys.Open("/" + strings.TrimPrefix(name, m.prefix))
+		}
+	}
+	file, err := fsys.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// List the mount points in the directory, along with its own entries
+	var mounted []fs.FileInfo
+	for _, m := range fsys.mounts {
+		if path.Dir(m.prefix) != name {
+			continue
+		}
+		if info, err := stat(m.fsys, "/"); err == nil {
+			mounted = append(mounted, renamedInfo{info, path.Base(m.prefix)})
+		}
+	}
+	if len(mounted) == 0 {
+		return file, nil
+	}
+	return &mountedDir{File: file, mounted: mounted}, nil
+}
+
+// A directory containing mount points
+type mountedDir struct {
+	http.File
+	mounted []fs.FileInfo // The mount points in the directory
+	listed  bool          // Whether the mount points have been listed already
+}
+
+// Read the directory entries, followed by the mount points (in place of any entries of the same name)
+func (d *mountedDir) Readdir(count int) ([]fs.FileInfo, error) {
+	infos, err := d.File.Readdir(count)
+	if d.listed || (count > 0 && err != io.EOF) {
+		return infos, err
+	}
+	d.listed = true
+	infos = slices.DeleteFunc(infos, func(info fs.FileInfo) bool {
+		return slices.ContainsFunc(d.mounted, func(m fs.FileInfo) bool { return m.Name() == info.Name() })
+	})
+	infos = append(infos, d.mounted...)
+	if err == io.EOF {
+		err = nil
+	}
+	return infos, err
+}
+
+// The directory on disk that the URL path is in, and the path within it: the directory mounted
+// at the path's prefix, if any, or else the root directory
+func resolveMount(mounts []mount, root, name string) (dir, rest string) {
+	name = path.Clean("/" + name)
+	for _, m := range mounts {
+		if name == m.prefix || strings.HasPrefix(name, m.prefix+"/") {
+			return m.dir, path.Clean("/" + strings.TrimPrefix(name, m.prefix))
+		}
+	}
+	return root, name
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// File info under another name
+type renamedInfo struct {
+	fs.FileInfo
+	name string
+}
+
+// The name of the file
+func (info renamedInfo) Name() string {
+	return info.name
+}
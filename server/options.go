@@ -0,0 +1,163 @@
+package server
+
+import (
+	"crypto/tls"
+	"io"
+	"io/fs"
+	"log"
+)
+
+// =======
+// OPTIONS
+// =======
+
+// An option to configure the server with (see New)
+type Option func(s *Self)
+
+// Create a new instance of Self with the options, starting from the same defaults as the command-line
+// flags: serving the current directory on localhost:5327
+func New(options ...Option) *Self {
+	s := NewSelf(DEFAULT_HOST, ".", DEFAULT_PORT)
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// Serve the directory (or a single file)
+func WithDir(dir string) Option {
+	return func(s *Self) {
+		s.dir = dir
+		s.singleFile = isSingleFile(dir)
+	}
+}
+
+// Serve the files of the file system (like an embed.FS) in place of the directory
+func WithFS(fsys fs.FS) Option {
+	return func(s *Self) {
+		s.archive = fsys
+	}
+}
+
+// Serve on the host (like 0.0.0.0 to listen on all interfaces)
+func WithHost(host string) Option {
+	return func(s *Self) {
+		s.host = host
+	}
+}
+
+// Serve on the port (0 for any free port, see Addr)
+func WithPort(port int) Option {
+	return func(s *Self) {
+		s.port = port
+	}
+}
+
+// Serve HTTPS with the TLS configuration
+func WithTLS(config *tls.Config) Option {
+	return func(s *Self) {
+		s.tls = config
+	}
+}
+
+// Serve HTTPS with the certificate and private key files
+func WithCertificate(cert, key string) Option {
+	return func(s *Self) {
+		s.cert, s.key = cert, key
+	}
+}
+
+// Log the startup, the requests and the errors to the logger (instead of the standard logger)
+func WithLogger(logger *log.Logger) Option {
+	return func(s *Self) {
+		s.logger = logger
+	}
+}
+
+// Print the address (and the QR code, if enabled) to the writer on the first start, instead of stdout
+// (nil to not print it at all)
+func WithBanner(w io.Writer) Option {
+	return func(s *Self) {
+		if w == nil {
+			w = io.Discard
+		}
+		s.banner = w
+	}
+}
+
+// Do not log the requests (only the startup, the shutdown and errors)
+func WithQuiet(quiet bool) Option {
+	return func(s *Self) {
+		s.quiet = quiet
+	}
+}
+
+// Compress the responses when the client accepts it (enabled by default)
+func WithCompression(enabled bool) Option {
+	return func(s *Self) {
+		s.compress = enabled
+	}
+}
+
+// Generate ETags and respond to conditional requests with 304 Not Modified (enabled by default)
+func WithETags(enabled bool) Option {
+	return func(s *Self) {
+		s.etag = enabled
+	}
+}
+
+// Let browsers cache the responses (enabled by default), or prevent them from caching them at all
+func WithCaching(enabled bool) Option {
+	return func(s *Self) {
+		s.noCache = !enabled
+	}
+}
+
+// List the contents of directories without an index file (enabled by default)
+func WithListing(enabled bool) Option {
+	return func(s *Self) {
+		s.listing = enabled
+	}
+}
+
+// Serve the root index.html for paths that do not match a file, for single-page apps
+func WithSPA(enabled bool) Option {
+	return func(s *Self) {
+		s.spa = enabled
+	}
+}
+
+// Serve about.html at /about, and redirect /about.html to /about
+func WithCleanURLs(enabled bool) Option {
+	return func(s *Self) {
+		s.cleanURLs = enabled
+	}
+}
+
+// Reload the pages in the browser when the files change
+func WithLiveReload(enabled bool) Option {
+	return func(s *Self) {
+		s.liveReload = enabled
+	}
+}
+
+// Require HTTP Basic authentication with the credentials
+func WithBasicAuth(user, password string) Option {
+	return func(s *Self) {
+		s.auth = &credentials{user, password}
+	}
+}
+
+// Require the bearer token (as an Authorization header or a ?token= query parameter)
+func WithToken(token string) Option {
+	return func(s *Self) {
+		s.token = token
+	}
+}
+
+// Add the middleware around the routes of the server (see Use)
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(s *Self) {
+		s.Use(middleware...)
+	}
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestServeRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	mustWrite(t, filepath.Join(dir, "index.html"), "<h1>Hello</h1>")
+	mustWrite(t, filepath.Join(dir, ".env"), "SECRET=1")
+
+	requests := make(chan RequestInfo, 10)
+	listened := make(chan net.Addr, 1)
+	s := New(
+		WithDir(dir),
+		WithHost("127.0.0.1"),
+		WithPort(0),
+		WithLogger(log.New(io.Discard, "", 0)),
+		WithBanner(nil),
+		WithMiddleware(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Middleware", "used")
+				next.ServeHTTP(w, r)
+			})
+		}),
+	)
+	s.OnListen(func(addr net.Addr) { listened <- addr })
+	s.OnRequest(func(info RequestInfo) { requests <- info })
+
+	served := make(chan error, 1)
+	go func() { served <- s.Serve() }()
+	select {
+	case <-s.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server did not become ready")
+	}
+	addr := s.Addr()
+	if addr == nil {
+		t.Fatalf("the server did not listen: %v", <-served)
+	}
+	select {
+	case got := <-listened:
+		if got.String() != addr.String() {
+			t.Errorf("OnListen was called with %v, want %v", got, addr)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("OnListen was not called")
+	}
+	if port := addr.(*net.TCPAddr).Port; port == 0 {
+		t.Errorf("the server listens on port 0, want the port chosen for it")
+	}
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{path: "/", status: http.StatusOK, body: "<h1>Hello</h1>"},
+		{path: "/index.html", status: http.StatusMovedPermanently},
+		{path: "/.env", status: http.StatusNotFound},
+		{path: "/missing.html", status: http.StatusNotFound},
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	for _, tt := range tests {
+		res, err := client.Get("http://" + addr.String() + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != tt.status {
+			t.Errorf("GET %s = %d, want %d", tt.path, res.StatusCode, tt.status)
+		}
+		if tt.body != "" && string(body) != tt.body {
+			t.Errorf("GET %s = %q, want %q", tt.path, body, tt.body)
+		}
+		if res.Header.Get("X-Middleware") != "used" {
+			t.Errorf("GET %s did not go through the middleware", tt.path)
+		}
+		select {
+		case info := <-requests:
+			if info.URL != tt.path || info.Status != tt.status {
+				t.Errorf("OnRequest was called with %s %d, want %s %d", info.URL, info.Status, tt.path, tt.status)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("OnRequest was not called for %s", tt.path)
+		}
+	}
+
+	shutDown := false
+	s.OnShutdown(func() { shutDown = true })
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("Serve returned %v, want %v", err, http.ErrServerClosed)
+	}
+	if !shutDown {
+		t.Errorf("OnShutdown was not called")
+	}
+}
+
+func TestServeShutdownBeforeReady(t *testing.T) {
+	s := New(WithDir(t.TempDir()), WithHost("127.0.0.1"), WithPort(0), WithLogger(log.New(io.Discard, "", 0)), WithBanner(nil))
+	shutDown := false
+	s.OnShutdown(func() { shutDown = true })
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !shutDown {
+		t.Errorf("OnShutdown was not called for the server that never started")
+	}
+	if err := s.Serve(); !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("Serve after Shutdown returned %v, want %v", err, http.ErrServerClosed)
+	}
+	select {
+	case <-s.Ready():
+	default:
+		t.Errorf("Ready was not closed")
+	}
+}
+
+func TestServeListenError(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	var failed error
+	s := New(
+		WithDir(t.TempDir()),
+		WithHost("127.0.0.1"),
+		WithPort(taken.Addr().(*net.TCPAddr).Port),
+		WithLogger(log.New(io.Discard, "", 0)),
+		WithBanner(nil),
+	)
+	s.OnError(func(err error) { failed = err })
+	if err := s.Serve(); err == nil {
+		t.Fatal("Serve on a port that is taken succeeded, want an error")
+	}
+	select {
+	case <-s.Ready():
+	default:
+		t.Fatal("Ready was not closed when the server could not listen")
+	}
+	if addr := s.Addr(); addr != nil {
+		t.Errorf("Addr = %v, want nil when the server could not listen", addr)
+	}
+	if failed == nil {
+		t.Errorf("OnError was not called")
+	}
+}
+
+func TestWithDirSingleFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "page.html")
+	mustWrite(t, name, "page")
+	if s := New(WithDir(name)); !s.singleFile {
+		t.Errorf("WithDir(%s) does not serve the single file", name)
+	}
+	if s := New(WithDir(filepath.Dir(name))); s.singleFile {
+		t.Errorf("WithDir(%s) serves a single file, want the directory", filepath.Dir(name))
+	}
+}
+
+func TestShutdownTwice(t *testing.T) {
+	s := New(WithDir(t.TempDir()), WithHost("127.0.0.1"), WithPort(0), WithLiveReload(true), WithLogger(log.New(io.Discard, "", 0)), WithBanner(nil))
+	shutDowns := 0
+	s.OnShutdown(func() { shutDowns++ })
+
+	served := make(chan error, 1)
+	go func() { served <- s.Serve() }()
+	<-s.Ready()
+	if s.Addr() == nil {
+		t.Fatalf("the server did not listen: %v", <-served)
+	}
+	for range 2 {
+		if err := s.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("Serve returned %v, want %v", err, http.ErrServerClosed)
+	}
+	if shutDowns != 2 {
+		t.Errorf("OnShutdown was called %d times, want once for each Shutdown", shutDowns)
+	}
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Serve in the background until the end of the test, returning the URL of the server
+func startServer(t *testing.T, s *Self) string {
+	t.Helper()
+	served := make(chan error, 1)
+	go func() { served <- s.Serve() }()
+	<-s.Ready()
+	if s.Addr() == nil {
+		t.Fatalf("the server did not listen: %v", <-served)
+	}
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+	return "http://" + s.Addr().String()
+}
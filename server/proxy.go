@@ -0,0 +1,175 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// =============
+// REVERSE PROXY
+// =============
+
+// A route that forwards the requests under a path prefix to a backend
+type proxyRoute struct {
+	prefix           string                 // The path prefix to forward (e.g. `/api`)
+	target           *url.URL               // The backend to forward to (e.g. `http://localhost:3000`)
+	strip            string                 // The path prefix to strip before forwarding (e.g. `/api`)
+	addPrefix        string                 // The path prefix to add before forwarding (e.g. `/v1`)
+	host             string                 // The Host header to send (defaults to the backend's host)
+	setHeaders       http.Header            // The request headers to set
+	removeHeaders    []string               // The request headers to remove
+	setResHeaders    http.Header            // The response headers to set
+	removeResHeaders []string               // The response headers to remove
+	proxy            *httputil.ReverseProxy // The reverse proxy to the backend
+}
+
+// Parse a --proxy value (in the form `/prefix=http://backend`, followed by any `;option=value`s)
+// into a proxy route. The options are:
+//   - `strip=/prefix` to strip a path prefix before forwarding
+//   - `prefix=/prefix` to add a path prefix before forwarding
+//   - `host=name` to set the Host header
+//   - `set-header=Name:value` and `remove-header=Name` to change the request headers
+//   - `set-response-header=Name:value` and `remove-response-header=Name` to change the response headers
+func parseProxyRoute(value string) (proxyRoute, error) {
+	options := strings.Split(value, ";")
+	prefix, target, ok := strings.Cut(options[0], "=")
+	prefix, target = strings.TrimSpace(prefix), strings.TrimSpace(target)
+	if !ok || !strings.HasPrefix(prefix, "/") {
+		return proxyRoute{}, fmt.Errorf("invalid proxy %q (expected /prefix=url, e.g. /api=http://localhost:3000)", value)
+	}
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return proxyRoute{}, fmt.Errorf("invalid proxy target %q (expected an http or https URL)", target)
+	}
+
+	route := &proxyRoute{prefix: strings.TrimSuffix(prefix, "/"), target: u, setHeaders: http.Header{}, setResHeaders: http.Header{}}
+	for _, option := range options[1:] {
+		key, val, _ := strings.Cut(strings.TrimSpace(option), "=")
+		if err := route.setOption(strings.TrimSpace(key), strings.TrimSpace(val)); err != nil {
+			return proxyRoute{}, fmt.Errorf("invalid proxy option %q: %w", option, err)
+		}
+	}
+
+	route.proxy = &httputil.ReverseProxy{
+		Rewrite:        route.rewrite,
+		ModifyResponse: route.modifyResponse,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if upgrade := r.Header.Get("Upgrade"); upgrade != "" {
+				requestLogger(r).Printf("Could not proxy the %s upgrade: %v\n", upgrade, err)
+			} else {
+				requestLogger(r).Println("Could not proxy the request:", err)
+			}
+			http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		},
+	}
+	return *route, nil
+}
+
+// Apply the `key=value` option to the route
+func (route *proxyRoute) setOption(key, value string) error {
+	switch key {
+	case "strip":
+		route.strip = strings.TrimSuffix(value, "/")
+	case "prefix":
+		route.addPrefix = "/" + strings.Trim(value, "/")
+	case "host":
+		route.host = value
+	case "set-header", "set-response-header":
+		name, val, ok := strings.Cut(value, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("expected Name:value")
+		}
+		headers := route.setHeaders
+		if key == "set-response-header" {
+			headers = route.setResHeaders
+		}
+		headers.Set(strings.TrimSpace(name), strings.TrimSpace(val))
+	case "remove-header":
+		route.removeHeaders = append(route.removeHeaders, value)
+	case "remove-response-header":
+		route.removeResHeaders = append(route.removeResHeaders, value)
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	return nil
+}
+
+// Rewrite the request to the backend, applying the route's path and header options
+func (route *proxyRoute) rewrite(pr *httputil.ProxyRequest) {
+	if route.strip != "" || route.addPrefix != "" {
+		urlPath := pr.Out.URL.Path
+		if rest, ok := strings.CutPrefix(urlPath, route.strip); ok && (rest == "" || strings.HasPrefix(rest, "/")) {
+			urlPath = rest
+		}
+		pr.Out.URL.Path = route.addPrefix + urlPath
+		pr.Out.URL.RawPath = ""
+		if pr.Out.URL.Path == "" {
+			pr.Out.URL.Path = "/"
+		}
+	}
+	pr.SetURL(route.target)
+	pr.SetXForwarded()
+	if route.host != "" {
+		pr.Out.Host = route.host
+	}
+	for _, name := range route.removeHeaders {
+		pr.Out.Header.Del(name)
+	}
+	for name, values := range route.setHeaders {
+		pr.Out.Header[name] = values
+	}
+}
+
+// Apply the route's response header options to the backend's response
+func (route *proxyRoute) modifyResponse(res *http.Response) error {
+	for _, name := range route.removeResHeaders {
+		res.Header.Del(name)
+	}
+	for name, values := range route.setResHeaders {
+		res.Header[name] = values
+	}
+	return nil
+}
+
+// Parse the --proxy values into proxy routes, ordered from the longest prefix to the shortest
+func parseProxyRoutes(values []string) ([]proxyRoute, error) {
+	routes := make([]proxyRoute, 0, len(values))
+	for _, value := range values {
+		route, err := parseProxyRoute(value)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].prefix) > len(routes[j].prefix)
+	})
+	return routes, nil
+}
+
+// Boolean indicating whether the path is under the route's prefix
+func (route proxyRoute) matches(urlPath string) bool {
+	rest, ok := strings.CutPrefix(urlPath, route.prefix)
+	return ok && (rest == "" || strings.HasPrefix(rest, "/"))
+}
+
+// Middleware that forwards the requests under the routes' prefixes to their backends
+// (the path is forwarded as is, e.g. `/api/users` to `http://localhost:3000/api/users`).
+// Upgrade requests (like WebSockets) are tunneled to the backend once it switches protocols,
+// which relies on the ResponseWriter (or one it unwraps to) being an http.Hijacker.
+// All other requests are served by the next handler.
+func proxies(routes []proxyRoute, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, route := range routes {
+			if route.matches(r.URL.Path) {
+				route.proxy.ServeHTTP(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
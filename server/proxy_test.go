@@ -0,0 +1,103 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestParseProxyRoute(t *testing.T) {
+	tests := []struct {
+		value         string
+		prefix        string
+		target        string
+		strip         string
+		addPrefix     string
+		host          string
+		setHeaders    http.Header
+		removeHeaders []string
+		err           bool
+	}{
+		{value: "/api=http://localhost:3000", prefix: "/api", target: "http://localhost:3000"},
+		{value: " /api/ = https://example.com/base ", prefix: "/api", target: "https://example.com/base"},
+		{value: "/api=http://localhost:3000;strip=/api/", prefix: "/api", target: "http://localhost:3000", strip: "/api"},
+		{value: "/api=http://localhost:3000;prefix=v1/", prefix: "/api", target: "http://localhost:3000", addPrefix: "/v1"},
+		{value: "/api=http://localhost:3000;host=api.example.com", prefix: "/api", target: "http://localhost:3000", host: "api.example.com"},
+		{
+			value:         "/api=http://localhost:3000; set-header=X-Api-Key: secret ;remove-header=Cookie",
+			prefix:        "/api",
+			target:        "http://localhost:3000",
+			setHeaders:    http.Header{"X-Api-Key": {"secret"}},
+			removeHeaders: []string{"Cookie"},
+		},
+		{value: "api=http://localhost:3000", err: true},
+		{value: "/api", err: true},
+		{value: "/api=localhost:3000", err: true},
+		{value: "/api=ftp://localhost", err: true},
+		{value: "/api=http://", err: true},
+		{value: "/api=http://localhost:3000;set-header=X-Api-Key", err: true},
+		{value: "/api=http://localhost:3000;unknown=1", err: true},
+	}
+	for _, tt := range tests {
+		route, err := parseProxyRoute(tt.value)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseProxyRoute(%q) succeeded, want an error", tt.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseProxyRoute(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if route.prefix != tt.prefix || route.target.String() != tt.target {
+			t.Errorf("parseProxyRoute(%q) = %s => %s, want %s => %s", tt.value, route.prefix, route.target, tt.prefix, tt.target)
+		}
+		if route.strip != tt.strip || route.addPrefix != tt.addPrefix || route.host != tt.host {
+			t.Errorf("parseProxyRoute(%q) strips %q, adds %q and sets the host %q, want %q, %q and %q",
+				tt.value, route.strip, route.addPrefix, route.host, tt.strip, tt.addPrefix, tt.host)
+		}
+		for name := range tt.setHeaders {
+			if got, want := route.setHeaders.Get(name), tt.setHeaders.Get(name); got != want {
+				t.Errorf("parseProxyRoute(%q) sets %s to %q, want %q", tt.value, name, got, want)
+			}
+		}
+		if !slices.Equal(route.removeHeaders, tt.removeHeaders) {
+			t.Errorf("parseProxyRoute(%q) removes %v, want %v", tt.value, route.removeHeaders, tt.removeHeaders)
+		}
+	}
+}
+
+func TestParseProxyRoutesOrder(t *testing.T) {
+	routes, err := parseProxyRoutes([]string{"/=http://localhost:1", "/api/v1=http://localhost:3", "/api=http://localhost:2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prefixes []string
+	for _, route := range routes {
+		prefixes = append(prefixes, route.prefix)
+	}
+	if want := []string{"/api/v1", "/api", ""}; !slices.Equal(prefixes, want) {
+		t.Errorf("parseProxyRoutes ordered the prefixes %q, want %q", prefixes, want)
+	}
+}
+
+func TestProxyRouteMatches(t *testing.T) {
+	route := proxyRoute{prefix: "/api"}
+	tests := []struct {
+		path    string
+		matches bool
+	}{
+		{path: "/api", matches: true},
+		{path: "/api/", matches: true},
+		{path: "/api/users", matches: true},
+		{path: "/apis", matches: false},
+		{path: "/", matches: false},
+		{path: "/other/api", matches: false},
+	}
+	for _, tt := range tests {
+		if got := route.matches(tt.path); got != tt.matches {
+			t.Errorf("matches(%q) = %v, want %v", tt.path, got, tt.matches)
+		}
+	}
+}
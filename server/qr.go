@@ -0,0 +1,446 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ========
+// QR CODES
+// ========
+
+// A QR code symbol of byte mode data, with the low error correction level (which keeps the
+// symbol small enough for a terminal). Versions 1 to 10 are supported (up to 271 bytes),
+// which is plenty for URLs.
+type qrCode struct {
+	size     int      // The number of modules on each side
+	modules  [][]bool // The dark modules, by row and column
+	function [][]bool // The modules of the function patterns (which are not masked)
+}
+
+// The error correction codewords per block, and the number of blocks and their data codewords
+// (in up to two groups), of each version at the low error correction level
+var qrBlocks = [...]struct{ ec, blocks1, data1, blocks2, data2 int }{
+	1:  {7, 1, 19, 0, 0},
+	2:  {10, 1, 34, 0, 0},
+	3:  {15, 1, 55, 0, 0},
+	4:  {20, 1, 80, 0, 0},
+	5:  {26, 1, 108, 0, 0},
+	6:  {18, 2, 68, 0, 0},
+	7:  {20, 2, 78, 0, 0},
+	8:  {24, 2, 97, 0, 0},
+	9:  {30, 2, 116, 0, 0},
+	10: {18, 2, 68, 2, 69},
+}
+
+// The centers of the alignment patterns of each version
+var qrAlignments = [...][]int{
+	2:  {6, 18},
+	3:  {6, 22},
+	4:  {6, 26},
+	5:  {6, 30},
+	6:  {6, 34},
+	7:  {6, 22, 38},
+	8:  {6, 24, 42},
+	9:  {6, 26, 46},
+	10: {6, 28, 50},
+}
+
+// Encode the text as a QR code, in the smallest version that fits it
+func encodeQR(text string) (*qrCode, error) {
+	data := []byte(text)
+	version := 1
+	for ; version < len(qrBlocks); version++ {
+		b := qrBlocks[version]
+		lengthBits := 8
+		if version >= 10 {
+			lengthBits = 16
+		}
+		if 4+lengthBits+8*len(data) <= 8*(b.blocks1*b.data1+b.blocks2*b.data2) {
+			break
+		}
+	}
+	if version == len(qrBlocks) {
+		return nil, fmt.Errorf("%d bytes is too long for a QR code", len(data))
+	}
+
+	qr := &qrCode{size: 17 + 4*version}
+	qr.modules, qr.function = make([][]bool, qr.size), make([][]bool, qr.size)
+	for y := range qr.size {
+		qr.modules[y], qr.function[y] = make([]bool, qr.size), make([]bool, qr.size)
+	}
+	qr.drawFunctionPatterns(version)
+	qr.drawCodewords(qrCodewords(data, version))
+
+	// Apply the mask with the lowest penalty
+	best, lowest := 0, -1
+	for mask := range 8 {
+		qr.applyMask(mask)
+		qr.drawFormat(mask)
+		if penalty := qr.penalty(); lowest < 0 || penalty < lowest {
+			best, lowest = mask, penalty
+		}
+		qr.applyMask(mask) // Undo it (as masks are XORs)
+	}
+	qr.applyMask(best)
+	qr.drawFormat(best)
+	return qr, nil
+}
+
+// Render the QR code with half blocks (two rows of modules per line) in black on white,
+// so that it scans regardless of the terminal's colors (or in the terminal's own colors, if disabled)
+func (qr *qrCode) String() string {
+	const quiet = 4 // The width of the light border around the symbol, in modules
+	dark := func(x, y int) bool {
+		x, y = x-quiet, y-quiet
+		return x >= 0 && y >= 0 && x < qr.size && y < qr.size && qr.modules[y][x]
+	}
+	var sb strings.Builder
+	for y := 0; y < qr.size+2*quiet; y += 2 {
+		var line strings.Builder
+		for x := range qr.size + 2*quiet {
+			switch top, bottom := dark(x, y), dark(x, y+1); {
+			case top && bottom:
+				line.WriteString("█")
+			case top:
+				line.WriteString("▀")
+			case bottom:
+				line.WriteString("▄")
+			default:
+				line.WriteString(" ")
+			}
+		}
+		sb.WriteString(colorize(stdoutColor, colorQR, line.String()) + "\n")
+	}
+	return sb.String()
+}
+
+// ----------------
+// SYMBOL STRUCTURE
+// ----------------
+
+// Draw the finder, timing and alignment patterns, and reserve the format and version areas
+func (qr *qrCode) drawFunctionPatterns(version int) {
+	for i := range qr.size {
+		qr.set(6, i, i%2 == 0)
+		qr.set(i, 6, i%2 == 0)
+	}
+
+	// The finder patterns (with their separators) in three corners
+	for _, center := range [][2]int{{3, 3}, {qr.size - 4, 3}, {3, qr.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := center[0]+dx, center[1]+dy
+				if x >= 0 && y >= 0 && x < qr.size && y < qr.size {
+					distance := max(abs(dx), abs(dy))
+					qr.set(x, y, distance != 2 && distance != 4)
+				}
+			}
+		}
+	}
+
+	// The alignment patterns, except where they would overlap the finder patterns
+	centers := qrAlignments[version]
+	last := len(centers) - 1
+	for i, x := range centers {
+		for j, y := range centers {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					qr.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	qr.drawFormat(0) // Reserve the format areas (they are drawn for real once the mask is chosen)
+
+	// The version information (in versions 7 and up)
+	if version >= 7 {
+		remainder := version
+		for range 12 {
+			remainder = remainder<<1 ^ (remainder>>11)*0x1f25
+		}
+		bits := version<<12 | remainder
+		for i := range 18 {
+			bit := bits>>i&1 != 0
+			a, b := qr.size-11+i%3, i/3
+			qr.set(a, b, bit)
+			qr.set(b, a, bit)
+		}
+	}
+}
+
+// Draw the two copies of the format information for the mask (and the low error correction level)
+func (qr *qrCode) drawFormat(mask int) {
+	data := 1<<3 | mask // The low error correction level is 01
+	remainder := data
+	for range 10 {
+		remainder = remainder<<1 ^ (remainder>>9)*0x537
+	}
+	bits := (data<<10 | remainder) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 != 0 }
+
+	for i := range 6 {
+		qr.set(8, i, bit(i))
+	}
+	qr.set(8, 7, bit(6))
+	qr.set(8, 8, bit(7))
+	qr.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		qr.set(14-i, 8, bit(i))
+	}
+	for i := range 8 {
+		qr.set(qr.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		qr.set(8, qr.size-15+i, bit(i))
+	}
+	qr.set(8, qr.size-8, true) // The dark module
+}
+
+// Draw the codewords in the zigzag order, going up and down two columns at a time from the right
+func (qr *qrCode) drawCodewords(codewords []byte) {
+	i := 0
+	for right := qr.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // Skip the vertical timing pattern
+		}
+		for vertical := range qr.size {
+			for j := range 2 {
+				x, y := right-j, vertical
+				if (right+1)&2 == 0 {
+					y = qr.size - 1 - vertical // Going up
+				}
+				if !qr.function[y][x] && i < len(codewords)*8 {
+					qr.modules[y][x] = codewords[i>>3]>>(7-i&7)&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+// Flip the data modules of the mask pattern
+func (qr *qrCode) applyMask(mask int) {
+	for y := range qr.size {
+		for x := range qr.size {
+			var flip bool
+			switch mask {
+			case 0:
+				flip = (x+y)%2 == 0
+			case 1:
+				flip = y%2 == 0
+			case 2:
+				flip = x%3 == 0
+			case 3:
+				flip = (x+y)%3 == 0
+			case 4:
+				flip = (x/3+y/2)%2 == 0
+			case 5:
+				flip = x*y%2+x*y%3 == 0
+			case 6:
+				flip = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				flip = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if flip && !qr.function[y][x] {
+				qr.modules[y][x] = !qr.modules[y][x]
+			}
+		}
+	}
+}
+
+// The penalty score of the symbol, which the best mask minimizes: for runs of five or more modules
+// of the same color, 2x2 blocks of the same color, patterns that look like the finder patterns,
+// and an imbalance of dark and light modules
+func (qr *qrCode) penalty() int {
+	penalty, dark := 0, 0
+	finderLike := []bool{true, false, true, true, true, false, true}
+	for a := range qr.size {
+		for _, horizontal := range []bool{true, false} {
+			at := func(b int) bool {
+				if horizontal {
+					return qr.modules[a][b]
+				}
+				return qr.modules[b][a]
+			}
+			run := 0
+			for b := range qr.size {
+				if b > 0 && at(b) == at(b-1) {
+					run++
+				} else {
+					run = 1
+				}
+				if run == 5 {
+					penalty += 3
+				} else if run > 5 {
+					penalty++
+				}
+
+				// A finder-like pattern, with four light modules on either side
+				if b+7 <= qr.size {
+					matches := true
+					for k, want := range finderLike {
+						matches = matches && at(b+k) == want
+					}
+					lightBefore, lightAfter := b >= 4, b+11 <= qr.size
+					for k := 1; k <= 4; k++ {
+						lightBefore = lightBefore && !at(b-k)
+						lightAfter = lightAfter && !at(b+6+k)
+					}
+					if matches && (lightBefore || lightAfter) {
+						penalty += 40
+					}
+				}
+			}
+		}
+		for b := range qr.size {
+			if qr.modules[a][b] {
+				dark++
+			}
+			if a+1 < qr.size && b+1 < qr.size {
+				color := qr.modules[a][b]
+				if qr.modules[a][b+1] == color && qr.modules[a+1][b] == color && qr.modules[a+1][b+1] == color {
+					penalty += 3
+				}
+			}
+		}
+	}
+	total := qr.size * qr.size
+	return penalty + abs(dark*20-total*10)/total*10
+}
+
+// Set the module of a function pattern
+func (qr *qrCode) set(x, y int, dark bool) {
+	qr.modules[y][x] = dark
+	qr.function[y][x] = true
+}
+
+// -------------------------
+// DATA AND ERROR CORRECTION
+// -------------------------
+
+// The codewords of the data in byte mode, split into blocks with their error correction
+// codewords, and interleaved
+func qrCodewords(data []byte, version int) []byte {
+	b := qrBlocks[version]
+	capacity := b.blocks1*b.data1 + b.blocks2*b.data2
+
+	// The mode indicator, the length, the data and the terminator, padded to the capacity
+	var bits qrBits
+	bits.append(0b0100, 4)
+	if version >= 10 {
+		bits.append(len(data), 16)
+	} else {
+		bits.append(len(data), 8)
+	}
+	for _, c := range data {
+		bits.append(int(c), 8)
+	}
+	bits.append(0, min(4, capacity*8-bits.length))
+	bits.append(0, (8-bits.length%8)%8)
+	codewords := bits.bytes
+	for pad := 0; len(codewords) < capacity; pad++ {
+		codewords = append(codewords, [2]byte{0xec, 0x11}[pad%2])
+	}
+
+	// Split the data into blocks, and compute their error correction codewords
+	var blocks, ecBlocks [][]byte
+	divisor := reedSolomonDivisor(b.ec)
+	for i := range b.blocks1 + b.blocks2 {
+		size := b.data1
+		if i >= b.blocks1 {
+			size = b.data2
+		}
+		blocks = append(blocks, codewords[:size])
+		ecBlocks = append(ecBlocks, reedSolomonRemainder(codewords[:size], divisor))
+		codewords = codewords[size:]
+	}
+
+	// Interleave the blocks' codewords, and then their error correction codewords
+	var result []byte
+	for i := range max(b.data1, b.data2) {
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := range b.ec {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+// A sequence of bits, packed into bytes
+type qrBits struct {
+	bytes  []byte
+	length int
+}
+
+// Append the lowest n bits of the value, most significant first
+func (b *qrBits) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if b.length%8 == 0 {
+			b.bytes = append(b.bytes, 0)
+		}
+		if value>>i&1 != 0 {
+			b.bytes[len(b.bytes)-1] |= 1 << (7 - b.length%8)
+		}
+		b.length++
+	}
+}
+
+// The generator polynomial of the degree (without its leading term), for Reed-Solomon error correction
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for range degree {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// The remainder of the data's polynomial divided by the generator polynomial (its error correction codewords)
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, c := range data {
+		factor := c ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= gfMultiply(d, factor)
+		}
+	}
+	return result
+}
+
+// Multiply in the Galois field GF(2^8), modulo the QR code's primitive polynomial
+func gfMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11d
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+// The absolute value of the integer
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
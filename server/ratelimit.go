@@ -0,0 +1,114 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// =============
+// RATE LIMITING
+// =============
+
+// How long a client's limiter is kept after its last request, when limiting per IP
+const rateLimiterIdleTimeout = 3 * time.Minute
+
+// Parse a --rate value (like `100/s`, `30/m` or `1000/h`, or a plain number per second) into
+// the rate limit and its default burst size (the number of requests, e.g. 100 for `100/s`)
+func parseRate(value string) (rate.Limit, int, error) {
+	count, unit, _ := strings.Cut(strings.TrimSpace(value), "/")
+	n, err := strconv.ParseFloat(count, 64)
+	if err != nil || n <= 0 {
+		return 0, 0, fmt.Errorf("invalid rate %q (expected requests per unit, like 100/s or 30/m)", value)
+	}
+	per := time.Second
+	switch unit {
+	case "", "s":
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return 0, 0, fmt.Errorf("invalid rate %q (the unit must be s, m or h)", value)
+	}
+	return rate.Limit(n / per.Seconds()), max(1, int(math.Ceil(n))), nil
+}
+
+// A token bucket rate limiter, either shared by all clients or kept per client IP address
+type rateLimiter struct {
+	limit     rate.Limit               // The sustained rate of requests
+	burst     int                      // The number of requests that can be made at once
+	perIP     bool                     // Whether each client IP address has its own bucket
+	shared    *rate.Limiter            // The bucket shared by all clients (if not per IP)
+	mu        sync.Mutex               // Guards the clients
+	clients   map[string]*clientBucket // The buckets of the clients by IP address (if per IP)
+	lastSweep time.Time                // When idle clients were last removed
+}
+
+// The bucket of a client, when limiting per IP
+type clientBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Create a rate limiter allowing the rate of requests with the burst size
+func newRateLimiter(limit rate.Limit, burst int, perIP bool) *rateLimiter {
+	rl := &rateLimiter{limit: limit, burst: burst, perIP: perIP}
+	if perIP {
+		rl.clients = map[string]*clientBucket{}
+	} else {
+		rl.shared = rate.NewLimiter(limit, burst)
+	}
+	return rl
+}
+
+// The bucket for the request's client
+func (rl *rateLimiter) limiterFor(r *http.Request) *rate.Limiter {
+	if !rl.perIP {
+		return rl.shared
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	now := time.Now()
+	if now.Sub(rl.lastSweep) > time.Minute {
+		for ip, client := range rl.clients {
+			if now.Sub(client.lastSeen) > rateLimiterIdleTimeout {
+				delete(rl.clients, ip)
+			}
+		}
+		rl.lastSweep = now
+	}
+	client, ok := rl.clients[host]
+	if !ok {
+		client = &clientBucket{limiter: rate.NewLimiter(rl.limit, rl.burst)}
+		rl.clients[host] = client
+	}
+	client.lastSeen = now
+	return client.limiter
+}
+
+// Middleware that responds with a 429 (and a Retry-After header) to requests beyond the rate limit
+func rateLimit(rl *rateLimiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reservation := rl.limiterFor(r).Reserve()
+		if delay := reservation.Delay(); delay > 0 {
+			reservation.Cancel() // The request is refused, so it does not use up a token
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
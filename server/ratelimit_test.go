@@ -0,0 +1,46 @@
+package server
+
+import (
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		value string
+		limit rate.Limit
+		burst int
+		err   bool
+	}{
+		{value: "100/s", limit: 100, burst: 100},
+		{value: "100", limit: 100, burst: 100},
+		{value: " 10/s ", limit: 10, burst: 10},
+		{value: "30/m", limit: 0.5, burst: 30},
+		{value: "3600/h", limit: 1, burst: 3600},
+		{value: "0.5/s", limit: 0.5, burst: 1},
+		{value: "2.5", limit: 2.5, burst: 3},
+		{value: "", err: true},
+		{value: "abc", err: true},
+		{value: "0/s", err: true},
+		{value: "-5/s", err: true},
+		{value: "10/d", err: true},
+		{value: "/s", err: true},
+	}
+	for _, tt := range tests {
+		limit, burst, err := parseRate(tt.value)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseRate(%q) = %v, %d, want an error", tt.value, limit, burst)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseRate(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if limit != tt.limit || burst != tt.burst {
+			t.Errorf("parseRate(%q) = %v, %d, want %v, %d", tt.value, limit, burst, tt.limit, tt.burst)
+		}
+	}
+}
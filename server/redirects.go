@@ -0,0 +1,205 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// =========
+// REDIRECTS
+// =========
+
+// The name of the Netlify-style redirects file in the served directory
+const redirectsFileName = "_redirects"
+
+// A redirect (or rewrite) rule from the _redirects file
+type redirectRule struct {
+	from   *regexp.Regexp // The path pattern to match
+	to     string         // The destination (with :placeholders and :splat)
+	status int            // The status code (200 for rewrites)
+	force  bool           // Whether to apply the rule even if a file exists at the path
+}
+
+// Load the redirect rules from the Netlify-style `_redirects` file at the root of the file system.
+// Returns no rules if the file does not exist.
+//
+//	# from        to              [status][!]
+//	/old-path     /new-path       301
+//	/blog/*       /posts/:splat
+//	/api/*        https://api.example.com/:splat  200
+//	/app/*        /app/index.html 200
+func loadRedirectsFile(fsys http.FileSystem) ([]redirectRule, error) {
+	file, err := fsys.Open("/" + redirectsFileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules []redirectRule
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: invalid rule %q (expected: from to [status])", redirectsFileName, lineNumber, line)
+		}
+
+		status := ""
+		if len(fields) > 2 {
+			status = fields[2]
+		}
+		rule, err := newRedirectRule(fields[0], fields[1], status)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", redirectsFileName, lineNumber, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// Create a redirect rule from the path pattern to the destination, with the status (like `301`, or `200!`
+// to force it), which defaults to 301
+func newRedirectRule(from, to, status string) (redirectRule, error) {
+	rule := redirectRule{from: compilePathPattern(from), to: to, status: http.StatusMovedPermanently}
+	if status != "" {
+		code, force := strings.CutSuffix(status, "!")
+		s, err := strconv.Atoi(code)
+		if err != nil {
+			return redirectRule{}, fmt.Errorf("invalid status %q", status)
+		}
+		rule.status, rule.force = s, force
+	}
+	return rule, nil
+}
+
+// Middleware that applies the redirect rules before falling through to the next handler.
+// Rules are not applied when a file exists at the requested path, unless they are forced.
+func redirects(rules []redirectRule, fsys http.FileSystem, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exists := -1 // Lazily checked: whether a file exists at the path
+		for _, rule := range rules {
+			match := rule.from.FindStringSubmatch(r.URL.Path)
+			if match == nil {
+				continue
+			}
+			if !rule.force {
+				if exists < 0 {
+					exists = 0
+					if _, err := stat(fsys, r.URL.Path); err == nil {
+						exists = 1
+					}
+				}
+				if exists == 1 {
+					continue // Shadowed by an existing file
+				}
+			}
+
+			to := expandDestination(rule, match)
+			logDetail(r, "Applying the _redirects rule %s %s %d", rule.from, to, rule.status)
+			rule.apply(w, r, to, next)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Apply the rule to the request, redirecting, rewriting or proxying it to the destination
+func (rule redirectRule) apply(w http.ResponseWriter, r *http.Request, to string, next http.Handler) {
+	dest, err := url.Parse(to)
+	if err != nil {
+		http.Error(w, "Invalid redirect destination", http.StatusInternalServerError)
+		return
+	}
+	if dest.RawQuery == "" {
+		dest.RawQuery = r.URL.RawQuery // Preserve the query string
+	}
+
+	switch {
+	// Redirect
+	case rule.status >= 300 && rule.status < 400:
+		http.Redirect(w, r, dest.String(), rule.status)
+
+	// Proxy to an external destination
+	case dest.IsAbs():
+		proxy := &httputil.ReverseProxy{Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL = dest
+			pr.Out.Host = dest.Host
+			pr.SetXForwarded()
+		}}
+		proxy.ServeHTTP(&statusWriter{ResponseWriter: w, status: rule.status}, r)
+
+	// Rewrite to a local path, with the rule's status (e.g. 200 or 404)
+	default:
+		rewritten := r.Clone(r.Context())
+		rewritten.URL.Path, rewritten.URL.RawQuery = dest.Path, dest.RawQuery
+		rewritten.RequestURI = rewritten.URL.RequestURI()
+		next.ServeHTTP(&statusWriter{ResponseWriter: w, status: rule.status}, rewritten)
+	}
+}
+
+// Substitute the placeholders and splat captured from the path into the rule's destination
+func expandDestination(rule redirectRule, match []string) string {
+	// Substitute longer names first, so that `:id` does not clobber `:identifier`
+	names := rule.from.SubexpNames()
+	order := make([]int, len(names))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return len(names[order[a]]) > len(names[order[b]]) })
+
+	to := rule.to
+	for _, i := range order {
+		if names[i] != "" {
+			to = strings.ReplaceAll(to, ":"+names[i], match[i])
+		}
+	}
+	return to
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// A ResponseWriter that replaces a successful status code with its own
+type statusWriter struct {
+	http.ResponseWriter
+	status      int  // The status code to respond with instead of 200
+	wroteHeader bool // Whether the header has been written
+}
+
+// Write the header, replacing 200 OK with the status
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.wroteHeader {
+		return
+	}
+	sw.wroteHeader = true
+	if status == http.StatusOK && sw.status != 0 {
+		status = sw.status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+// Write the body (writing the header first, if needed)
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	sw.WriteHeader(http.StatusOK)
+	return sw.ResponseWriter.Write(b)
+}
+
+// Unwrap the underlying ResponseWriter (for http.ResponseController)
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadRedirectsFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		rules []redirectRule // Only the patterns' expressions, destinations, statuses and forces are compared
+		err   bool
+	}{
+		{
+			name: "rules",
+			file: "# from  to  [status]\n\n/old /new\n/blog/* /posts/:splat 302 # moved\n/app/* /app/index.html 200!\n",
+			rules: []redirectRule{
+				{from: compilePathPattern("/old"), to: "/new", status: http.StatusMovedPermanently},
+				{from: compilePathPattern("/blog/*"), to: "/posts/:splat", status: http.StatusFound},
+				{from: compilePathPattern("/app/*"), to: "/app/index.html", status: http.StatusOK, force: true},
+			},
+		},
+		{name: "missing destination", file: "/old\n", err: true},
+		{name: "invalid status", file: "/old /new moved\n", err: true},
+	}
+	for _, tt := range tests {
+		fsys := http.FS(fstest.MapFS{redirectsFileName: {Data: []byte(tt.file)}})
+		rules, err := loadRedirectsFile(fsys)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: loadRedirectsFile succeeded, want an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: loadRedirectsFile failed: %v", tt.name, err)
+			continue
+		}
+		if len(rules) != len(tt.rules) {
+			t.Errorf("%s: loadRedirectsFile loaded %d rules, want %d", tt.name, len(rules), len(tt.rules))
+			continue
+		}
+		for i, rule := range rules {
+			want := tt.rules[i]
+			if rule.from.String() != want.from.String() || rule.to != want.to || rule.status != want.status || rule.force != want.force {
+				t.Errorf("%s: rule %d = %s %s %d (forced: %v), want %s %s %d (forced: %v)", tt.name, i,
+					rule.from, rule.to, rule.status, rule.force, want.from, want.to, want.status, want.force)
+			}
+		}
+	}
+
+	if rules, err := loadRedirectsFile(http.FS(fstest.MapFS{})); rules != nil || err != nil {
+		t.Errorf("loadRedirectsFile without a file = %v, %v, want no rules", rules, err)
+	}
+}
+
+func TestRedirects(t *testing.T) {
+	fsys := http.FS(fstest.MapFS{
+		"page.html":       {Data: []byte("page")},
+		"exists.html":     {Data: []byte("exists")},
+		"app/shell.html":  {Data: []byte("app")},
+		"forced.html":     {Data: []byte("shadowed")},
+		"posts/hello.txt": {Data: []byte("hello")},
+	})
+	var rules []redirectRule
+	for _, rule := range [][3]string{
+		{"/old", "/new", ""},
+		{"/exists.html", "/new", ""},
+		{"/forced.html", "/page.html", "200!"},
+		{"/blog/:year/:slug", "/posts/:slug?year=:year", "302"},
+		{"/app/*", "/app/shell.html", "200"},
+		{"/gone/*", "/page.html", "410"},
+	} {
+		r, err := newRedirectRule(rule[0], rule[1], rule[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, r)
+	}
+	handler := redirects(rules, fsys, http.FileServer(fsys))
+
+	tests := []struct {
+		path     string
+		status   int
+		location string
+		body     string
+	}{
+		{path: "/old?page=2", status: http.StatusMovedPermanently, location: "/new?page=2"},
+		{path: "/exists.html", status: http.StatusOK, body: "exists"},
+		{path: "/forced.html", status: http.StatusOK, body: "page"},
+		{path: "/blog/2024/hello", status: http.StatusFound, location: "/posts/hello?year=2024"},
+		{path: "/app/settings/profile", status: http.StatusOK, body: "app"},
+		{path: "/gone/page", status: http.StatusGone, body: "page"},
+		{path: "/posts/hello.txt", status: http.StatusOK, body: "hello"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		body, _ := io.ReadAll(rec.Body)
+		if rec.Code != tt.status {
+			t.Errorf("GET %s = %d, want %d", tt.path, rec.Code, tt.status)
+		}
+		if location := rec.Header().Get("Location"); location != tt.location {
+			t.Errorf("GET %s redirected to %q, want %q", tt.path, location, tt.location)
+		}
+		if tt.body != "" && string(body) != tt.body {
+			t.Errorf("GET %s = %q, want %q", tt.path, body, tt.body)
+		}
+	}
+}
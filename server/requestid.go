@@ -0,0 +1,57 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// ===========
+// REQUEST IDS
+// ===========
+
+// The header that carries the ID of a request, which is echoed back in the response
+const requestIDHeader = "X-Request-Id"
+
+// The longest incoming request ID that is kept (longer ones are replaced with a new ID)
+const maxRequestIDLength = 128
+
+// Middleware that gives every request a unique ID (or keeps the one it came with, like from a
+// reverse proxy), in the X-Request-Id header of both the request (passed on to the proxies, CGI
+// scripts and logs) and the response (to correlate the browser's traces with the server logs)
+func requestIDs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !isValidRequestID(id) {
+			id = newRequestID()
+			r.Header.Set(requestIDHeader, id)
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Generate a random request ID (of 16 hex digits)
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Boolean indicating whether the incoming request ID can be kept: not empty, not too long,
+// and only made of printable ASCII characters (so that it cannot mess up the logs)
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range []byte(id) {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// =======
+// ROUTING
+// =======
+
+// Middleware for single-page apps that serves the root index.html for any path
+// that does not match an existing file. Missing paths with an extension (assets)
+// still get a real 404.
+func spa(fsys http.FileSystem, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method == http.MethodGet || r.Method == http.MethodHead) && path.Ext(r.URL.Path) == "" {
+			if _, err := stat(fsys, r.URL.Path); err != nil {
+				// Rewrite to the root, as the file server redirects /index.html to /
+				logDetail(r, "Serving the single-page app's / for %s, which does not exist", r.URL.Path)
+				r = rewritePath(r, "/")
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Middleware for clean (extensionless) URLs, where `/about` serves `about.html`
+// and requests for `/about.html` are redirected to `/about`
+func cleanURLs(fsys http.FileSystem, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Redirect to the clean URL (index.html is already redirected by the file server)
+		if clean, ok := strings.CutSuffix(r.URL.Path, ".html"); ok && path.Base(r.URL.Path) != "index.html" {
+			if _, err := stat(fsys, r.URL.Path); err == nil {
+				target := clean
+				if r.URL.RawQuery != "" {
+					target += "?" + r.URL.RawQuery
+				}
+				http.Redirect(w, r, target, http.StatusMovedPermanently)
+				return
+			}
+		}
+
+		// Serve the HTML file for the clean URL
+		if path.Ext(r.URL.Path) == "" && !strings.HasSuffix(r.URL.Path, "/") {
+			if _, err := stat(fsys, r.URL.Path); err != nil {
+				if info, err := stat(fsys, r.URL.Path+".html"); err == nil && !info.IsDir() {
+					logDetail(r, "Serving %s.html for the clean URL", r.URL.Path)
+					r = rewritePath(r, r.URL.Path+".html")
+				}
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// -------
+// INDEXES
+// -------
+
+// The default directory index filename (the only one http.FileServer knows about)
+const defaultIndex = "index.html"
+
+// Middleware that serves the first of the index files that exists for directory requests.
+// index.html is left to the file server, which serves it (and redirects /index.html to /).
+// If no index file exists, the directory listing is served instead (or a 404, if it is nil).
+func indexes(fsys http.FileSystem, names []string, listing http.Handler, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, name := range names {
+			file, err := fsys.Open(path.Join(r.URL.Path, name))
+			if err != nil {
+				continue
+			}
+			defer file.Close()
+			info, err := file.Stat()
+			if err != nil || info.IsDir() {
+				continue
+			}
+			logDetail(r, "Serving the directory index %s", path.Join(r.URL.Path, name))
+			if name == defaultIndex {
+				next.ServeHTTP(w, r) // Leave it to the file server
+			} else {
+				http.ServeContent(w, r, name, info.ModTime(), file)
+			}
+			return
+		}
+
+		// List the directory, if enabled
+		if info, err := stat(fsys, r.URL.Path); err == nil && info.IsDir() {
+			if listing == nil {
+				logDetail(r, "No index file in %s, and directory listings are disabled", r.URL.Path)
+				http.NotFound(w, r)
+			} else {
+				logDetail(r, "No index file in %s, so listing the directory", r.URL.Path)
+				listing.ServeHTTP(w, r)
+			}
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// A file system that hides index.html files, so that http.FileServer does not use them
+// as directory indexes. (The file server never serves them directly, it redirects to the directory.)
+type noIndexFS struct {
+	http.FileSystem
+}
+
+// Open the named file, unless it is an index.html file
+func (fsys noIndexFS) Open(name string) (http.File, error) {
+	if path.Base(name) == defaultIndex {
+		return nil, fs.ErrNotExist
+	}
+	return fsys.FileSystem.Open(name)
+}
+
+// Split a comma separated list of index filenames
+func parseIndexNames(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// A shallow copy of the request with the URL path replaced
+func rewritePath(r *http.Request, urlPath string) *http.Request {
+	rewritten := r.Clone(r.Context())
+	rewritten.URL.Path = urlPath
+	rewritten.URL.RawPath = ""
+	rewritten.RequestURI = rewritten.URL.RequestURI()
+	return rewritten
+}
@@ -0,0 +1,919 @@
+// Package server is the static file server of self-serve, to embed the same serving behavior in other
+// programs (and test suites). The self-serve command is a thin wrapper around Run.
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/netutil"
+)
+
+// ==========
+// SELF SERVE
+// ==========
+
+// Self Serve is a super simple static file server
+type Self struct {
+	host          string                 // The host to serve on
+	port          int                    // The port to use
+	network       string                 // The network to listen on: tcp4 or tcp6 to only use IPv4 or IPv6 (empty for both)
+	portRetry     int                    // The number of next ports to try when the port is in use
+	unix          string                 // The path of the Unix domain socket to listen on, instead of the host and port (if any)
+	activated     *os.File               // The socket passed by systemd to listen on, instead of the host and port (if socket activated)
+	dir           string                 // The directory to serve
+	archive       fs.FS                  // The files of the archive to serve in place of the directory (if serving an archive)
+	mounts        []mount                // The directories to serve under URL prefixes, besides the served directory
+	vhosts        []virtualHost          // The directories to serve for other hosts, in place of the served directory
+	singleFile    bool                   // Whether the directory is a single file, to serve at the root and its own name
+	stdin         *stdinFS               // The content read from stdin, to serve as the single file (if serving stdin)
+	contentType   string                 // The Content-Type to serve the single file with (empty to detect it)
+	download      bool                   // Whether to serve the single file as an attachment (with a Content-Disposition header)
+	cert          string                 // Path to the TLS certificate file
+	key           string                 // Path to the TLS private key file
+	tls           *tls.Config            // The TLS configuration to serve with (takes precedence over cert and key)
+	h2c           bool                   // Whether to serve HTTP/2 over cleartext
+	http3         bool                   // Whether to also serve HTTP/3 over QUIC
+	compress      bool                   // Whether to compress responses
+	precompressed bool                   // Whether to serve precompressed sidecar files
+	etag          bool                   // Whether to generate ETags for conditional requests
+	cache         cachePolicy            // The Cache-Control policy to apply to responses
+	noCache       bool                   // Whether to prevent browsers from caching responses at all
+	charset       charsetPolicy          // The charsets to declare on the text responses
+	headers       []headerRule           // Custom headers to set on responses
+	spa           bool                   // Whether to serve the root index.html for unknown paths
+	cleanURLs     bool                   // Whether to serve extensionless HTML files (e.g. /about for about.html)
+	indexes       []string               // The filenames to serve as directory indexes, in order of preference
+	listing       bool                   // Whether to list the contents of directories without an index file
+	hideDotfiles  bool                   // Whether to hide (and refuse to serve) dotfiles
+	exclude       func(name string) bool // Reports whether a file is excluded from being served (nil to not exclude any)
+	redirects     []redirectRule         // The redirect rules of the config file, after those of the _redirects file
+	pages         map[int]string         // Custom error pages by status code (relative to the served directory)
+	write         bool                   // Whether to create, overwrite and remove files with PUT, MKCOL and DELETE requests
+	proxies       []proxyRoute           // The path prefixes to forward to backends
+	mock          *mockAPI               // The mock REST API to serve (if any)
+	cgi           string                 // The directory of CGI scripts to execute (if any)
+	fastCGI       []fastCGIRoute         // The path prefixes to hand off to FastCGI responders
+	exec          []execRoute            // The paths to respond to with the output of commands
+	auth          *credentials           // The credentials to require with HTTP Basic authentication (if any)
+	htpasswd      htpasswd               // The users to accept with HTTP Basic authentication (if any)
+	token         string                 // The bearer token to require (if any)
+	access        accessList             // The IP address ranges allowed or denied access
+	rateLimiter   *rateLimiter           // The rate limiter for requests (if any)
+	inflight      *inflightLimiter       // The limit on the requests served at once (if any)
+	delay         *delay                 // The delay to respond after, to simulate a slow network (if any)
+	chaos         []chaosRule            // The failures to inject into a percentage of the requests (if any)
+	maxConns      int                    // The maximum number of concurrent connections (0 for no limit)
+	maxHeaderSize int                    // The maximum size of the request headers (0 for the default of 1 MB)
+	maxBodySize   int64                  // The maximum size of the request bodies (0 for no limit)
+	memoryCache   *memoryCache           // The cache of the hot files' contents (if caching them in memory)
+	mmapSize      int64                  // The size of the files to serve from memory maps, and up (0 to not map any)
+	timeouts      serverTimeouts         // The timeouts of the connections (zero for no limit)
+	shutdownWait  time.Duration          // How long to wait for the in-flight requests on shutdown, before closing their connections (0 for no limit)
+	throttle      int64                  // The bandwidth to throttle each connection to, in bytes per second (0 for no limit)
+	markdown      bool                   // Whether to render markdown files as HTML
+	templates     bool                   // Whether to execute .tmpl and .gohtml files as templates
+	layouts       bool                   // Whether to wrap the HTML files with frontmatter in their layouts
+	liveReload    bool                   // Whether to reload pages in the browser when files change
+	watchDebounce time.Duration          // How long to wait for file changes to settle before reloading
+	watchIgnore   func(name string) bool // Reports whether changes to a file should not trigger a reload (nil to not ignore any)
+	watchPoll     bool                   // Whether to poll for file changes instead of relying on file system notifications
+	server        *http.Server           // The server instance
+	announced     bool                   // Whether the address has been printed out to the console
+	qr            bool                   // Whether to print a QR code of the address, to open it on phones by scanning
+	open          string                 // The path to open in the browser once the server is ready (empty to not open one)
+	mdns          string                 // The name to advertise the server as over mDNS (like myproject, for myproject.local), if any
+	responder     *mdnsResponder         // The mDNS responder (if advertising over mDNS)
+	tunnelVia     *tunnelProvider        // The provider to expose the server at a public URL through (if any)
+	tunnel        *tunnel                // The running tunnel (if tunneling)
+	logFormat     string                 // The format to log the requests in: common or combined (empty for the default)
+	logFile       *rotatingFile          // The file to log the requests to, besides the console (if any)
+	noConsoleLog  bool                   // Whether to only log the requests to the log file, and not the console
+	quiet         bool                   // Whether to not log the requests to the console (only the startup, shutdown and errors)
+	verbose       bool                   // Whether to log the request headers and how the requests were resolved to files as well
+	metrics       *metrics               // The metrics of the requests (if exposing them)
+	health        bool                   // Whether to respond to health checks at /__health (bypassing authentication)
+	started       time.Time              // When the server first started
+	stats         *serverStats           // The statistics of the requests and connections (if reporting the status at /__status)
+	metricsPath   string                 // The path to expose the metrics at, in the Prometheus text format
+	inspector     *inspector             // The recorder of the recent requests (if inspecting them at /__inspect)
+	har           *harRecorder           // The recorder of the requests to write out as an HTTP Archive on shutdown (if any)
+	dashboard     *dashboard             // The live terminal dashboard, in place of the request logs (if any)
+	quic          *http3.Server          // The HTTP/3 server instance (if serving HTTP/3)
+	acme          *autocert.Manager      // The manager of the Let's Encrypt certificates (if using --acme)
+	challenges    *http.Server           // The server answering the ACME HTTP-01 challenges on port 80 (if using --acme)
+	watcher       *watcher               // The file watcher (if live reloading)
+	reload        *liveReload            // The live reload event broadcaster (if live reloading)
+	restart       chan bool              // A channel to listen for restarts
+	middleware    []Middleware           // The middleware added with Use, around the routes
+	hooks         hooks                  // The functions to call on the events of the server
+	logger        *log.Logger            // The logger of the startup, the requests and the errors
+	banner        io.Writer              // Where to print the address (and the QR code) on the first start
+	ready         chan struct{}          // Closed once the server first listens for connections (or fails to)
+	readyOnce     sync.Once              // Closes ready, once
+	bound         net.Addr               // The address the server is listening on (once ready, nil if it failed to listen)
+	mu            sync.Mutex             // Guards the server instances, the live reload and the shutdown flag, between Serve and Shutdown
+	shutdown      bool                   // Whether Shutdown was called, so that Serve does not start serving (until the restart)
+}
+
+// The timeouts of the server's connections (see http.Server)
+type serverTimeouts struct {
+	read       time.Duration // How long to allow for reading a request, including its body
+	readHeader time.Duration // How long to allow for reading the headers of a request
+	write      time.Duration // How long to allow for writing a response
+	idle       time.Duration // How long to keep idle keep-alive connections open
+}
+
+// The default timeouts: long enough for large uploads and downloads (and streams of events),
+// but not for slow clients holding connections open with their headers, or idle connections
+var defaultTimeouts = serverTimeouts{readHeader: 10 * time.Second, idle: 2 * time.Minute}
+
+// The default time to wait for the in-flight requests on shutdown
+const defaultShutdownWait = 10 * time.Second
+
+// Create a new instance of Self, serving the directory on the host and port (0 for any free port)
+// with the same defaults as the command-line flags
+func NewSelf(host, dir string, port int) *Self {
+	return &Self{
+		host:          host,
+		port:          port,
+		dir:           dir,
+		compress:      true,
+		precompressed: true,
+		etag:          true,
+		indexes:       []string{defaultIndex},
+		listing:       true,
+		hideDotfiles:  true,
+		pages:         map[int]string{http.StatusNotFound: "404.html"},
+		watchDebounce: defaultWatchDebounce,
+		timeouts:      defaultTimeouts,
+		shutdownWait:  defaultShutdownWait,
+		logger:        log.Default(),
+		banner:        os.Stdout,
+		restart:       make(chan bool),
+		ready:         make(chan struct{}),
+	}
+}
+
+// Boolean indicating whether the server should serve over HTTPS
+func (s *Self) IsTLS() bool {
+	return s.tls != nil || (s.cert != "" && s.key != "")
+}
+
+// The URL scheme the server is served on
+func (s *Self) Scheme() string {
+	if s.IsTLS() {
+		return "https"
+	}
+	return "http"
+}
+
+// The address the server is listening on (like 127.0.0.1:5327, with the port picked for port 0),
+// or nil if it is not listening yet (or could not listen)
+func (s *Self) Addr() net.Addr {
+	select {
+	case <-s.ready:
+		return s.bound
+	default:
+		return nil
+	}
+}
+
+// A channel that is closed once the server is listening for connections, or has failed to (when Serve
+// returns the error, and Addr is nil), to wait on before using Addr or Shutdown
+func (s *Self) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// The files of the served directory (or of the archive, single file or stdin served in its place),
+// along with the mounted directories
+func (s *Self) fileSystem() http.FileSystem {
+	var fsys http.FileSystem = http.Dir(s.dir)
+	if s.archive != nil {
+		fsys = http.FS(s.archive)
+	} else if s.stdin != nil {
+		fsys = s.stdin
+	} else if s.singleFile {
+		fsys = singleFileFS{s.dir}
+	}
+	if len(s.mounts) > 0 {
+		fsys = mountFS{fsys, s.mounts}
+	}
+	return fsys
+}
+
+// Create the handler that serves the files of a site (the served directory, or a virtual host's),
+// with all the enabled file serving features, and the directories mounted in it. A single site serves just the one file.
+func (s *Self) serveSite(dir string, fsys http.FileSystem, mounts []mount, single bool) http.Handler {
+	// Serve the large files from memory maps, if enabled
+	if s.mmapSize > 0 {
+		fsys = mmapFS{fsys, s.mmapSize}
+	}
+
+	// Keep the hot files in memory, if enabled
+	if s.memoryCache != nil && s.stdin == nil {
+		fsys = s.memoryCache.fileSystem(dir, fsys)
+	}
+
+	files := fsys // The files, before hiding any
+
+	// Hide dotfiles, if enabled
+	if s.hideDotfiles {
+		fsys = filteredFS{fsys, isDotfile}
+	}
+
+	// Hide the excluded files, if any
+	if s.exclude != nil {
+		fsys = filteredFS{fsys, s.exclude}
+	}
+
+	var fileServer http.Handler
+	if single {
+		fileServer = serveSingleFile(fsys, dir, s.contentType, s.download)
+	} else if slices.Contains(s.indexes, defaultIndex) {
+		fileServer = http.FileServer(fsys)
+	} else {
+		fileServer = http.FileServer(noIndexFS{fsys})
+	}
+
+	// The file serving features around the file server, from the outermost in
+	var middleware []Middleware
+
+	// Hand the scripts off to the FastCGI responders, if any
+	if len(s.fastCGI) > 0 {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return fastCGI(s.fastCGI, dir, mounts, fsys, next) })
+	}
+
+	// Create, overwrite and remove files with PUT, MKCOL and DELETE requests, if enabled
+	if s.write {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return writeFiles(dir, mounts, s.isHidden, next) })
+	}
+
+	// Apply the redirect rules from the _redirects file, if any
+	redirectRules, err := loadRedirectsFile(files)
+	if err != nil {
+		s.logError("Could not load the redirects file:", err)
+	}
+	if redirectRules = append(redirectRules, s.redirects...); len(redirectRules) > 0 {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return redirects(redirectRules, fsys, next) })
+	}
+
+	// Serve extensionless HTML files, if in clean URLs mode
+	if s.cleanURLs {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return cleanURLs(fsys, next) })
+	}
+
+	// Serve the root index.html for unknown paths, if in SPA mode
+	if s.spa {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return spa(fsys, next) })
+	}
+
+	// Set the custom response headers from the _headers file and the flags, if any
+	headers, err := loadHeadersFile(files)
+	if err != nil {
+		s.logError("Could not load the headers file:", err)
+	}
+	if headers = append(headers, s.headers...); len(headers) > 0 {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return customHeaders(headers, next) })
+	}
+
+	// Set the Cache-Control headers, if configured
+	if s.noCache {
+		middleware = append(middleware, noCache)
+	} else if !s.cache.IsEmpty() {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return cacheControl(s.cache, next) })
+	}
+
+	// Generate ETags for conditional requests, if enabled
+	if s.etag && !s.noCache {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return etags(fsys, next) })
+	}
+
+	// Compress responses, if enabled
+	if s.compress {
+		middleware = append(middleware, compress)
+	}
+
+	// Declare the charsets of the text responses, if configured
+	if !s.charset.IsEmpty() {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return declareCharset(s.charset, next) })
+	}
+
+	// Inject the live reload client into HTML pages, if enabled
+	if s.liveReload {
+		middleware = append(middleware, injectLiveReload)
+	}
+
+	// Stream directories as zip archives for ?zip requests, if listing them
+	if s.listing {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return downloadArchives(fsys, archiveName(dir), next) })
+	}
+
+	// Execute templates, if enabled (ahead of the source view, so that ?view=source never shows their source)
+	if s.templates {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return renderTemplates(fsys, next) })
+	}
+
+	// Render highlighted source for ?view=source requests
+	middleware = append(middleware, func(next http.Handler) http.Handler { return viewSource(fsys, next) })
+
+	// Strip the frontmatter from HTML files, and wrap them in their layouts, if enabled
+	if s.layouts {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return layouts(fsys, next) })
+	}
+
+	// Render markdown files as HTML, if enabled
+	if s.markdown {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return renderMarkdown(fsys, next) })
+	}
+
+	// Serve precompressed sidecar files, if enabled
+	if s.precompressed {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return precompressed(fsys, next) })
+	}
+
+	// Serve the custom error pages in place of error responses, if any
+	if len(s.pages) > 0 {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return errorPages(fsys, s.pages, next) })
+	}
+
+	// Serve the configured directory index files (or the listing, if enabled)
+	if !single {
+		var listing http.Handler
+		if s.listing {
+			listing = listDirectory(fsys, s.write)
+		}
+		middleware = append(middleware, func(next http.Handler) http.Handler { return indexes(fsys, s.indexes, listing, next) })
+	}
+
+	return chain(fileServer, middleware...)
+}
+
+// Serve the given directory until the server is shut down (returning http.ErrServerClosed, once it is)
+func (s *Self) Serve() (err error) {
+	// Report the errors to the OnError hooks (but not the server having been shut down),
+	// and stop waiting for the server to be ready if it never was
+	defer func() {
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.failed(err)
+		}
+		s.signalReady(nil)
+	}()
+
+	// Listen for connections, limiting the number of concurrent ones and their bandwidth, if configured
+	listener, err := s.listen()
+	if err != nil {
+		return err
+	}
+	if s.maxConns > 0 {
+		listener = netutil.LimitListener(listener, s.maxConns)
+	}
+	if s.throttle > 0 {
+		listener = throttledListener{listener, s.throttle}
+	}
+
+	// Keep the time of the first start, for the uptime
+	if s.started.IsZero() {
+		s.started = time.Now()
+	}
+
+	// Keep the port chosen for --port 0, so that restarts listen on the same one
+	if tcp, ok := listener.Addr().(*net.TCPAddr); ok && s.port == 0 {
+		s.port = tcp.Port
+	}
+
+	addr := s.addr()
+
+	// Serve the files of the served directory, and of the virtual hosts, if any
+	fileServer := s.serveSite(s.dir, s.fileSystem(), s.mounts, s.singleFile)
+	if len(s.vhosts) > 0 {
+		sites := make(map[string]http.Handler, len(s.vhosts))
+		for _, vhost := range s.vhosts {
+			sites[vhost.host] = s.serveSite(vhost.dir, http.Dir(vhost.dir), nil, false)
+		}
+		fileServer = virtualHosts(sites, fileServer)
+	}
+
+	// Serve the mock REST API, if any
+	if s.mock != nil {
+		fileServer = s.mock.handler(fileServer)
+	}
+
+	// Execute the CGI scripts, if any
+	if s.cgi != "" {
+		fileServer = cgiScripts(cgiPrefix(s.cgi), s.cgi, fileServer)
+	}
+
+	// Respond with the output of the exec routes' commands, if any
+	if len(s.exec) > 0 {
+		fileServer = execRoutes(s.exec, fileServer)
+	}
+
+	// Forward the proxied path prefixes to their backends, if any
+	if len(s.proxies) > 0 {
+		fileServer = proxies(s.proxies, fileServer)
+	}
+
+	// Serve the live reload endpoints, and watch the files for changes, if enabled
+	if s.liveReload {
+		reload, err := s.startLiveReload()
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		mux := http.NewServeMux()
+		mux.Handle(liveReloadEventsPath, reload)
+		mux.HandleFunc(liveReloadWebSocketPath, reload.serveWebSocket)
+		mux.HandleFunc(liveReloadScriptPath, serveLiveReloadScript)
+		mux.Handle("/", fileServer)
+		fileServer = mux
+	}
+
+	// The middleware around the routes, from the outermost in
+	var middleware []Middleware
+
+	// Serve HTTP/3 alongside the TCP listener, and advertise it via Alt-Svc
+	var quic *http3.Server
+	if s.http3 {
+		middleware = append(middleware, func(next http.Handler) (handler http.Handler) {
+			quic, handler = s.serveHTTP3(addr, next)
+			return handler
+		})
+	}
+
+	// Respond to the health checks ahead of everything else, if enabled
+	if s.health {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return healthCheck(s.started, s.dir, next) })
+	}
+
+	// Identify the requests (in the logs and the responses)
+	middleware = append(middleware, requestIDs)
+
+	// Report the requests to the OnRequest hooks, if any
+	if len(s.hooks.request) > 0 {
+		middleware = append(middleware, s.reportRequests)
+	}
+
+	// Log the requests (to the dashboard in place of the console, if enabled)
+	var logFile io.Writer
+	if s.logFile != nil {
+		logFile = s.logFile
+	}
+	console := !s.noConsoleLog && !s.quiet && s.dashboard == nil
+	middleware = append(middleware, func(next http.Handler) http.Handler {
+		return logRequests(s.logger, s.logFormat, console, s.verbose, logFile, next)
+	})
+
+	// Record the requests for the dashboard, if enabled
+	if s.dashboard != nil {
+		middleware = append(middleware, s.dashboard.record)
+	}
+
+	// Record the requests for the HTTP Archive, if enabled
+	if s.har != nil {
+		middleware = append(middleware, s.har.record)
+	}
+
+	// Record the requests for the inspector, if enabled
+	if s.inspector != nil {
+		middleware = append(middleware, s.inspector.record)
+	}
+
+	// Count the requests for the status report, if enabled
+	if s.stats != nil {
+		middleware = append(middleware, s.stats.count)
+	}
+
+	// Record the metrics of the requests, if enabled
+	if s.metrics != nil {
+		middleware = append(middleware, s.metrics.instrument)
+	}
+
+	// Limit the number of requests served at once, if configured
+	if s.inflight != nil {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return limitInflight(s.inflight, next) })
+	}
+
+	// Refuse the requests from denied addresses, if configured
+	if !s.access.IsEmpty() {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return accessControl(s.access, next) })
+	}
+
+	// Limit the rate of requests, if configured
+	if s.rateLimiter != nil {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return rateLimit(s.rateLimiter, next) })
+	}
+
+	// Require authentication, if enabled
+	if s.auth != nil || s.htpasswd != nil {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return authenticate(s.verifyCredentials, s.token, next) })
+	} else if s.token != "" {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return authenticate(nil, s.token, next) })
+	}
+
+	// Serve the request inspector, if enabled
+	if s.inspector != nil {
+		middleware = append(middleware, s.inspector.serve)
+	}
+
+	// Report the status of the server, if enabled
+	if s.stats != nil {
+		middleware = append(middleware, s.serveStatus)
+	}
+
+	// Serve the metrics, if enabled
+	if s.metrics != nil {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return s.metrics.serve(s.metricsPath, next) })
+	}
+
+	// The middleware added with Use, in the order it was added
+	middleware = append(middleware, s.middleware...)
+
+	// Delay the responses, if configured
+	if s.delay != nil {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return delayResponses(*s.delay, next) })
+	}
+
+	// Inject failures into the requests, if configured
+	if len(s.chaos) > 0 {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return injectChaos(s.chaos, next) })
+	}
+
+	// Limit the size of the request bodies, if configured
+	if s.maxBodySize > 0 {
+		middleware = append(middleware, func(next http.Handler) http.Handler { return limitBodies(s.maxBodySize, next) })
+	}
+
+	handler := chain(fileServer, middleware...)
+
+	// Setup the server instance
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		TLSConfig:         s.tls,
+		ReadTimeout:       s.timeouts.read,
+		ReadHeaderTimeout: s.timeouts.readHeader,
+		WriteTimeout:      s.timeouts.write,
+		IdleTimeout:       s.timeouts.idle,
+		MaxHeaderBytes:    s.maxHeaderSize,
+	}
+	if s.stats != nil || s.dashboard != nil {
+		server.ConnState = s.trackConnection
+	}
+
+	// Allow HTTP/2 over cleartext (h2c) alongside HTTP/1
+	if s.h2c {
+		server.Protocols = new(http.Protocols)
+		server.Protocols.SetHTTP1(true)
+		server.Protocols.SetHTTP2(true)
+		server.Protocols.SetUnencryptedHTTP2(true)
+	}
+
+	// Keep the server instances for Shutdown, unless it was already called
+	s.mu.Lock()
+	if s.shutdown {
+		s.stopLiveReload() // Started above, after Shutdown had already stopped it
+		s.mu.Unlock()
+		listener.Close()
+		return http.ErrServerClosed
+	}
+	var challenges *http.Server
+	if s.acme != nil {
+		challenges = acmeChallengeServer(s.acme)
+	}
+	s.server, s.quic, s.challenges = server, quic, challenges
+	s.mu.Unlock()
+	if quic != nil {
+		s.startHTTP3(quic)
+	}
+	if challenges != nil {
+		s.startACMEChallenges(challenges)
+	}
+
+	// Signal that the server is ready, with the address listened on
+	s.signalReady(listener.Addr())
+	s.listened(listener.Addr())
+
+	// Advertise the server on the local network over mDNS, if enabled (once, on the first start)
+	if s.mdns != "" && s.responder == nil {
+		if s.responder, err = startMDNS(s.mdns, s.Scheme(), s.port); err != nil {
+			s.logError("Could not advertise over mDNS:", err)
+		}
+	}
+
+	// Expose the server at a public URL through the tunnel, if enabled (once, on the first start)
+	if s.tunnelVia != nil && s.tunnel == nil {
+		if s.tunnel, err = startTunnel(*s.tunnelVia, s.loopbackAddr(), s.IsTLS(), s.announceTunnel); err != nil {
+			s.logError("Could not start the tunnel:", err)
+		}
+	}
+
+	// Start the server
+	s.announce()
+	fmt.Fprintln(s.banner) // empty line before server start
+	s.logger.Println("Server started on", listener.Addr())
+	if s.IsTLS() {
+		return server.ServeTLS(listener, s.cert, s.key)
+	}
+	return server.Serve(listener)
+}
+
+// Signal that the server is ready, listening on the address (nil if it could not listen), once on the first start
+func (s *Self) signalReady(addr net.Addr) {
+	s.readyOnce.Do(func() {
+		s.bound = addr
+		close(s.ready)
+	})
+}
+
+// Track the open connections, for the status report and the dashboard (as the http.Server's ConnState hook)
+func (s *Self) trackConnection(conn net.Conn, state http.ConnState) {
+	if s.stats != nil {
+		s.stats.trackConnection(conn, state)
+	}
+	if s.dashboard != nil {
+		s.dashboard.trackConnection(conn, state)
+	}
+}
+
+// Print out the address to the console, and open it in the browser if enabled (once, on the first start)
+func (s *Self) announce() {
+	if s.announced {
+		return
+	}
+	s.announced = true
+	if s.activated != nil {
+		fmt.Fprintf(s.banner, "File Server running on the socket passed by systemd (%s)", s.Scheme())
+	} else if s.unix != "" {
+		fmt.Fprintf(s.banner, "File Server running on %s (%s)", colorize(stdoutColor, colorLink, s.unix), s.Scheme())
+	} else {
+		fmt.Fprintf(s.banner, "File Server running on %s", colorize(stdoutColor, colorLink, s.Scheme()+"://"+s.addr()))
+	}
+	if s.stdin != nil {
+		fmt.Fprint(s.banner, "\t"+colorize(stdoutColor, colorGray, "| Press `Ctrl+C` to quit")+"\n") // stdin is taken by the content, so it cannot restart
+	} else {
+		fmt.Fprint(s.banner, "\t"+colorize(stdoutColor, colorGray, "| Press `r` then `enter` to restart • `Ctrl+C` to quit")+"\n")
+	}
+	if s.responder != nil {
+		fmt.Fprintf(s.banner, "Advertised over mDNS as %s\n", colorize(stdoutColor, colorLink, fmt.Sprintf("%s://%s.local:%v", s.Scheme(), s.mdns, s.port)))
+	}
+	if s.token != "" {
+		fmt.Fprintf(s.banner, "Share with the token: %s\n", colorize(stdoutColor, colorLink, fmt.Sprintf("%s://%s/?token=%s", s.Scheme(), s.addr(), s.token)))
+	}
+	urls := s.networkURLs()
+	for _, url := range urls {
+		fmt.Fprintf(s.banner, "On your network: %s\n", colorize(stdoutColor, colorLink, url))
+	}
+	if s.qr && s.unix == "" && s.activated == nil {
+		s.printQR(urls)
+	}
+	if s.open != "" {
+		if err := openBrowser(s.localURL(s.open)); err != nil {
+			s.logError("Could not open the browser:", err)
+		}
+	}
+}
+
+// Print out the public URL of the tunnel
+func (s *Self) announceTunnel(url string) {
+	if s.token != "" {
+		url += "/?token=" + s.token
+	}
+	fmt.Fprintf(s.banner, "Public URL: %s\n", colorize(stdoutColor, colorLink, url))
+}
+
+// The URL of the path on this machine (with the token, if any)
+func (s *Self) localURL(path string) string {
+	url := fmt.Sprintf("%s://%s%s", s.Scheme(), s.loopbackAddr(), path)
+	if s.token != "" {
+		url += "?token=" + s.token
+	}
+	return url
+}
+
+// The address to listen on (with brackets around IPv6 hosts, like `[::1]:5327`)
+func (s *Self) addr() string {
+	return net.JoinHostPort(s.host, strconv.Itoa(s.port))
+}
+
+// The address to reach the server at on this machine (with a loopback address in place of the unspecified address)
+func (s *Self) loopbackAddr() string {
+	host := s.host
+	if isUnspecifiedHost(host) {
+		host = "localhost" // The unspecified address cannot be connected to
+		if s.tcpNetwork() == "tcp6" {
+			host = "::1"
+		}
+	}
+	return net.JoinHostPort(host, strconv.Itoa(s.port))
+}
+
+// The network to listen on: tcp4 or tcp6 when only using IPv4 or IPv6 (including for IPv4 hosts,
+// like 0.0.0.0, which would otherwise be listened on over IPv6 as well), or else tcp for both
+func (s *Self) tcpNetwork() string {
+	if s.network != "" {
+		return s.network
+	}
+	if ip := net.ParseIP(s.host); ip != nil && ip.To4() != nil {
+		return "tcp4"
+	}
+	return "tcp"
+}
+
+// Print a QR code of the first network URL (or of the address, if there are none)
+func (s *Self) printQR(urls []string) {
+	url := s.Scheme() + "://" + s.addr()
+	if s.token != "" {
+		url += "/?token=" + s.token
+	}
+	if len(urls) > 0 {
+		url = urls[0]
+	}
+	qr, err := encodeQR(url)
+	if err != nil {
+		s.logError("Could not create the QR code:", err)
+		return
+	}
+	fmt.Fprint(s.banner, qr)
+}
+
+// The URLs the server can be reached at from other devices on the network, when
+// listening on all interfaces (e.g. `http://192.168.1.42:5327`)
+func (s *Self) networkURLs() []string {
+	if s.unix != "" || s.activated != nil || !isUnspecifiedHost(s.host) {
+		return nil
+	}
+	var urls []string
+	network := s.tcpNetwork()
+	for _, ip := range lanIPs() {
+		if (network == "tcp4" && ip.To4() == nil) || (network == "tcp6" && ip.To4() != nil) {
+			continue // Not listening over the IP version
+		}
+		url := fmt.Sprintf("%s://%s", s.Scheme(), net.JoinHostPort(ip.String(), strconv.Itoa(s.port)))
+		if s.token != "" {
+			url += "/?token=" + s.token
+		}
+		urls = append(urls, url)
+	}
+	return urls
+}
+
+// Listen on the socket passed by systemd, if socket activated, or on the Unix domain socket,
+// if configured, or else on the host and port (trying the next ports while it is in use, if enabled)
+func (s *Self) listen() (net.Listener, error) {
+	if s.activated != nil {
+		return net.FileListener(s.activated) // Duplicates the socket, which is kept open for restarts
+	}
+	if s.unix == "" {
+		for retries := s.portRetry; ; retries-- {
+			listener, err := net.Listen(s.tcpNetwork(), s.addr())
+			if err == nil || retries <= 0 || s.port == 0 || s.port >= 65535 || !errors.Is(err, syscall.EADDRINUSE) {
+				return listener, err
+			}
+			s.logger.Printf("Port %v is in use, trying %v\n", s.port, s.port+1)
+			s.port++ // Keep the port that is found, so that restarts listen on the same one
+		}
+	}
+	// Remove the socket left behind by a previous run that did not shut down cleanly
+	if info, err := os.Stat(s.unix); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(s.unix)
+	}
+	return net.Listen("unix", s.unix)
+}
+
+// Gracefully shutdown the server (and the HTTP/3 server and the file watcher, if any). Serve returns
+// http.ErrServerClosed from then on, even if it had not started serving yet. Shutdown can be called
+// more than once: the instances are only shut down by the first call after they were started.
+func (s *Self) Shutdown(ctx context.Context) error {
+	if s.inspector != nil {
+		s.inspector.disconnect() // Disconnect the inspector pages, so that the connections can close
+	}
+	s.mu.Lock()
+	s.shutdown = true // So that a Serve that has not started serving yet does not
+	s.stopLiveReload()
+	server, quic, challenges := s.server, s.quic, s.challenges
+	s.server, s.quic, s.challenges = nil, nil, nil // So that a second Shutdown does not shut them down again
+	s.mu.Unlock()
+	defer s.shutDown()
+
+	if challenges != nil {
+		challenges.Close() // Nothing to drain: the challenges are answered right away
+	}
+	var errs []error
+	if quic != nil {
+		if err := quic.Shutdown(ctx); errors.Is(err, context.DeadlineExceeded) {
+			quic.Close() // Give up on the requests still in-flight
+		} else if err != nil {
+			errs = append(errs, err) // Still shut the TCP server down
+		}
+	}
+	if server != nil { // Otherwise, the server never started (e.g. the port was taken)
+		server.SetKeepAlivesEnabled(false) // Respond with `Connection: close` while draining, so that the clients reconnect elsewhere
+		err := server.Shutdown(ctx)
+		if errors.Is(err, context.DeadlineExceeded) {
+			s.logger.Println("Closing the connections of the requests that did not finish in time")
+			err = server.Close()
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Gracefully shutdown the server, giving the in-flight requests up to the shutdown timeout (if any) to finish
+func (s *Self) drain() error {
+	ctx := context.Background()
+	if s.shutdownWait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.shutdownWait)
+		defer cancel()
+	}
+	return s.Shutdown(ctx)
+}
+
+// Handle graceful exit
+func (s *Self) handleGracefulExit() {
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt)
+	<-signalChan
+	s.exit()
+}
+
+// Gracefully shutdown the server (saving the HTTP Archive, if recording one), and signal not to restart
+func (s *Self) exit() {
+	s.logger.Println("Closing the server...")
+	if s.tunnel != nil {
+		s.tunnel.Close()
+	}
+	if s.responder != nil {
+		s.responder.Close() // Say goodbye, so that the name stops resolving right away
+	}
+	if err := s.drain(); err != nil {
+		s.logger.Fatalf("Could not gracefully shutdown the server: %v\n", err)
+	}
+	if s.har != nil {
+		if err := s.har.save(); err != nil {
+			s.logError("Could not write the HAR file:", err)
+		} else {
+			s.logger.Println("Recorded the requests to", s.har.path)
+		}
+	}
+	s.restart <- false // Signal not to restart
+}
+
+// Listen for keyboard input to restart the server
+func (s *Self) handleRestart() {
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		text, err := reader.ReadString('\n')
+		if err != nil {
+			return // stdin was closed, so there is nothing more to listen for
+		}
+		if strings.TrimSpace(text) == "r" {
+			s.restartServer()
+		}
+	}
+}
+
+// Gracefully shutdown the server, and signal to restart it
+func (s *Self) restartServer() {
+	s.logger.Println("Restarting the server...")
+	if err := s.drain(); err != nil {
+		s.logger.Fatalf("Could not gracefully shutdown the server: %v\n", err)
+	}
+	s.mu.Lock()
+	s.shutdown = false // Serve again
+	s.mu.Unlock()
+	s.restart <- true // Signal to restart
+}
+
+// Boolean indicating whether the server is done serving
+func (s *Self) IsDone() bool {
+	return !<-s.restart // `true` when not restarting
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Boolean indicating whether the host is the unspecified address (like 0.0.0.0), which listens on all interfaces
+func isUnspecifiedHost(host string) bool {
+	return host == "" || net.ParseIP(host).IsUnspecified()
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// ================
+// SINGLE FILE MODE
+// ================
+
+// A file system of a single file, which is available both at the root and at its own name
+type singleFileFS struct {
+	name string // The path of the file on disk
+}
+
+// Open the file, if the name is the root or the file's own name
+func (fsys singleFileFS) Open(name string) (http.File, error) {
+	name = path.Clean("/" + name)
+	if name != "/" && name != "/"+filepath.Base(fsys.name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return os.Open(fsys.name)
+}
+
+// Handler that serves the single file (at the root and at its own name), as an attachment
+// if download is set. The Content-Type is determined by the file's real name (or its contents),
+// unless one is given.
+func serveSingleFile(fsys http.FileSystem, name, contentType string, download bool) http.Handler {
+	base := filepath.Base(name)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, err := fsys.Open(r.URL.Path)
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			requestLogger(r).Println("Could not open the file:", err)
+			http.Error(w, "Error reading file", http.StatusInternalServerError)
+			return
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			requestLogger(r).Println("Could not open the file:", err)
+			http.Error(w, "Error reading file", http.StatusInternalServerError)
+			return
+		}
+
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		if download {
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": base}))
+		}
+		http.ServeContent(w, r, base, info.ModTime(), file)
+	})
+}
+
+// -----
+// STDIN
+// -----
+
+// A file system of content read from stdin, which is available at the root
+type stdinFS struct {
+	data     []byte    // The content read from stdin
+	modified time.Time // When the content was read
+}
+
+// Read stdin (until it is closed) into a file system
+func readStdin() (stdinFS, error) {
+	data, err := io.ReadAll(os.Stdin)
+	return stdinFS{data, time.Now()}, err
+}
+
+// Open the content, if the name is the root
+func (fsys stdinFS) Open(name string) (http.File, error) {
+	if path.Clean("/"+name) != "/" {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return stdinFile{bytes.NewReader(fsys.data), fsys}, nil
+}
+
+// The content read from stdin, opened for reading
+type stdinFile struct {
+	*bytes.Reader
+	fsys stdinFS
+}
+
+func (f stdinFile) Close() error                       { return nil }
+func (f stdinFile) Readdir(int) ([]fs.FileInfo, error) { return nil, fs.ErrInvalid }
+func (f stdinFile) Stat() (fs.FileInfo, error)         { return f, nil }
+func (f stdinFile) Name() string                       { return "stdin" }
+func (f stdinFile) Size() int64                        { return int64(len(f.fsys.data)) }
+func (f stdinFile) Mode() fs.FileMode                  { return 0o444 }
+func (f stdinFile) ModTime() time.Time                 { return f.fsys.modified }
+func (f stdinFile) IsDir() bool                        { return false }
+func (f stdinFile) Sys() any                           { return nil }
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Boolean indicating whether the path is a regular file (rather than a directory or an archive)
+func isSingleFile(name string) bool {
+	info, err := os.Stat(name)
+	return err == nil && info.Mode().IsRegular() && archiveExtension(name) == ""
+}
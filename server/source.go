@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// ===========
+// SOURCE VIEW
+// ===========
+
+// The largest file that is rendered as highlighted source (larger files are served as is)
+const maxSourceViewSize = 1 << 20 // 1 MB
+
+// The formatter for highlighted source, with linkable line numbers (e.g. `#L42`)
+var sourceFormatter = chromahtml.New(
+	chromahtml.WithClasses(true),
+	chromahtml.WithLineNumbers(true),
+	chromahtml.WithLinkableLineNumbers(true, "L"),
+	chromahtml.TabWidth(4),
+)
+
+// Middleware that renders text files as syntax highlighted HTML with line numbers,
+// when requested with `?view=source`
+func viewSource(fsys http.FileSystem, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || r.URL.Query().Get("view") != "source" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		file, err := fsys.Open(r.URL.Path)
+		if err != nil {
+			next.ServeHTTP(w, r) // Leave the error to the file server
+			return
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil || info.IsDir() || info.Size() > maxSourceViewSize {
+			next.ServeHTTP(w, r)
+			return
+		}
+		source, err := io.ReadAll(file)
+		if err != nil {
+			requestLogger(r).Println("Could not read the source file:", err)
+			http.Error(w, "Error reading file", http.StatusInternalServerError)
+			return
+		}
+		if !utf8.Valid(source) {
+			next.ServeHTTP(w, r) // Binary files cannot be highlighted
+			return
+		}
+
+		page, err := renderSourcePage(source, info.Name())
+		if err != nil {
+			requestLogger(r).Println("Could not highlight the source file:", err)
+			http.Error(w, "Error highlighting source", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		http.ServeContent(w, r, info.Name(), info.ModTime(), bytes.NewReader(page))
+	})
+}
+
+// Render the source as a complete, syntax highlighted HTML page
+func renderSourcePage(source []byte, name string) ([]byte, error) {
+	lexer := lexers.Match(name)
+	if lexer == nil {
+		lexer = lexers.Analyse(string(source))
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	tokens, err := chroma.Coalesce(lexer).Tokenise(nil, string(source))
+	if err != nil {
+		return nil, err
+	}
+
+	var code bytes.Buffer
+	if err := sourceFormatter.Format(&code, styles.Get("github"), tokens); err != nil {
+		return nil, err
+	}
+	var page bytes.Buffer
+	err = sourceTemplate.Execute(&page, sourceData{
+		Name:     name,
+		Language: lexer.Config().Name,
+		Code:     template.HTML(code.String()),
+		Styles:   sourceStyles,
+	})
+	return page.Bytes(), err
+}
+
+// The data passed to the source view template
+type sourceData struct {
+	Name     string        // The name of the file
+	Language string        // The name of the detected language
+	Code     template.HTML // The highlighted source
+	Styles   template.CSS  // The highlighting styles
+}
+
+// The highlighting styles, following the light or dark color scheme of the browser
+var sourceStyles = func() template.CSS {
+	var css bytes.Buffer
+	sourceFormatter.WriteCSS(&css, styles.Get("github"))
+	css.WriteString("@media (prefers-color-scheme: dark) {\n")
+	sourceFormatter.WriteCSS(&css, styles.Get("github-dark"))
+	css.WriteString("}\n")
+	return template.CSS(css.String())
+}()
+
+// --------
+// TEMPLATE
+// --------
+
+// The HTML template for the source view
+var sourceTemplate = template.Must(template.New("source").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Name}}</title>
+<style>
+	:root { color-scheme: light dark; --muted: #888; }
+	body { font-family: system-ui, sans-serif; margin: 0; }
+	header { align-items: baseline; border-bottom: 1px solid var(--muted); display: flex; gap: 1rem; padding: 0.75rem 1rem; }
+	header h1 { font-size: 1rem; font-weight: 500; margin: 0; }
+	header span { color: var(--muted); font-size: 0.9rem; }
+	header a { font-size: 0.9rem; margin-left: auto; }
+	pre { font-family: ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; font-size: 0.875rem; margin: 0; padding: 1rem 0; }
+	{{.Styles}}
+</style>
+</head>
+<body>
+<header>
+	<h1>{{.Name}}</h1>
+	<span>{{.Language}}</span>
+	<a href="?raw">Raw</a>
+</header>
+{{.Code}}
+</body>
+</html>
+`))
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"cmp"
+	"encoding/json"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// =============
+// STATUS REPORT
+// =============
+
+// The path of the status endpoint
+const statusPath = "/__status"
+
+// The number of most requested paths to report
+const topPathsCount = 10
+
+// The most distinct paths to count requests for (so that scans cannot exhaust the memory)
+const maxCountedPaths = 10000
+
+// The statistics of the requests and connections of a long-running server
+type serverStats struct {
+	connections atomic.Int64 // The number of open connections
+
+	mu       sync.Mutex
+	total    int64            // The number of requests served
+	statuses map[int]int64    // The number of requests served, by status code
+	paths    map[string]int64 // The number of requests served, by path
+}
+
+// Create empty statistics
+func newServerStats() *serverStats {
+	return &serverStats{statuses: make(map[int]int64), paths: make(map[string]int64)}
+}
+
+// Middleware that counts the requests, by status code and path
+func (st *serverStats) count(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lw := &loggingWriter{ResponseWriter: w}
+		next.ServeHTTP(lw, r)
+		status := lw.status
+		if status == 0 {
+			status = http.StatusOK // Nothing was written
+		}
+
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		st.total++
+		st.statuses[status]++
+		if _, ok := st.paths[r.URL.Path]; ok || len(st.paths) < maxCountedPaths {
+			st.paths[r.URL.Path]++
+		}
+	})
+}
+
+// Track the number of open connections (as the http.Server's ConnState hook)
+func (st *serverStats) trackConnection(_ net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		st.connections.Add(1)
+	case http.StateClosed, http.StateHijacked:
+		st.connections.Add(-1)
+	}
+}
+
+// The report of the status endpoint
+type statusReport struct {
+	Version     string         `json:"version"`     // The version of self-serve
+	Started     time.Time      `json:"started"`     // When the server first started
+	Uptime      float64        `json:"uptime"`      // How long the server has been up, in seconds
+	Config      map[string]any `json:"config"`      // The configuration of the server
+	Requests    int64          `json:"requests"`    // The number of requests served
+	Statuses    map[int]int64  `json:"statuses"`    // The number of requests served, by status code
+	TopPaths    []pathCount    `json:"topPaths"`    // The most requested paths
+	Connections int64          `json:"connections"` // The number of open connections
+}
+
+// The number of requests for a path
+type pathCount struct {
+	Path     string `json:"path"`
+	Requests int64  `json:"requests"`
+}
+
+// Middleware that responds to the status endpoint with the configuration, the uptime and the statistics of the server
+func (s *Self) serveStatus(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != statusPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		st := s.stats
+		st.mu.Lock()
+		report := statusReport{
+			Version:     VERSION,
+			Started:     s.started,
+			Uptime:      time.Since(s.started).Round(time.Millisecond).Seconds(),
+			Config:      s.statusConfig(),
+			Requests:    st.total,
+			Statuses:    maps.Clone(st.statuses),
+			TopPaths:    topPaths(st.paths, topPathsCount),
+			Connections: st.connections.Load(),
+		}
+		st.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	})
+}
+
+// The configuration of the server to report (without any credentials)
+func (s *Self) statusConfig() map[string]any {
+	config := map[string]any{
+		"dir":          s.dir,
+		"scheme":       s.Scheme(),
+		"listing":      s.listing,
+		"spa":          s.spa,
+		"cleanURLs":    s.cleanURLs,
+		"compress":     s.compress,
+		"liveReload":   s.liveReload,
+		"markdown":     s.markdown,
+		"templates":    s.templates,
+		"layouts":      s.layouts,
+		"write":        s.write,
+		"hideDotfiles": s.hideDotfiles,
+		"auth":         s.auth != nil || s.htpasswd != nil || s.token != "",
+		"rateLimit":    s.rateLimiter != nil,
+		"maxConns":     s.maxConns,
+	}
+	if s.unix != "" {
+		config["unix"] = s.unix
+	} else {
+		config["host"], config["port"] = s.host, s.port
+	}
+	if len(s.mounts) > 0 {
+		mounts := make(map[string]string, len(s.mounts))
+		for _, m := range s.mounts {
+			mounts[m.prefix] = m.dir
+		}
+		config["mounts"] = mounts
+	}
+	if len(s.proxies) > 0 {
+		config["proxies"] = len(s.proxies)
+	}
+	return config
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// The n most requested paths, most requested first (and alphabetically among equals)
+func topPaths(paths map[string]int64, n int) []pathCount {
+	counts := make([]pathCount, 0, len(paths))
+	for path, requests := range paths {
+		counts = append(counts, pathCount{path, requests})
+	}
+	slices.SortFunc(counts, func(a, b pathCount) int {
+		return cmp.Or(cmp.Compare(b.Requests, a.Requests), cmp.Compare(a.Path, b.Path))
+	})
+	return counts[:min(n, len(counts))]
+}
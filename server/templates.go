@@ -0,0 +1,100 @@
+package server
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// =========
+// TEMPLATES
+// =========
+
+// Middleware that executes `.tmpl` and `.gohtml` files as html/templates, with access
+// to the request (see templateData). The output is served as HTML, unless the name has
+// another inner extension (e.g. `feed.xml.tmpl`).
+func renderTemplates(fsys http.FileSystem, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isTemplate(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		file, err := fsys.Open(r.URL.Path)
+		if err != nil {
+			next.ServeHTTP(w, r) // Leave the error to the file server
+			return
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil || info.IsDir() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		source, err := io.ReadAll(file)
+		if err != nil {
+			requestLogger(r).Println("Could not read the template:", err)
+			http.Error(w, "Error reading template", http.StatusInternalServerError)
+			return
+		}
+
+		// Execute the template into a buffer, so that errors can still be reported
+		var output bytes.Buffer
+		tmpl, err := template.New(info.Name()).Parse(string(source))
+		if err == nil {
+			err = tmpl.Execute(&output, newTemplateData(r))
+		}
+		if err != nil {
+			requestLogger(r).Println("Could not execute the template:", err)
+			http.Error(w, "Error executing template", http.StatusInternalServerError)
+			return
+		}
+
+		// The output depends on the request, so it cannot be validated by the file's ETag
+		h := w.Header()
+		h.Del("ETag")
+		h.Set("Content-Type", pageContentType(strings.TrimSuffix(info.Name(), path.Ext(info.Name()))))
+		if r.Method != http.MethodHead {
+			w.Write(output.Bytes())
+		}
+	})
+}
+
+// The data passed to the templates
+type templateData struct {
+	Method     string      // The request method (e.g. GET)
+	Path       string      // The request path (e.g. /greet.gohtml)
+	Query      url.Values  // The query parameters (e.g. {{.Query.Get "name"}})
+	Header     http.Header // The request headers (e.g. {{.Header.Get "User-Agent"}})
+	Host       string      // The requested host
+	RemoteAddr string      // The address of the client
+}
+
+// Create the template data for the request
+func newTemplateData(r *http.Request) templateData {
+	return templateData{
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Query:      r.URL.Query(),
+		Header:     r.Header,
+		Host:       r.Host,
+		RemoteAddr: r.RemoteAddr,
+	}
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Boolean indicating whether the file is a template
+func isTemplate(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".tmpl", ".gohtml":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTemplatesSourceView(t *testing.T) {
+	dir := t.TempDir()
+	mustWrite(t, filepath.Join(dir, "page.gohtml"), `<p>{{"rendered"}}</p>`)
+	mustWrite(t, filepath.Join(dir, "notes.txt"), "notes")
+
+	s := New(WithDir(dir), WithHost("127.0.0.1"), WithPort(0), WithLogger(log.New(io.Discard, "", 0)), WithBanner(nil))
+	s.templates = true
+	url := startServer(t, s)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/page.gohtml", want: "<p>rendered</p>"},
+		{path: "/page.gohtml?view=source", want: "<p>rendered</p>"}, // Not the template's source
+		{path: "/notes.txt?view=source", want: "<pre"},
+	}
+	for _, tt := range tests {
+		res, err := http.Get(url + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if !strings.Contains(string(body), tt.want) {
+			t.Errorf("GET %s = %q, want it to contain %q", tt.path, body, tt.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/time/rate"
+)
+
+// ====================
+// BANDWIDTH THROTTLING
+// ====================
+
+// The most bytes to write at once, when throttling (so that the writes trickle out evenly)
+const maxThrottledWrite = 16 << 10
+
+// A listener whose connections write at most the bandwidth, each (to simulate a constrained link)
+type throttledListener struct {
+	net.Listener
+	bytesPerSecond int64
+}
+
+// Accept a connection, throttling its writes
+func (l throttledListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	burst := int(min(l.bytesPerSecond, maxThrottledWrite))
+	return &throttledConn{Conn: conn, limiter: rate.NewLimiter(rate.Limit(l.bytesPerSecond), burst)}, nil
+}
+
+// A connection that writes at most the bandwidth of its limiter
+type throttledConn struct {
+	net.Conn
+	limiter *rate.Limiter
+}
+
+// Write the bytes in chunks, waiting for the bandwidth to allow each
+func (c *throttledConn) Write(b []byte) (int, error) {
+	var written int
+	for len(b) > 0 {
+		chunk := b[:min(len(b), c.limiter.Burst())]
+		if err := c.limiter.WaitN(context.Background(), len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Parse a bandwidth in bits per second (like 512kbps or 2mbps), or bytes per second (like 64KB/s or 1MB/s),
+// as a number of bytes per second
+func parseBandwidth(value string) (int64, error) {
+	invalid := fmt.Errorf("invalid bandwidth %q (expected a rate like 512kbps, 2mbps or 1MB/s)", value)
+	if size, ok := strings.CutSuffix(strings.TrimSpace(value), "/s"); ok {
+		bytes, err := parseSize(size)
+		if err != nil || bytes <= 0 {
+			return 0, invalid
+		}
+		return bytes, nil
+	}
+
+	number, ok := strings.CutSuffix(strings.ToLower(strings.TrimSpace(value)), "bps")
+	if !ok {
+		return 0, invalid
+	}
+	multiplier := 1.0
+	for _, unit := range []struct {
+		prefix string
+		size   float64
+	}{{"k", 1e3}, {"m", 1e6}, {"g", 1e9}} {
+		if trimmed, ok := strings.CutSuffix(number, unit.prefix); ok {
+			number, multiplier = trimmed, unit.size
+			break
+		}
+	}
+	bits, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || bits <= 0 {
+		return 0, invalid
+	}
+	return max(1, int64(bits*multiplier/8)), nil
+}
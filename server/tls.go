@@ -0,0 +1,212 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ===========
+// SELF-SIGNED
+// ===========
+
+// How long a generated self-signed certificate stays valid
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// Load the cached self-signed certificate, or generate a new one if it is missing,
+// expired, or does not cover all the hosts it is expected to.
+// The certificate is cached under the user's config directory so that its
+// fingerprint stays stable across runs. If a local CA has been created with
+// `self-serve trust`, the certificate is issued by it instead of being self-signed.
+func loadOrCreateSelfSignedCert(host string) (tls.Certificate, error) {
+	dir, err := configDir("tls")
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+
+	dnsNames, ips := selfSignedHosts(host)
+
+	// Use the local CA as the issuer, if there is one
+	ca, caKey, err := loadLocalCA()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return tls.Certificate{}, err
+	}
+
+	// Reuse the cached certificate if it is still good
+	if cert, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil {
+		if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil && coversHosts(leaf, dnsNames, ips) && issuedBy(leaf, ca) {
+			return cert, nil
+		}
+	}
+
+	// Otherwise generate a new one and cache it
+	certPEM, keyPEM, err := generateCert(dnsNames, ips, ca, caKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// Generate a PEM encoded certificate and private key for the given hosts.
+// The certificate is signed by the given CA, or self-signed if the CA is nil.
+func generateCert(dnsNames []string, ips []net.IP, ca *x509.Certificate, caKey crypto.Signer) (certPEM, keyPEM []byte, err error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"self-serve"}, CommonName: "self-serve"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              dnsNames,
+		IPAddresses:           ips,
+	}
+
+	// Self-sign the certificate if there is no CA to issue it
+	var signer crypto.Signer = priv
+	parent := template
+	if ca != nil {
+		signer, parent = caKey, ca
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &priv.PublicKey, signer)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encodePEM(der, priv)
+}
+
+// The DNS names and IP addresses a self-signed certificate should be valid for
+func selfSignedHosts(host string) (dnsNames []string, ips []net.IP) {
+	dnsNames = []string{"localhost"}
+	ips = []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}
+	ips = append(ips, lanIPs()...)
+
+	// Include the configured host, if it is not already covered
+	if ip := net.ParseIP(host); ip != nil {
+		if !ip.IsUnspecified() && !slices.ContainsFunc(ips, ip.Equal) {
+			ips = append(ips, ip)
+		}
+	} else if host != "" && !slices.Contains(dnsNames, host) {
+		dnsNames = append(dnsNames, host)
+	}
+
+	return dnsNames, ips
+}
+
+// Boolean indicating whether the certificate is currently valid for all of the given hosts
+func coversHosts(cert *x509.Certificate, dnsNames []string, ips []net.IP) bool {
+	if time.Now().After(cert.NotAfter.Add(-24 * time.Hour)) {
+		return false // Expired, or about to be
+	}
+	for _, name := range dnsNames {
+		if !slices.Contains(cert.DNSNames, name) {
+			return false
+		}
+	}
+	for _, ip := range ips {
+		if !slices.ContainsFunc(cert.IPAddresses, ip.Equal) {
+			return false
+		}
+	}
+	return true
+}
+
+// Boolean indicating whether the certificate was issued by the given CA, or is self-signed if the CA is nil
+func issuedBy(cert *x509.Certificate, ca *x509.Certificate) bool {
+	if ca == nil {
+		return cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+	}
+	return cert.CheckSignatureFrom(ca) == nil
+}
+
+// The SHA-256 fingerprint of the certificate, formatted as colon separated hex
+func fingerprint(cert tls.Certificate) string {
+	sum := sha256.Sum256(cert.Certificate[0])
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Generate a random 128-bit certificate serial number
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// PEM encode a DER certificate and its private key
+func encodePEM(der []byte, priv crypto.PrivateKey) (certPEM, keyPEM []byte, err error) {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// Get (and create, if needed) a directory under the user's config directory
+func configDir(elem ...string) (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(append([]string{base, "self-serve"}, elem...)...)
+	return dir, os.MkdirAll(dir, 0700)
+}
+
+// The non-loopback IP addresses of this machine's network interfaces
+func lanIPs() []net.IP {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	var ips []net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		ips = append(ips, ipNet.IP)
+	}
+	return ips
+}
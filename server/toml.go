@@ -0,0 +1,428 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ====
+// TOML
+// ====
+
+// Parse the TOML document into a map, as the YAML and JSON decoders would. This covers what a
+// config file needs: tables (and arrays of tables), bare, quoted and dotted keys, strings,
+// integers, floats, booleans, arrays and inline tables. Dates are kept as strings.
+func parseTOML(src string) (map[string]any, error) {
+	p := &tomlParser{src: src, line: 1}
+	root := map[string]any{}
+	table := root
+	for {
+		p.skipBlank(true)
+		if p.done() {
+			return root, nil
+		}
+
+		var err error
+		if p.consume("[[") {
+			table, err = p.arrayTable(root)
+		} else if p.consume("[") {
+			table, err = p.table(root)
+		} else {
+			err = p.keyValue(table)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := p.endOfLine(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// The state of parsing a TOML document
+type tomlParser struct {
+	src  string // The document
+	pos  int    // The offset of the next byte to parse
+	line int    // The line of the next byte to parse (for the errors)
+}
+
+// Parse the header of a table (after its `[`), returning the table
+func (p *tomlParser) table(root map[string]any) (map[string]any, error) {
+	keys, err := p.keys()
+	if err != nil {
+		return nil, err
+	}
+	if !p.consume("]") {
+		return nil, p.errorf("expected ] after the table name")
+	}
+	return p.lookupTable(root, keys)
+}
+
+// Parse the header of an array of tables (after its `[[`), returning the new table appended to the array
+func (p *tomlParser) arrayTable(root map[string]any) (map[string]any, error) {
+	keys, err := p.keys()
+	if err != nil {
+		return nil, err
+	}
+	if !p.consume("]]") {
+		return nil, p.errorf("expected ]] after the table name")
+	}
+	parent, err := p.lookupTable(root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := keys[len(keys)-1]
+	array, _ := parent[last].([]any)
+	if _, exists := parent[last]; exists && array == nil {
+		return nil, p.errorf("%q is already defined", last)
+	}
+	table := map[string]any{}
+	parent[last] = append(array, table)
+	return table, nil
+}
+
+// Parse a `key = value` pair into the table
+func (p *tomlParser) keyValue(table map[string]any) error {
+	keys, err := p.keys()
+	if err != nil {
+		return err
+	}
+	p.skipBlank(false)
+	if !p.consume("=") {
+		return p.errorf("expected = after the key")
+	}
+	p.skipBlank(false)
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+	parent, err := p.lookupTable(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, exists := parent[last]; exists {
+		return p.errorf("%q is already defined", last)
+	}
+	parent[last] = value
+	return nil
+}
+
+// Parse a (possibly dotted) key, like `name`, `"/docs"` or `site.title`
+func (p *tomlParser) keys() ([]string, error) {
+	var keys []string
+	for {
+		p.skipBlank(false)
+		var key string
+		var err error
+		switch {
+		case p.peek() == '"':
+			key, err = p.basicString()
+		case p.peek() == '\'':
+			key, err = p.literalString()
+		default:
+			start := p.pos
+			for !p.done() && isBareKeyByte(p.src[p.pos]) {
+				p.pos++
+			}
+			if key = p.src[start:p.pos]; key == "" {
+				return nil, p.errorf("expected a key")
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		p.skipBlank(false)
+		if !p.consume(".") {
+			return keys, nil
+		}
+	}
+}
+
+// Parse a value
+func (p *tomlParser) value() (any, error) {
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], `"""`):
+		return p.multilineString(`"""`)
+	case strings.HasPrefix(p.src[p.pos:], "'''"):
+		return p.multilineString("'''")
+	case p.peek() == '"':
+		return p.basicString()
+	case p.peek() == '\'':
+		return p.literalString()
+	case p.consume("["):
+		return p.array()
+	case p.consume("{"):
+		return p.inlineTable()
+	}
+
+	// A boolean, number or date, up to the next delimiter
+	start := p.pos
+	for !p.done() && !strings.ContainsRune(",]}#\r\n", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	raw := strings.TrimSpace(p.src[start:p.pos])
+	switch raw {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "":
+		return nil, p.errorf("expected a value")
+	}
+	number := strings.ReplaceAll(raw, "_", "")
+	if n, err := strconv.ParseInt(number, 0, 64); err == nil {
+		return int(n), nil
+	}
+	if f, err := strconv.ParseFloat(number, 64); err == nil {
+		return f, nil
+	}
+	if raw[0] >= '0' && raw[0] <= '9' {
+		return raw, nil // A date or time
+	}
+	return nil, p.errorf("invalid value %q", raw)
+}
+
+// Parse an array (after its `[`), which can span lines
+func (p *tomlParser) array() ([]any, error) {
+	array := []any{}
+	for {
+		p.skipBlank(true)
+		if p.consume("]") {
+			return array, nil
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, value)
+		p.skipBlank(true)
+		if !p.consume(",") {
+			p.skipBlank(true)
+			if !p.consume("]") {
+				return nil, p.errorf("expected , or ] in the array")
+			}
+			return array, nil
+		}
+	}
+}
+
+// Parse an inline table (after its `{`), like `{ target = "http://localhost:3000", strip = "/api" }`
+func (p *tomlParser) inlineTable() (map[string]any, error) {
+	table := map[string]any{}
+	p.skipBlank(false)
+	if p.consume("}") {
+		return table, nil
+	}
+	for {
+		if err := p.keyValue(table); err != nil {
+			return nil, err
+		}
+		p.skipBlank(false)
+		if p.consume("}") {
+			return table, nil
+		}
+		if !p.consume(",") {
+			return nil, p.errorf("expected , or } in the inline table")
+		}
+	}
+}
+
+// Parse a "basic string", with its escapes
+func (p *tomlParser) basicString() (string, error) {
+	p.pos++ // The opening quote
+	var sb strings.Builder
+	for !p.done() {
+		c := p.src[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return sb.String(), nil
+		case c == '\n':
+			return "", p.errorf("unterminated string")
+		case c == '\\':
+			if err := p.escape(&sb); err != nil {
+				return "", err
+			}
+		default:
+			sb.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// Parse a 'literal string', without any escapes
+func (p *tomlParser) literalString() (string, error) {
+	p.pos++ // The opening quote
+	end := strings.IndexAny(p.src[p.pos:], "'\n")
+	if end < 0 || p.src[p.pos+end] != '\'' {
+		return "", p.errorf("unterminated string")
+	}
+	value := p.src[p.pos : p.pos+end]
+	p.pos += end + 1
+	return value, nil
+}
+
+// Parse a multi-line string (in triple quotes, basic or literal), trimming the newline after its opening quotes
+func (p *tomlParser) multilineString(quotes string) (string, error) {
+	p.pos += len(quotes)
+	p.consume("\r")
+	if p.consume("\n") {
+		p.line++
+	}
+	var sb strings.Builder
+	for !p.done() {
+		if strings.HasPrefix(p.src[p.pos:], quotes) {
+			p.pos += len(quotes)
+			return sb.String(), nil
+		}
+		c := p.src[p.pos]
+		if c == '\\' && quotes == `"""` {
+			if err := p.escape(&sb); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if c == '\n' {
+			p.line++
+		}
+		sb.WriteByte(c)
+		p.pos++
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// Parse an escape sequence in a basic string (at its backslash) onto the builder
+func (p *tomlParser) escape(sb *strings.Builder) error {
+	p.pos++ // The backslash
+	if p.done() {
+		return p.errorf("unterminated string")
+	}
+	c := p.src[p.pos]
+	p.pos++
+	switch c {
+	case 'b':
+		sb.WriteByte('\b')
+	case 't':
+		sb.WriteByte('\t')
+	case 'n':
+		sb.WriteByte('\n')
+	case 'f':
+		sb.WriteByte('\f')
+	case 'r':
+		sb.WriteByte('\r')
+	case '"', '\\':
+		sb.WriteByte(c)
+	case 'u', 'U':
+		digits := 4
+		if c == 'U' {
+			digits = 8
+		}
+		if p.pos+digits > len(p.src) {
+			return p.errorf("invalid unicode escape")
+		}
+		code, err := strconv.ParseUint(p.src[p.pos:p.pos+digits], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return p.errorf("invalid unicode escape")
+		}
+		sb.WriteRune(rune(code))
+		p.pos += digits
+	default:
+		return p.errorf("invalid escape \\%c", c)
+	}
+	return nil
+}
+
+// Find (or create) the table at the keys, descending into the last table of arrays of tables
+func (p *tomlParser) lookupTable(table map[string]any, keys []string) (map[string]any, error) {
+	for _, key := range keys {
+		switch value := table[key].(type) {
+		case nil:
+			child := map[string]any{}
+			table[key], table = child, child
+		case map[string]any:
+			table = value
+		case []any:
+			last, ok := value[len(value)-1].(map[string]any)
+			if !ok {
+				return nil, p.errorf("%q is not a table", key)
+			}
+			table = last
+		default:
+			return nil, p.errorf("%q is not a table", key)
+		}
+	}
+	return table, nil
+}
+
+// Skip the spaces and comments (and the newlines, if enabled)
+func (p *tomlParser) skipBlank(newlines bool) {
+	for !p.done() {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '\n' && newlines:
+			p.pos++
+			p.line++
+		case c == '#':
+			for !p.done() && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Expect the end of the line (after any spaces and comment)
+func (p *tomlParser) endOfLine() error {
+	p.skipBlank(false)
+	if p.done() {
+		return nil
+	}
+	if !p.consume("\n") {
+		return p.errorf("unexpected %q after the value", p.src[p.pos:p.pos+1])
+	}
+	p.line++
+	return nil
+}
+
+// Consume the prefix, if it is next
+func (p *tomlParser) consume(prefix string) bool {
+	if strings.HasPrefix(p.src[p.pos:], prefix) {
+		p.pos += len(prefix)
+		return true
+	}
+	return false
+}
+
+// The next byte (or 0 at the end)
+func (p *tomlParser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+// Boolean indicating whether the whole document has been parsed
+func (p *tomlParser) done() bool {
+	return p.pos >= len(p.src)
+}
+
+// An error at the current line
+func (p *tomlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Boolean indicating whether the byte can be part of a bare key (letters, digits, dashes and underscores)
+func isBareKeyByte(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-' || c == '_'
+}
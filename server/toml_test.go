@@ -0,0 +1,76 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		settings map[string]any
+		err      bool
+	}{
+		{
+			name:     "values",
+			src:      "port = 8080\nhost = \"0.0.0.0\" # all interfaces\nlive-reload = true\nrate = 1.5\nbig = 1_000\nhex = 0xff\nwhen = 2024-01-02\n",
+			settings: map[string]any{"port": 8080, "host": "0.0.0.0", "live-reload": true, "rate": 1.5, "big": 1000, "hex": 255, "when": "2024-01-02"},
+		},
+		{
+			name:     "strings",
+			src:      "basic = \"a\\tb\\u00e9\"\nliteral = 'C:\\path'\nmulti = \"\"\"\nline 1\nline 2\"\"\"\nraw = '''\n\\n'''\n",
+			settings: map[string]any{"basic": "a\tb\u00e9", "literal": `C:\path`, "multi": "line 1\nline 2", "raw": `\n`},
+		},
+		{
+			name:     "arrays",
+			src:      "exclude = [\"*.map\", 'node_modules']\nempty = []\nspread = [\n  1,\n  2, # two\n]\n",
+			settings: map[string]any{"exclude": []any{"*.map", "node_modules"}, "empty": []any{}, "spread": []any{1, 2}},
+		},
+		{
+			name: "tables",
+			src:  "[mounts]\n\"/docs\" = \"./docs\"\n\n[proxies]\n\"/api\" = { target = \"http://localhost:3000\", strip = \"/api\" }\n\n[profiles.lan]\nhost = \"0.0.0.0\"\n",
+			settings: map[string]any{
+				"mounts":   map[string]any{"/docs": "./docs"},
+				"proxies":  map[string]any{"/api": map[string]any{"target": "http://localhost:3000", "strip": "/api"}},
+				"profiles": map[string]any{"lan": map[string]any{"host": "0.0.0.0"}},
+			},
+		},
+		{
+			name:     "dotted keys",
+			src:      "profiles.dev.port = 3000\nprofiles.dev.spa = true\n",
+			settings: map[string]any{"profiles": map[string]any{"dev": map[string]any{"port": 3000, "spa": true}}},
+		},
+		{
+			name: "arrays of tables",
+			src:  "[[redirects]]\nfrom = \"/old\"\nto = \"/new\"\n\n[[redirects]]\nfrom = \"/a\"\nto = \"/b\"\nstatus = 302\n",
+			settings: map[string]any{"redirects": []any{
+				map[string]any{"from": "/old", "to": "/new"},
+				map[string]any{"from": "/a", "to": "/b", "status": 302},
+			}},
+		},
+		{name: "empty", src: "# nothing\n\n", settings: map[string]any{}},
+		{name: "missing value", src: "port =\n", err: true},
+		{name: "invalid value", src: "port = eighty\n", err: true},
+		{name: "unterminated string", src: "host = \"localhost\n", err: true},
+		{name: "unterminated array", src: "exclude = [\"a\", \"b\"\n", err: true},
+		{name: "unterminated table", src: "[mounts\n", err: true},
+		{name: "trailing characters", src: "port = 80, 81\n", err: true},
+	}
+	for _, tt := range tests {
+		settings, err := parseTOML(tt.src)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: parseTOML = %v, want an error", tt.name, settings)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: parseTOML failed: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(settings, tt.settings) {
+			t.Errorf("%s: parseTOML = %#v, want %#v", tt.name, settings, tt.settings)
+		}
+	}
+}
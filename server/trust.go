@@ -0,0 +1,226 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// ========
+// LOCAL CA
+// ========
+
+// How long the local CA stays valid
+const localCAValidity = 10 * 365 * 24 * time.Hour
+
+// The paths of the local CA certificate and private key
+func localCAPaths() (certPath, keyPath string, err error) {
+	dir, err := configDir("ca")
+	if err != nil {
+		return "", "", err
+	}
+	return filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem"), nil
+}
+
+// Load the local CA certificate and private key.
+// Returns an error wrapping fs.ErrNotExist if the CA has not been created yet.
+func loadLocalCA() (*x509.Certificate, crypto.Signer, error) {
+	certPath, keyPath, err := localCAPaths()
+	if err != nil {
+		return nil, nil, err
+	}
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	ca, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.New("the local CA private key cannot be used for signing")
+	}
+	return ca, signer, nil
+}
+
+// Create a new local CA and write it to the config directory
+func createLocalCA() error {
+	certPath, keyPath, err := localCAPaths()
+	if err != nil {
+		return err
+	}
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"self-serve local CA"}, CommonName: "self-serve local CA " + hostname},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(localCAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		return err
+	}
+	certPEM, keyPEM, err := encodePEM(der, priv)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(keyPath, keyPEM, 0600)
+}
+
+// Install the CA certificate into the system trust store (and the NSS store used by
+// Firefox and Chrome on Linux, if `certutil` is available)
+func installLocalCA(certPath string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return runPrivileged("security", "add-trusted-cert", "-d", "-r", "trustRoot", "-k", "/Library/Keychains/System.keychain", certPath)
+	case "windows":
+		return runPrivileged("certutil", "-addstore", "-f", "ROOT", certPath)
+	case "linux":
+		if err := installLinuxCA(certPath); err != nil {
+			return err
+		}
+		installNSSCA(certPath)
+		return nil
+	default:
+		return fmt.Errorf("installing certificates is not supported on %s", runtime.GOOS)
+	}
+}
+
+// Install the CA certificate into the Debian or Fedora style system trust store
+func installLinuxCA(certPath string) error {
+	stores := []struct{ dir, command string }{
+		{"/usr/local/share/ca-certificates", "update-ca-certificates"},
+		{"/etc/pki/ca-trust/source/anchors", "update-ca-trust"},
+		{"/etc/ca-certificates/trust-source/anchors", "trust"},
+	}
+	for _, store := range stores {
+		if _, err := os.Stat(store.dir); err != nil {
+			continue
+		}
+		target := filepath.Join(store.dir, "self-serve-local-ca.crt")
+		if err := runPrivileged("cp", certPath, target); err != nil {
+			return err
+		}
+		if store.command == "trust" {
+			return runPrivileged("trust", "extract-compat")
+		}
+		return runPrivileged(store.command)
+	}
+	return errors.New("could not find a supported system trust store")
+}
+
+// Install the CA certificate into the user's NSS database. This is best-effort.
+func installNSSCA(certPath string) {
+	if _, err := exec.LookPath("certutil"); err != nil {
+		return
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return
+	}
+	db := filepath.Join(home, ".pki", "nssdb")
+	if _, err := os.Stat(db); err != nil {
+		return
+	}
+	cmd := exec.Command("certutil", "-A", "-d", "sql:"+db, "-t", "C,,", "-n", "self-serve local CA", "-i", certPath)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		log.Printf("Could not install the CA into the NSS database: %v\n%s", err, out)
+	}
+}
+
+// ----------------
+// TRUST SUBCOMMAND
+// ----------------
+
+// Create a local CA, install it into the trust store, and issue a certificate for the host.
+// Usage: self-serve trust [--host <host>] [--no-install]
+func runTrust(args []string) {
+	defaultHost, _ := getDefaultConfiguration()
+
+	flags := flag.NewFlagSet("trust", flag.ExitOnError)
+	host := flags.String("host", defaultHost, "The host to issue a certificate for")
+	noInstall := flags.Bool("no-install", false, "Do not install the CA into the system trust store")
+	flags.Parse(args)
+
+	certPath, _, err := localCAPaths()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	// Create the local CA, if it does not exist yet
+	if _, _, err := loadLocalCA(); errors.Is(err, fs.ErrNotExist) {
+		if err := createLocalCA(); err != nil {
+			log.Fatalf("Could not create the local CA: %v\n", err)
+		}
+		log.Println("Created a new local CA at", certPath)
+	} else if err != nil {
+		log.Fatalf("Could not load the local CA: %v\n", err)
+	}
+
+	// Install the local CA into the trust store
+	if !*noInstall {
+		if err := installLocalCA(certPath); err != nil {
+			log.Fatalf("Could not install the local CA: %v\n", err)
+		}
+		log.Println("Installed the local CA into the system trust store")
+	}
+
+	// Issue a certificate for the host
+	cert, err := loadOrCreateSelfSignedCert(*host)
+	if err != nil {
+		log.Fatalf("Could not issue a certificate: %v\n", err)
+	}
+	dir, _ := configDir("tls")
+	log.Printf("Issued a certificate for %s in %s (SHA-256 fingerprint %s)\n", *host, dir, fingerprint(cert))
+	fmt.Println("Run `self-serve --tls` to serve HTTPS with it")
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Run a command with elevated privileges (using sudo on unix systems, when not root)
+func runPrivileged(name string, args ...string) error {
+	if runtime.GOOS != "windows" && os.Geteuid() != 0 {
+		if _, err := exec.LookPath("sudo"); err == nil {
+			args = append([]string{"--prompt=Sudo password:", name}, args...)
+			name = "sudo"
+		}
+	}
+	cmd := exec.Command(name, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,332 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// =========
+// DASHBOARD
+// =========
+
+// How often to repaint the dashboard
+const dashboardRefresh = 500 * time.Millisecond
+
+// The number of watch events and log messages to show on the dashboard
+const (
+	dashboardEvents   = 5
+	dashboardMessages = 5
+)
+
+// A request, as listed on the dashboard
+type dashboardRequest struct {
+	time     time.Time     // When the request came in
+	method   string        // The method of the request
+	url      string        // The URL of the request
+	status   int           // The status code of the response
+	size     int64         // The size of the response body
+	duration time.Duration // How long the response took
+}
+
+// A live terminal dashboard of the server, in place of the scrolling logs: the recent requests,
+// the counts of the status codes, the connected clients, the watch events and the log messages,
+// with keys to toggle caching, broadcast a live reload or quit
+type dashboard struct {
+	s *Self // The server to report on (and control)
+
+	mu       sync.Mutex
+	requests []dashboardRequest // The most recent requests (the latest last)
+	total    int64              // The number of requests served
+	statuses map[int]int64      // The number of requests served, by status code
+	clients  map[string]int     // The number of open connections, by client address
+	events   []string           // The most recent watch events
+	messages []string           // The most recent log messages
+	width    int                // The number of columns of the terminal
+	height   int                // The number of rows of the terminal
+	terminal string             // The state of the terminal to restore on close (empty if it was not changed)
+	closed   bool               // Whether the dashboard was closed (and the terminal restored)
+}
+
+// Create a new dashboard of the server
+func newDashboard(s *Self) *dashboard {
+	return &dashboard{s: s, statuses: map[int]int64{}, clients: map[string]int{}}
+}
+
+// Take over the terminal: switch to the alternate screen, read the keys as they are pressed,
+// and repaint the dashboard until closed. The log messages are shown on the dashboard meanwhile.
+func (d *dashboard) start() {
+	d.width, d.height = terminalSize()
+	d.terminal = rawTerminal()
+	fmt.Print("\u001b[?1049h\u001b[?25l") // Switch to the alternate screen, and hide the cursor
+	log.SetOutput(d)
+	go d.readKeys()
+	go func() {
+		for {
+			if !d.paint() {
+				return
+			}
+			time.Sleep(dashboardRefresh)
+		}
+	}()
+}
+
+// Give the terminal back, as it was
+func (d *dashboard) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+	d.closed = true
+	log.SetOutput(os.Stderr)
+	fmt.Print("\u001b[?25h\u001b[?1049l") // Show the cursor, and switch back to the main screen
+	restoreTerminal(d.terminal)
+}
+
+// Middleware that records the requests for the dashboard
+func (d *dashboard) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		lw := &loggingWriter{ResponseWriter: w}
+		next.ServeHTTP(lw, r)
+		status := lw.status
+		if status == 0 {
+			status = http.StatusOK // Nothing was written
+		}
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.total++
+		d.statuses[status]++
+		d.requests = appendRecent(d.requests, dashboardRequest{start, r.Method, r.URL.String(), status, lw.size, time.Since(start)}, max(d.height, 50))
+	})
+}
+
+// Track the open connections by client address (as the http.Server's ConnState hook)
+func (d *dashboard) trackConnection(conn net.Conn, state http.ConnState) {
+	client, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil || client == "" {
+		client = "local" // Connected over a Unix domain socket
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch state {
+	case http.StateNew:
+		d.clients[client]++
+	case http.StateClosed, http.StateHijacked:
+		if d.clients[client]--; d.clients[client] <= 0 {
+			delete(d.clients, client)
+		}
+	}
+}
+
+// Record the watch event (as the live reload's observer)
+func (d *dashboard) watched(event reloadEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	line := time.Now().Format(time.TimeOnly) + " " + event.Type + " " + strings.Join(event.Paths, ", ")
+	d.events = appendRecent(d.events, line, dashboardEvents)
+}
+
+// Record the log messages (as the output of the logger)
+func (d *dashboard) Write(b []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for line := range strings.Lines(string(b)) {
+		d.messages = appendRecent(d.messages, strings.TrimRight(line, "\r\n"), dashboardMessages)
+	}
+	return len(b), nil
+}
+
+// ----
+// KEYS
+// ----
+
+// Handle the keys: c to toggle caching, r to broadcast a live reload, and q to quit
+func (d *dashboard) readKeys() {
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		key, err := reader.ReadByte()
+		if err != nil {
+			return // stdin was closed, so there is nothing more to listen for
+		}
+		switch key {
+		case 'c':
+			d.s.noCache = !d.s.noCache
+			if d.s.noCache {
+				log.Println("Disabled caching")
+			} else {
+				log.Println("Enabled caching")
+			}
+			d.s.restartServer() // To serve the files with (or without) the caching headers
+		case 'r':
+			if d.s.reload == nil {
+				log.Println("Could not reload the pages: --live-reload is not enabled")
+				continue
+			}
+			d.s.reload.broadcast(reloadEvent{Type: "reload"})
+			log.Println("Reloaded the pages")
+		case 'q':
+			d.s.exit()
+			return
+		}
+	}
+}
+
+// --------
+// PAINTING
+// --------
+
+// Repaint the dashboard, returning false once it has been closed
+func (d *dashboard) paint() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return false
+	}
+
+	var lines []string
+	add := func(format string, args ...any) { lines = append(lines, fmt.Sprintf(format, args...)) }
+
+	// The server, and the state of the toggles
+	s := d.s
+	address := s.Scheme() + "://" + s.addr()
+	if s.unix != "" {
+		address = s.unix
+	}
+	add("%s %s %s", colorize(stdoutColor, colorBold, "self-serve"), colorize(stdoutColor, colorLink, address),
+		colorize(stdoutColor, colorGray, fmt.Sprintf("serving %s • up %s", s.dir, time.Since(s.started).Round(time.Second))))
+	add("Caching %s • Live reload %s", onOff(!s.noCache), onOff(s.reload != nil))
+	add("")
+
+	// The counts of the status codes
+	counts := []string{colorize(stdoutColor, colorBold, fmt.Sprintf("%d requests", d.total))}
+	for _, status := range slices.Sorted(maps.Keys(d.statuses)) {
+		counts = append(counts, colorize(stdoutColor, statusColor(status), strconv.Itoa(status))+" ×"+strconv.FormatInt(d.statuses[status], 10))
+	}
+	add("%s", strings.Join(counts, "  "))
+
+	// The connected clients
+	connections, clients := 0, make([]string, 0, len(d.clients))
+	for _, client := range slices.Sorted(maps.Keys(d.clients)) {
+		connections += d.clients[client]
+		clients = append(clients, client+" ×"+strconv.Itoa(d.clients[client]))
+	}
+	add("%s  %s", colorize(stdoutColor, colorBold, fmt.Sprintf("%d connections", connections)), fit(strings.Join(clients, "  "), d.width-20))
+	add("")
+
+	// The watch events and log messages, below the requests
+	var footer []string
+	footer = append(footer, "", colorize(stdoutColor, colorBold, "Watch events"))
+	for _, event := range d.events {
+		footer = append(footer, fit(event, d.width))
+	}
+	footer = append(footer, "", colorize(stdoutColor, colorBold, "Log"))
+	for _, message := range d.messages {
+		footer = append(footer, colorize(stdoutColor, colorGray, fit(message, d.width)))
+	}
+	footer = append(footer, "", colorize(stdoutColor, colorGray, "Press c to toggle caching • r to reload the pages • q to quit"))
+
+	// The most recent requests, filling the rest of the screen
+	add("%s", colorize(stdoutColor, colorBold, "Recent requests"))
+	rows := max(d.height-len(lines)-len(footer)-1, 1)
+	for _, req := range d.requests[max(len(d.requests)-rows, 0):] {
+		summary := fmt.Sprintf("%s %-7s %s %9s %8s ", req.time.Format(time.TimeOnly), req.method,
+			colorize(stdoutColor, statusColor(req.status), strconv.Itoa(req.status)), humanSize(req.size), roundDuration(req.duration))
+		add("%s%s", summary, fit(req.url, d.width-40))
+	}
+	lines = append(lines, footer...)
+
+	// Repaint over the previous frame, clearing what is left of it
+	var sb strings.Builder
+	sb.WriteString("\u001b[H")
+	for _, line := range lines {
+		sb.WriteString(line + "\u001b[K\n")
+	}
+	sb.WriteString("\u001b[J")
+	fmt.Print(sb.String())
+	return true
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Append the item, keeping only the n most recent items
+func appendRecent[T any](items []T, item T, n int) []T {
+	items = append(items, item)
+	if len(items) > n {
+		items = slices.Delete(items, 0, len(items)-n)
+	}
+	return items
+}
+
+// Truncate the text to the width, with an ellipsis
+func fit(text string, width int) string {
+	width = max(width, 10)
+	if utf8.RuneCountInString(text) <= width {
+		return text
+	}
+	return string([]rune(text)[:width-1]) + "…"
+}
+
+// The state of the toggle, to show
+func onOff(on bool) string {
+	if on {
+		return colorize(stdoutColor, colorGreen, "on")
+	}
+	return colorize(stdoutColor, colorGray, "off")
+}
+
+// Switch the terminal to read the keys as they are pressed (without waiting for enter, or echoing them),
+// returning its previous state to restore. Where stty is not available (like on Windows), the keys are
+// read once enter is pressed.
+func rawTerminal() string {
+	state, err := stty("-g")
+	if err != nil {
+		return ""
+	}
+	if _, err := stty("-icanon", "-echo", "min", "1"); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(state)
+}
+
+// Restore the terminal to its state from rawTerminal
+func restoreTerminal(state string) {
+	if state != "" {
+		stty(state)
+	}
+}
+
+// The number of columns and rows of the terminal (or 80 by 24, if unknown)
+func terminalSize() (width, height int) {
+	size, err := stty("size")
+	if err == nil {
+		if _, err := fmt.Sscan(size, &height, &width); err == nil && width > 0 && height > 0 {
+			return width, height
+		}
+	}
+	return 80, 24
+}
+
+// Run stty on the terminal, returning its output
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
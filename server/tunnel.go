@@ -0,0 +1,115 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// =======
+// TUNNELS
+// =======
+
+// The pattern of the URLs printed out by the tunnel commands
+var tunnelURLPattern = regexp.MustCompile(`https://[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}`)
+
+// A way of exposing the server at a public URL, through a command that establishes the tunnel
+// and prints out the URL
+type tunnelProvider struct {
+	name string // The provider, like `cloudflared` or `ssh`
+	host string // The host to tunnel through, like `nokey@localhost.run` (for ssh)
+}
+
+// Parse a --tunnel value: `cloudflared` (for a Cloudflare quick tunnel), or `ssh:[user@]host`
+// (for an ssh reverse tunnel to a host like localhost.run or serveo.net)
+func parseTunnel(value string) (tunnelProvider, error) {
+	if value == "cloudflared" {
+		return tunnelProvider{name: value}, nil
+	}
+	if host, ok := strings.CutPrefix(value, "ssh:"); ok && host != "" {
+		return tunnelProvider{name: "ssh", host: strings.TrimPrefix(host, "//")}, nil
+	}
+	return tunnelProvider{}, fmt.Errorf("invalid tunnel %q (expected cloudflared or ssh:[user@]host)", value)
+}
+
+// The command that tunnels to the local address (like `localhost:5327`)
+func (p tunnelProvider) command(local string, tls bool) *exec.Cmd {
+	if p.name == "cloudflared" {
+		scheme := "http"
+		if tls {
+			scheme = "https"
+		}
+		// Do not verify the (potentially self-signed) certificate of the server
+		return exec.Command("cloudflared", "tunnel", "--no-autoupdate", "--no-tls-verify", "--url", scheme+"://"+local)
+	}
+	return exec.Command("ssh", "-T", "-o", "ServerAliveInterval=30", "-o", "ExitOnForwardFailure=yes", "-R", "80:"+local, p.host)
+}
+
+// Boolean indicating whether the URL printed out by the command is the public URL (rather than,
+// say, a link to the provider's docs)
+func (p tunnelProvider) isPublicURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	if p.name == "cloudflared" {
+		return strings.HasSuffix(u.Host, ".trycloudflare.com")
+	}
+	host := p.host[strings.LastIndex(p.host, "@")+1:]
+	return u.Host != host && !strings.HasSuffix(u.Host, "."+host) // Not the provider's own pages
+}
+
+// A running tunnel
+type tunnel struct {
+	cmd  *exec.Cmd
+	once sync.Once // Prints the public URL once
+}
+
+// Start tunneling to the local address, calling found with the public URL once it is printed out
+func startTunnel(p tunnelProvider, local string, tls bool, found func(url string)) (*tunnel, error) {
+	t := &tunnel{cmd: p.command(local, tls)}
+	stdout, err := t.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := t.cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := t.cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	// Look for the public URL in the output
+	var wg sync.WaitGroup
+	for _, output := range []io.Reader{stdout, stderr} {
+		wg.Go(func() {
+			scanner := bufio.NewScanner(output)
+			for scanner.Scan() {
+				for _, u := range tunnelURLPattern.FindAllString(scanner.Text(), -1) {
+					if p.isPublicURL(u) {
+						t.once.Do(func() { found(u) })
+					}
+				}
+			}
+		})
+	}
+	go func() {
+		wg.Wait() // The output has to be read in full before waiting on the command
+		if err := t.cmd.Wait(); err != nil {
+			log.Printf("The %s tunnel closed: %v\n", p.name, err)
+		}
+	}()
+	return t, nil
+}
+
+// Close the tunnel
+func (t *tunnel) Close() error {
+	return t.cmd.Process.Kill()
+}
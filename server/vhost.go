@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// =============
+// VIRTUAL HOSTS
+// =============
+
+// A directory served for requests to a host
+type virtualHost struct {
+	host string // The host name (like `docs.local`), or a wildcard for its subdomains (like `*.docs.local`)
+	dir  string // The directory to serve
+}
+
+// Parse a --vhost value (in the form `host=dir`) into a virtual host
+func parseVirtualHost(value string) (virtualHost, error) {
+	host, dir, ok := strings.Cut(value, "=")
+	host = strings.ToLower(strings.TrimSpace(host))
+	dir = strings.TrimSpace(dir)
+	if !ok || host == "" || dir == "" {
+		return virtualHost{}, fmt.Errorf("invalid virtual host %q (expected host=dir)", value)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return virtualHost{}, fmt.Errorf("invalid virtual host %q (%s is not a directory)", value, dir)
+	}
+	return virtualHost{host, dir}, nil
+}
+
+// Middleware that routes requests by their Host header to the sites of the virtual hosts
+// (by host name, or `*.` wildcards), and the other requests to next
+func virtualHosts(sites map[string]http.Handler, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := requestHost(r)
+		if site, ok := sites[host]; ok {
+			site.ServeHTTP(w, r)
+			return
+		}
+		// Match the most specific wildcard (e.g. `*.app.local` before `*.local`)
+		for domain := host; strings.Contains(domain, "."); {
+			_, domain, _ = strings.Cut(domain, ".")
+			if site, ok := sites["*."+domain]; ok {
+				site.ServeHTTP(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// The host name the request was made to (lowercased, and without the port)
+func requestHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// =======
+// WATCHER
+// =======
+
+// How long to wait for a burst of changes to settle before reporting them
+const defaultWatchDebounce = 100 * time.Millisecond
+
+// How often to scan the directory tree for changes, when polling
+const watchPollInterval = time.Second
+
+// Watches a directory tree for changes, reporting them in debounced batches
+type watcher struct {
+	root     string                 // The directory being watched
+	ignore   func(name string) bool // Reports whether changes to a file (a slash separated path) should be ignored
+	debounce time.Duration          // How long to wait for changes to settle
+	notify   *fsnotify.Watcher      // The underlying file system watcher (nil when polling)
+	changed  chan string            // The individual changed files, before debouncing
+	Changes  chan []string          // The batches of changed files (as slash separated paths relative to the root)
+	done     chan struct{}          // Closed when the watcher is closed
+}
+
+// Start watching the directory tree rooted at root, using file system notifications,
+// or by periodically scanning the tree if poll is set (e.g. for network file systems)
+func newWatcher(root string, ignore func(name string) bool, debounce time.Duration, poll bool) (*watcher, error) {
+	w := &watcher{
+		root:     root,
+		ignore:   ignore,
+		debounce: debounce,
+		changed:  make(chan string),
+		Changes:  make(chan []string, 1),
+		done:     make(chan struct{}),
+	}
+
+	if poll {
+		go w.poll()
+	} else {
+		notify, err := fsnotify.NewWatcher()
+		if err != nil {
+			return nil, err
+		}
+		w.notify = notify
+		if err := w.addTree(root); err != nil {
+			notify.Close()
+			return nil, err
+		}
+		go w.listen()
+	}
+
+	go w.run()
+	return w, nil
+}
+
+// Watch the directory and all its (not ignored) subdirectories
+func (w *watcher) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return nil // Skip unreadable entries and files
+		}
+		if name != w.root && w.ignore(w.urlPath(name)) {
+			return filepath.SkipDir
+		}
+		return w.notify.Add(name)
+	})
+}
+
+// Report the changes from the file system notifications
+func (w *watcher) listen() {
+	for {
+		select {
+		case event, ok := <-w.notify.Events:
+			if !ok {
+				return
+			}
+			name := w.urlPath(event.Name)
+			if w.ignore(name) || event.Op == fsnotify.Chmod {
+				continue
+			}
+			// Watch newly created directories too
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					w.addTree(event.Name)
+				}
+			}
+			w.report(name)
+
+		case err, ok := <-w.notify.Errors:
+			if !ok {
+				return
+			}
+			log.Println("File watcher error:", err)
+		}
+	}
+}
+
+// A snapshot of a file's state, for detecting changes when polling
+type fileState struct {
+	modified time.Time
+	size     int64
+}
+
+// Report the changes found by periodically scanning the directory tree
+func (w *watcher) poll() {
+	previous := w.scan()
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			current := w.scan()
+			for name, state := range current {
+				if old, ok := previous[name]; !ok || old != state {
+					w.report(name) // Created or modified
+				}
+			}
+			for name := range previous {
+				if _, ok := current[name]; !ok {
+					w.report(name) // Removed
+				}
+			}
+			previous = current
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// Take a snapshot of the state of all (not ignored) files in the directory tree
+func (w *watcher) scan() map[string]fileState {
+	states := map[string]fileState{}
+	filepath.WalkDir(w.root, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || name == w.root {
+			return nil
+		}
+		urlPath := w.urlPath(name)
+		if w.ignore(urlPath) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info, err := entry.Info(); err == nil && !entry.IsDir() {
+			states[urlPath] = fileState{info.ModTime(), info.Size()}
+		}
+		return nil
+	})
+	return states
+}
+
+// Report a changed file, to be batched once the changes settle
+func (w *watcher) report(name string) {
+	select {
+	case w.changed <- name:
+	case <-w.done:
+	}
+}
+
+// Collect the changes and report them once they settle
+func (w *watcher) run() {
+	pending := map[string]struct{}{}
+	timer := time.NewTimer(w.debounce)
+	timer.Stop()
+
+	for {
+		select {
+		case name := <-w.changed:
+			pending[name] = struct{}{}
+			timer.Reset(w.debounce)
+
+		case <-timer.C:
+			changes := make([]string, 0, len(pending))
+			for name := range pending {
+				changes = append(changes, name)
+			}
+			sort.Strings(changes)
+			clear(pending)
+			select {
+			case w.Changes <- changes:
+			case <-w.done:
+				return
+			}
+
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// Stop watching
+func (w *watcher) Close() error {
+	close(w.done)
+	if w.notify != nil {
+		return w.notify.Close()
+	}
+	return nil
+}
+
+// The slash separated path of the file relative to the root (e.g. `/css/style.css`)
+func (w *watcher) urlPath(name string) string {
+	rel, err := filepath.Rel(w.root, name)
+	if err != nil {
+		return filepath.ToSlash(name)
+	}
+	if rel == "." {
+		return "/"
+	}
+	return "/" + filepath.ToSlash(rel)
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// ==========
+// WRITE MODE
+// ==========
+
+// Middleware that modifies the files in the root directory: `PUT` creates or overwrites a file
+// (or creates a directory, if the path ends with a slash), `MKCOL` creates a directory,
+// and `DELETE` removes a file or directory. Multipart `POST`s to a directory (as sent by the
+// upload form of the directory listing) upload the files into it. Hidden files cannot be written or removed.
+// The paths under the mount points are written in the mounted directories, where they are served from.
+func writeFiles(root string, mounts []mount, hide func(name string) bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut && r.Method != http.MethodDelete && r.Method != "MKCOL" && !isUpload(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Confine the path to the root directory (os.Root also refuses symlinks that escape it)
+		name := path.Clean("/" + r.URL.Path)
+		for dir := name; dir != "/"; dir = path.Dir(dir) {
+			if hide != nil && hide(dir) {
+				http.NotFound(w, r)
+				return
+			}
+		}
+		root, rest := resolveMount(mounts, root, name)
+		dir, err := os.OpenRoot(root)
+		if err != nil {
+			requestLogger(r).Println("Could not open the served directory:", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		defer dir.Close()
+
+		relative := strings.TrimPrefix(rest, "/")
+		if relative == "" {
+			relative = "."
+		}
+		var status int
+		switch {
+		case r.Method == http.MethodPost:
+			var names []string
+			if names, err = uploadFiles(dir, relative, name, hide, r); err == nil {
+				if wantsJSON(r) {
+					writeJSON(w, http.StatusCreated, names)
+				} else {
+					http.Redirect(w, r, r.URL.Path, http.StatusSeeOther) // Back to the listing
+				}
+				return
+			}
+			status = http.StatusBadRequest
+		case r.Method == http.MethodDelete:
+			status, err = removeFile(dir, relative)
+		case r.Method == "MKCOL", strings.HasSuffix(r.URL.Path, "/"):
+			status, err = makeDirectory(dir, relative, r.Method == "MKCOL")
+		default:
+			status, err = writeFile(dir, relative, r.Body)
+		}
+		if isBodyTooLarge(err) {
+			status = http.StatusRequestEntityTooLarge // Beyond --max-body-size
+		} else if err != nil {
+			requestLogger(r).Printf("Could not %s %s: %v\n", r.Method, name, err)
+		}
+		if status >= 400 {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		w.WriteHeader(status)
+	})
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// Boolean indicating whether the request is a multipart upload to a directory
+func isUpload(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/") && mediaType == "multipart/form-data"
+}
+
+// Write the files of the multipart form into the directory (at the URL path urlDir, which the hidden
+// files are checked against), and return their names
+func uploadFiles(dir *os.Root, name, urlDir string, hide func(name string) bool, r *http.Request) ([]string, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return names, nil
+		}
+		if err != nil {
+			return names, err
+		}
+		filename := path.Base(strings.ReplaceAll(part.FileName(), "\\", "/")) // Only keep the name, never the client's path
+		if part.FileName() == "" || filename == "." || filename == ".." || filename == "/" {
+			continue // Not a file (e.g. another form field)
+		}
+		file := path.Join(name, filename)
+		if hide != nil && hide(path.Join(urlDir, filename)) {
+			return names, fmt.Errorf("%s is hidden", filename)
+		}
+		if status, err := writeFile(dir, file, part); status >= 400 {
+			if err == nil {
+				err = fmt.Errorf("%s: %s", filename, http.StatusText(status))
+			}
+			return names, err
+		}
+		names = append(names, filename)
+	}
+}
+
+// Write the body to the file (creating its parent directories, if needed), replacing it atomically
+func writeFile(dir *os.Root, name string, body io.Reader) (int, error) {
+	if name == "." {
+		return http.StatusMethodNotAllowed, nil
+	}
+	if info, err := dir.Stat(name); err == nil && info.IsDir() {
+		return http.StatusMethodNotAllowed, nil
+	}
+	if err := dir.MkdirAll(path.Dir(name), 0o755); err != nil {
+		return http.StatusConflict, err
+	}
+
+	// Write to a temporary file first, so that readers never see a partially written file
+	temp := path.Join(path.Dir(name), "."+path.Base(name)+"."+rand.Text()[:8]+".tmp")
+	file, err := dir.OpenFile(temp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	_, err = io.Copy(file, body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		dir.Remove(temp)
+		return http.StatusInternalServerError, err
+	}
+
+	_, err = dir.Stat(name)
+	existed := err == nil
+	if err := dir.Rename(temp, name); err != nil {
+		dir.Remove(temp)
+		return http.StatusInternalServerError, err
+	}
+	if existed {
+		return http.StatusNoContent, nil
+	}
+	return http.StatusCreated, nil
+}
+
+// Create the directory. MKCOL requires the parent to exist and the directory to not (as in WebDAV),
+// while PUT creates any missing parents and accepts existing directories.
+func makeDirectory(dir *os.Root, name string, strict bool) (int, error) {
+	if !strict {
+		if err := dir.MkdirAll(name, 0o755); err != nil {
+			return http.StatusConflict, err
+		}
+		return http.StatusCreated, nil
+	}
+	err := dir.Mkdir(name, 0o755)
+	switch {
+	case err == nil:
+		return http.StatusCreated, nil
+	case errors.Is(err, fs.ErrExist):
+		return http.StatusMethodNotAllowed, nil
+	case errors.Is(err, fs.ErrNotExist):
+		return http.StatusConflict, nil
+	}
+	return http.StatusInternalServerError, err
+}
+
+// Remove the file, or the directory and everything in it
+func removeFile(dir *os.Root, name string) (int, error) {
+	if name == "." {
+		return http.StatusForbidden, nil // Never remove the served directory itself
+	}
+	if _, err := dir.Lstat(name); errors.Is(err, fs.ErrNotExist) {
+		return http.StatusNotFound, nil
+	}
+	if err := dir.RemoveAll(name); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusNoContent, nil
+}
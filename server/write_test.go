@@ -0,0 +1,209 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFilesConfinement(t *testing.T) {
+	root, outside, docs := t.TempDir(), t.TempDir(), t.TempDir()
+	mustWrite(t, filepath.Join(root, ".hidden"), "hidden")
+	mustWrite(t, filepath.Join(outside, "secret.txt"), "secret")
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Skip("symlinks are not supported:", err)
+	}
+
+	mounts := []mount{{prefix: "/docs", dir: docs, fsys: http.Dir(docs)}}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "next") })
+	handler := writeFiles(root, mounts, isDotfile, next)
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		status  int    // The status to respond with (0 for any error status)
+		written string // The file expected to be written with the body, if any
+		intact  string // The file expected to be left as it was, if any
+	}{
+		{name: "create", method: http.MethodPut, path: "/a.txt", body: "a", status: http.StatusCreated, written: filepath.Join(root, "a.txt")},
+		{name: "replace", method: http.MethodPut, path: "/a.txt", body: "b", status: http.StatusNoContent, written: filepath.Join(root, "a.txt")},
+		{name: "create parents", method: http.MethodPut, path: "/sub/dir/c.txt", body: "c", status: http.StatusCreated, written: filepath.Join(root, "sub", "dir", "c.txt")},
+		{name: "mounted", method: http.MethodPut, path: "/docs/d.txt", body: "d", status: http.StatusCreated, written: filepath.Join(docs, "d.txt")},
+		{name: "traversal", method: http.MethodPut, path: "/../escape.txt", body: "e", status: http.StatusCreated, written: filepath.Join(root, "escape.txt")},
+		{name: "nested traversal", method: http.MethodPut, path: "/sub/../../../escape.txt", body: "f", status: http.StatusNoContent, written: filepath.Join(root, "escape.txt")},
+		{name: "mounted traversal", method: http.MethodPut, path: "/docs/../../g.txt", body: "g", status: http.StatusCreated, written: filepath.Join(root, "g.txt")},
+		{name: "hidden file", method: http.MethodPut, path: "/.env", body: "h", status: http.StatusNotFound},
+		{name: "hidden directory", method: http.MethodPut, path: "/.git/config", body: "h", status: http.StatusNotFound},
+		{name: "hidden removal", method: http.MethodDelete, path: "/.hidden", status: http.StatusNotFound, intact: filepath.Join(root, ".hidden")},
+		{name: "symlink escape", method: http.MethodPut, path: "/link/evil.txt", body: "i"},
+		{name: "symlink overwrite", method: http.MethodPut, path: "/link/secret.txt", body: "i", intact: filepath.Join(outside, "secret.txt")},
+		{name: "symlink removal", method: http.MethodDelete, path: "/link/secret.txt", intact: filepath.Join(outside, "secret.txt")},
+		{name: "symlink directory", method: "MKCOL", path: "/link/dir"},
+		{name: "root removal", method: http.MethodDelete, path: "/", status: http.StatusForbidden},
+		{name: "directory", method: "MKCOL", path: "/new", status: http.StatusCreated},
+		{name: "existing directory", method: "MKCOL", path: "/new", status: http.StatusMethodNotAllowed},
+		{name: "directory over a file", method: http.MethodPut, path: "/new", body: "j", status: http.StatusMethodNotAllowed},
+		{name: "removal", method: http.MethodDelete, path: "/a.txt", status: http.StatusNoContent},
+		{name: "missing removal", method: http.MethodDelete, path: "/a.txt", status: http.StatusNotFound},
+		{name: "read", method: http.MethodGet, path: "/a.txt", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		intact := ""
+		if tt.intact != "" {
+			intact = mustRead(t, tt.intact)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, quietRequest(httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))))
+		if tt.status == 0 && rec.Code < 400 {
+			t.Errorf("%s: %s %s = %d, want an error", tt.name, tt.method, tt.path, rec.Code)
+		} else if tt.status != 0 && rec.Code != tt.status {
+			t.Errorf("%s: %s %s = %d, want %d", tt.name, tt.method, tt.path, rec.Code, tt.status)
+		}
+		if tt.written != "" {
+			if got := mustRead(t, tt.written); got != tt.body {
+				t.Errorf("%s: %s = %q, want %q", tt.name, tt.written, got, tt.body)
+			}
+		}
+		if tt.intact != "" {
+			if got := mustRead(t, tt.intact); got != intact {
+				t.Errorf("%s: %s = %q, want it left as %q", tt.name, tt.intact, got, intact)
+			}
+		}
+	}
+
+	// Nothing was written outside of the served and mounted directories
+	for _, name := range []string{filepath.Join(outside, "evil.txt"), filepath.Join(outside, "dir"), filepath.Join(filepath.Dir(root), "escape.txt")} {
+		if _, err := os.Lstat(name); err == nil {
+			t.Errorf("%s was written outside of the served directory", name)
+		}
+	}
+}
+
+func TestWriteFilesUploads(t *testing.T) {
+	root := t.TempDir()
+	handler := writeFiles(root, nil, isDotfile, http.NotFoundHandler())
+
+	tests := []struct {
+		name     string
+		filename string
+		status   int
+		written  string // The file expected to be written, if any
+	}{
+		{name: "upload", filename: "a.txt", status: http.StatusCreated, written: "a.txt"},
+		{name: "client path", filename: "../../b.txt", status: http.StatusCreated, written: "b.txt"},
+		{name: "windows client path", filename: `C:\Users\me\c.txt`, status: http.StatusCreated, written: "c.txt"},
+		{name: "hidden file", filename: ".env", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, err := form.CreateFormFile("files", tt.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(part, tt.name)
+		form.Close()
+
+		r := httptest.NewRequest(http.MethodPost, "/", &body)
+		r.Header.Set("Content-Type", form.FormDataContentType())
+		r.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, quietRequest(r))
+		if rec.Code != tt.status {
+			t.Errorf("%s: uploading %q = %d, want %d", tt.name, tt.filename, rec.Code, tt.status)
+		}
+		if tt.written != "" {
+			if got := mustRead(t, filepath.Join(root, tt.written)); got != tt.name {
+				t.Errorf("%s: %s = %q, want %q", tt.name, tt.written, got, tt.name)
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, ".env")); err == nil {
+		t.Errorf("the hidden file was uploaded")
+	}
+}
+
+func TestWriteFilesMountedUploads(t *testing.T) {
+	root, docs := t.TempDir(), t.TempDir()
+	if err := os.Mkdir(filepath.Join(docs, "private"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	exclude, err := globPatterns([]string{"docs/private/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mounts := []mount{{prefix: "/docs", dir: docs, fsys: http.Dir(docs)}}
+	handler := writeFiles(root, mounts, exclude, http.NotFoundHandler())
+
+	tests := []struct {
+		dir     string
+		status  int
+		written string // The file expected to be written, if any
+	}{
+		{dir: "/docs/", status: http.StatusCreated, written: filepath.Join(docs, "a.txt")},
+		{dir: "/docs/private/", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, err := form.CreateFormFile("files", "a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(part, "a")
+		form.Close()
+
+		r := httptest.NewRequest(http.MethodPost, tt.dir, &body)
+		r.Header.Set("Content-Type", form.FormDataContentType())
+		r.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, quietRequest(r))
+		if rec.Code != tt.status {
+			t.Errorf("uploading to %s = %d, want %d", tt.dir, rec.Code, tt.status)
+		}
+		if tt.written != "" && mustRead(t, tt.written) != "a" {
+			t.Errorf("uploading to %s did not write %s", tt.dir, tt.written)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(docs, "private", "a.txt")); err == nil {
+		t.Errorf("the excluded file was uploaded")
+	}
+}
+
+// ----------------
+// HELPER FUNCTIONS
+// ----------------
+
+// The request, logging to a discarded logger (in place of the standard logger)
+func quietRequest(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), loggerKey{}, log.New(io.Discard, "", 0)))
+}
+
+// Write the file, failing the test if it cannot be written
+func mustWrite(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Read the file, or an empty string if it does not exist
+func mustRead(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return string(data)
+}